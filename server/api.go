@@ -1,23 +1,37 @@
 package main
 
 import (
+	"crypto/subtle"
+	"encoding/csv"
 	"encoding/json"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
+	"github.com/mattermost/mattermost-server/v5/model"
 	"github.com/mattermost/mattermost-server/v5/plugin"
 )
 
 const (
 	// API V1
 	routeAPISettings = "/api/v1/settings"
+	routeAPIPreview  = "/api/v1/preview"
+	routeAPIAudit    = "/api/v1/audit"
 
 	routeProfileImage = "/profile.png"
+	routeMetrics      = "/metrics"
+
+	auditFormatCSV    = "csv"
+	auditFormatNDJSON = "ndjson"
+
+	defaultAuditPerPage = 1000
+	maxAuditPerPage     = 10000
 )
 
 func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Request) {
@@ -39,8 +53,14 @@ func (p *Plugin) serveHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Req
 	switch path := r.URL.Path; path {
 	case routeAPISettings:
 		return p.handleRouteAPISettings(w, r)
+	case routeAPIPreview:
+		return p.handleRouteAPIPreview(w, r)
+	case routeAPIAudit:
+		return p.handleRouteAPIAudit(w, r)
 	case routeProfileImage:
 		return p.handleProfileImage(w, r)
+	case routeMetrics:
+		return p.handleRouteMetrics(w, r)
 	}
 
 	return respondErr(w, http.StatusNotFound, errors.New("not found"))
@@ -74,6 +94,194 @@ func (p *Plugin) handleRouteAPISettings(w http.ResponseWriter, r *http.Request)
 	)
 }
 
+type previewRequest struct {
+	Action    string `json:"action"`
+	PostID    string `json:"post_id"`
+	ChannelID string `json:"channel_id"`
+}
+
+// handleRouteAPIPreview returns a dry-run preview of moving or copying a
+// thread so that the webapp can show it before running the command.
+func (p *Plugin) handleRouteAPIPreview(w http.ResponseWriter, r *http.Request) (int, error) {
+	if r.Method != http.MethodPost {
+		return respondErr(w, http.StatusMethodNotAllowed,
+			errors.Errorf("method %s is not allowed, must be POST", r.Method))
+	}
+
+	mattermostUserID := r.Header.Get("Mattermost-User-Id")
+	if mattermostUserID == "" {
+		return respondErr(w, http.StatusUnauthorized, errors.New("not authorized"))
+	}
+	if !p.getConfiguration().EnableWebUI || !p.authorizedPluginUser(mattermostUserID) {
+		return respondErr(w, http.StatusForbidden, errors.New("forbidden"))
+	}
+
+	var request previewRequest
+	err := decodeJSON(&request, r.Body)
+	if err != nil {
+		return respondErr(w, http.StatusBadRequest, errors.Wrap(err, "unable to decode request"))
+	}
+
+	var action string
+	switch request.Action {
+	case "move":
+		action = "move thread"
+	case "copy":
+		action = "copy thread"
+	default:
+		return respondErr(w, http.StatusBadRequest, errors.Errorf("invalid action %s; must be move or copy", request.Action))
+	}
+
+	post, appErr := p.API.GetPost(request.PostID)
+	if appErr != nil {
+		return respondErr(w, http.StatusNotFound, errors.Errorf("unable to get post with ID %s", request.PostID))
+	}
+	_, appErr = p.API.GetChannelMember(post.ChannelId, mattermostUserID)
+	if appErr != nil {
+		return respondErr(w, http.StatusForbidden, errors.New("forbidden"))
+	}
+
+	// The preview is built as if the command was run from the channel
+	// containing the post, which is how the webapp runs it.
+	extra := &model.CommandArgs{
+		UserId:    mattermostUserID,
+		ChannelId: post.ChannelId,
+	}
+	preview, response, err := p.previewMoveOrCopy(action, request.PostID, request.ChannelID, extra)
+	if err != nil {
+		return respondErr(w, http.StatusInternalServerError, err)
+	}
+	if response != nil {
+		return respondErr(w, http.StatusBadRequest, errors.New(response.Text))
+	}
+
+	return respondJSON(w, preview)
+}
+
+// handleRouteAPIAudit exports the audit log to system admins as CSV or
+// newline-delimited JSON, newest entries first. The entries can be filtered by
+// time range, user, channel and operation type, and are paginated.
+func (p *Plugin) handleRouteAPIAudit(w http.ResponseWriter, r *http.Request) (int, error) {
+	if r.Method != http.MethodGet {
+		return respondErr(w, http.StatusMethodNotAllowed,
+			errors.Errorf("method %s is not allowed, must be GET", r.Method))
+	}
+
+	mattermostUserID := r.Header.Get("Mattermost-User-Id")
+	if mattermostUserID == "" {
+		return respondErr(w, http.StatusUnauthorized, errors.New("not authorized"))
+	}
+	user, appErr := p.API.GetUser(mattermostUserID)
+	if appErr != nil {
+		return respondErr(w, http.StatusUnauthorized, errors.New("not authorized"))
+	}
+	if !user.IsSystemAdmin() {
+		return respondErr(w, http.StatusForbidden, errors.New("forbidden"))
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = auditFormatNDJSON
+	}
+	if format != auditFormatCSV && format != auditFormatNDJSON {
+		return respondErr(w, http.StatusBadRequest, errors.Errorf("invalid format %s; must be csv or ndjson", format))
+	}
+
+	now := time.Now()
+	filter := auditFilter{
+		userID:        query.Get("user_id"),
+		channelID:     query.Get("channel_id"),
+		operationType: query.Get("op"),
+	}
+	var err error
+	if since := query.Get("since"); since != "" {
+		filter.since, err = parseTimeFlag(since, now)
+		if err != nil {
+			return respondErr(w, http.StatusBadRequest, errors.Wrap(err, "invalid since value"))
+		}
+	}
+	if until := query.Get("until"); until != "" {
+		filter.until, err = parseTimeFlag(until, now)
+		if err != nil {
+			return respondErr(w, http.StatusBadRequest, errors.Wrap(err, "invalid until value"))
+		}
+	}
+
+	page, err := parseQueryInt(query.Get("page"), 0)
+	if err != nil || page < 0 {
+		return respondErr(w, http.StatusBadRequest, errors.New("page must be a non-negative integer"))
+	}
+	perPage, err := parseQueryInt(query.Get("per_page"), defaultAuditPerPage)
+	if err != nil || perPage < 1 || perPage > maxAuditPerPage {
+		return respondErr(w, http.StatusBadRequest, errors.Errorf("per_page must be an integer between 1 and %d", maxAuditPerPage))
+	}
+
+	// Rows are written as the entries are read, so the number of entries
+	// isn't known up front. A page with fewer than per_page entries is the
+	// last one.
+	var writeRow func(entry *auditEntry) error
+	var flush func() error
+	if format == auditFormatCSV {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="wrangler-audit.csv"`)
+
+		writer := csv.NewWriter(w)
+		writeRow = func(entry *auditEntry) error {
+			return writer.Write(entry.csvRecord())
+		}
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+		// The header is buffered along with the first rows, so an error
+		// reading the log can still be reported instead.
+		err = writer.Write(auditCSVHeader)
+		if err != nil {
+			return http.StatusInternalServerError, errors.WithMessage(err, "failed to write response")
+		}
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+
+		encoder := json.NewEncoder(w)
+		writeRow = func(entry *auditEntry) error {
+			return encoder.Encode(entry)
+		}
+		flush = func() error {
+			return nil
+		}
+	}
+
+	skip := page * perPage
+	var written int
+	var writeErr error
+	readErr := p.forEachAuditEntry(filter, func(entry *auditEntry) bool {
+		if skip > 0 {
+			skip--
+			return true
+		}
+		writeErr = writeRow(entry)
+		written++
+		return writeErr == nil && written < perPage
+	})
+	if readErr != nil {
+		if written == 0 {
+			// Nothing has been sent yet, so the error can still be reported.
+			return respondErr(w, http.StatusInternalServerError, readErr)
+		}
+		return http.StatusInternalServerError, errors.WithMessage(readErr, "failed to read audit log")
+	}
+	err = writeErr
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return http.StatusInternalServerError, errors.WithMessage(err, "failed to write response")
+	}
+
+	return http.StatusOK, nil
+}
+
 func (p *Plugin) handleProfileImage(w http.ResponseWriter, r *http.Request) (int, error) {
 	bundlePath, err := p.API.GetBundlePath()
 	if err != nil {
@@ -94,6 +302,54 @@ func (p *Plugin) handleProfileImage(w http.ResponseWriter, r *http.Request) (int
 	return http.StatusOK, nil
 }
 
+// handleRouteMetrics serves the Wrangler metrics in the Prometheus text
+// format. Metrics can be read by system admins or with the configured metrics
+// token as a bearer token.
+func (p *Plugin) handleRouteMetrics(w http.ResponseWriter, r *http.Request) (int, error) {
+	if r.Method != http.MethodGet {
+		return respondErr(w, http.StatusMethodNotAllowed,
+			errors.Errorf("method %s is not allowed, must be GET", r.Method))
+	}
+
+	if !p.authorizedMetricsRequest(r) {
+		mattermostUserID := r.Header.Get("Mattermost-User-Id")
+		if mattermostUserID == "" {
+			return respondErr(w, http.StatusUnauthorized, errors.New("not authorized"))
+		}
+		user, appErr := p.API.GetUser(mattermostUserID)
+		if appErr != nil {
+			return respondErr(w, http.StatusUnauthorized, errors.New("not authorized"))
+		}
+		if !user.IsSystemAdmin() {
+			return respondErr(w, http.StatusForbidden, errors.New("forbidden"))
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	err := p.metrics.writeTo(w)
+	if err != nil {
+		return http.StatusInternalServerError, errors.Wrap(err, "unable to write metrics")
+	}
+
+	return http.StatusOK, nil
+}
+
+// authorizedMetricsRequest returns whether a request carries the configured
+// metrics token as a bearer token.
+func (p *Plugin) authorizedMetricsRequest(r *http.Request) bool {
+	token := p.getConfiguration().MetricsToken
+	if len(token) == 0 {
+		return false
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(authorization, "Bearer ")), []byte(token)) == 1
+}
+
 func respondErr(w http.ResponseWriter, code int, err error) (int, error) {
 	http.Error(w, err.Error(), code)
 	return code, err
@@ -114,6 +370,16 @@ func respondJSON(w http.ResponseWriter, obj interface{}) (int, error) {
 	return http.StatusOK, nil
 }
 
+// parseQueryInt parses an integer query parameter, returning the default value
+// if it isn't set.
+func parseQueryInt(value string, defaultValue int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	return strconv.Atoi(value)
+}
+
 func decodeJSON(obj interface{}, body io.ReadCloser) error {
 	decoder := json.NewDecoder(body)
 	err := decoder.Decode(&obj)
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleRouteAPIAudit(t *testing.T) {
+	admin := &model.User{Id: model.NewId(), Roles: model.SYSTEM_ADMIN_ROLE_ID}
+	user := &model.User{Id: model.NewId(), Roles: model.SYSTEM_USER_ROLE_ID}
+
+	api := &plugintest.API{}
+	newMockKVStore(api)
+	api.On("GetUser", admin.Id).Return(admin, nil)
+	api.On("GetUser", user.Id).Return(user, nil)
+	logErrorArgs := []interface{}{mock.AnythingOfTypeArgument("string")}
+	for i := 0; i < 12; i++ {
+		logErrorArgs = append(logErrorArgs, mock.AnythingOfTypeArgument("string"))
+	}
+	api.On("LogError", logErrorArgs...).Return(nil)
+
+	var plugin Plugin
+	plugin.SetAPI(api)
+
+	channel := &model.Channel{Id: model.NewId(), TeamId: model.NewId()}
+	var operationIDs []string
+	for _, userID := range []string{user.Id, admin.Id, user.Id} {
+		op := newOperation(operationTypeMove, userID)
+		op.startAudit([]*model.Channel{channel}, channel, []*model.Post{{Id: model.NewId()}}, "", []string{"--silent=true"})
+		plugin.recordAudit(op, auditOutcomeSucceeded, nil)
+		operationIDs = append(operationIDs, op.ID)
+	}
+
+	serve := func(userID, query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, routeAPIAudit+query, nil)
+		if userID != "" {
+			r.Header.Set("Mattermost-User-Id", userID)
+		}
+		w := httptest.NewRecorder()
+		plugin.ServeHTTP(nil, w, r)
+		return w
+	}
+
+	t.Run("not logged in", func(t *testing.T) {
+		w := serve("", "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("not an admin", func(t *testing.T) {
+		w := serve(user.Id, "")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		w := serve(admin.Id, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+		var entries []auditEntry
+		scanner := bufio.NewScanner(w.Body)
+		for scanner.Scan() {
+			var entry auditEntry
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+			entries = append(entries, entry)
+		}
+		require.Len(t, entries, 3)
+		assert.Equal(t, channel.Id, entries[0].TargetChannelID)
+		assert.Equal(t, []string{"--silent=true"}, entries[0].Flags)
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		w := serve(admin.Id, "?format=csv")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+
+		records, err := csv.NewReader(w.Body).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 4)
+		assert.Equal(t, auditCSVHeader, records[0])
+		for _, record := range records[1:] {
+			assert.Contains(t, operationIDs, record[0])
+			assert.Equal(t, operationTypeMove, record[1])
+			assert.Equal(t, auditOutcomeSucceeded, record[3])
+		}
+	})
+
+	t.Run("filtered by user", func(t *testing.T) {
+		w := serve(admin.Id, "?user_id="+user.Id)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, strings.Split(strings.TrimSpace(w.Body.String()), "\n"), 2)
+		assert.NotContains(t, w.Body.String(), operationIDs[1])
+	})
+
+	t.Run("filtered by time", func(t *testing.T) {
+		inAnHour := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+		w := serve(admin.Id, "?since="+inAnHour)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Body.String())
+
+		w = serve(admin.Id, "?since=1h&until="+inAnHour)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, strings.Split(strings.TrimSpace(w.Body.String()), "\n"), 3)
+	})
+
+	t.Run("paginated", func(t *testing.T) {
+		w := serve(admin.Id, "?per_page=2")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, strings.Split(strings.TrimSpace(w.Body.String()), "\n"), 2)
+
+		w = serve(admin.Id, "?per_page=2&page=1")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, strings.Split(strings.TrimSpace(w.Body.String()), "\n"), 1)
+
+		w = serve(admin.Id, "?per_page=2&page=5")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Body.String())
+	})
+
+	t.Run("only the needed days are read", func(t *testing.T) {
+		olderEntry := &auditEntry{
+			OperationID: model.NewId(),
+			Type:        operationTypeCopy,
+			EndAt:       model.GetMillisForTime(time.Now().AddDate(0, 0, -10)),
+		}
+		require.NoError(t, plugin.saveAuditEntry(olderEntry))
+		olderKey := auditKey(time.Unix(0, olderEntry.EndAt*int64(time.Millisecond)), olderEntry.OperationID)
+		olderKeyReads := func() int {
+			var reads int
+			for _, call := range api.Calls {
+				if call.Method == "KVGet" && call.Arguments.String(0) == olderKey {
+					reads++
+				}
+			}
+			return reads
+		}
+
+		w := serve(admin.Id, "?per_page=3")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), olderEntry.OperationID)
+		assert.Equal(t, 0, olderKeyReads())
+
+		w = serve(admin.Id, "?since=1h")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 0, olderKeyReads())
+
+		w = serve(admin.Id, "?per_page=2&page=1")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), olderEntry.OperationID)
+		assert.Equal(t, 1, olderKeyReads())
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		for _, query := range []string{"?format=xml", "?since=yesterday", "?page=-1", "?per_page=0", "?per_page=many"} {
+			w := serve(admin.Id, query)
+			assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		}
+	})
+
+	t.Run("wrong method", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, routeAPIAudit, nil)
+		r.Header.Set("Mattermost-User-Id", admin.Id)
+		w := httptest.NewRecorder()
+		plugin.ServeHTTP(nil, w, r)
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+}
+
+func TestHandleRouteMetrics(t *testing.T) {
+	admin := &model.User{Id: model.NewId(), Roles: model.SYSTEM_ADMIN_ROLE_ID}
+	user := &model.User{Id: model.NewId(), Roles: model.SYSTEM_USER_ROLE_ID}
+
+	api := &plugintest.API{}
+	api.On("GetUser", admin.Id).Return(admin, nil)
+	api.On("GetUser", user.Id).Return(user, nil)
+	logErrorArgs := []interface{}{mock.AnythingOfTypeArgument("string")}
+	for i := 0; i < 12; i++ {
+		logErrorArgs = append(logErrorArgs, mock.AnythingOfTypeArgument("string"))
+	}
+	api.On("LogError", logErrorArgs...).Return(nil)
+
+	var plugin Plugin
+	plugin.SetAPI(api)
+	plugin.metrics = newMetrics()
+	plugin.metrics.observePostRecreated()
+	plugin.setConfiguration(&configuration{MetricsToken: "secret"})
+
+	serve := func(header, value string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, routeMetrics, nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		plugin.ServeHTTP(nil, w, r)
+		return w
+	}
+
+	t.Run("not logged in", func(t *testing.T) {
+		w := serve("", "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("not an admin", func(t *testing.T) {
+		w := serve("Mattermost-User-Id", user.Id)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("wrong token", func(t *testing.T) {
+		w := serve("Authorization", "Bearer wrong")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		w := serve("Mattermost-User-Id", admin.Id)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/plain; version=0.0.4", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), "wrangler_posts_recreated_total 1\n")
+	})
+
+	t.Run("token", func(t *testing.T) {
+		w := serve("Authorization", "Bearer secret")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "wrangler_posts_recreated_total 1\n")
+	})
+
+	t.Run("token not configured", func(t *testing.T) {
+		plugin.setConfiguration(&configuration{})
+		defer plugin.setConfiguration(&configuration{MetricsToken: "secret"})
+
+		w := serve("Authorization", "Bearer ")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
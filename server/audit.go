@@ -0,0 +1,415 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+const (
+	auditKeyPrefix = "audit_"
+
+	// auditDayFormat is the format of the day, in UTC, that an entry was
+	// recorded on in the key of each audit log entry.
+	auditDayFormat = "20060102"
+
+	// auditDaysKey stores every day that has audit log entries, and
+	// auditDayKeyPrefix the operation IDs of the entries recorded on each
+	// day, so that the log can be read without listing every key.
+	auditDaysKey      = "audit_days"
+	auditDayKeyPrefix = "audit_day_"
+
+	auditOutcomeSucceeded  = "succeeded"
+	auditOutcomeRolledBack = "rolled_back"
+	auditOutcomeFailed     = "failed"
+)
+
+// auditEntry is a record of a Wrangler operation in the audit log. It is
+// started when the operation starts and recorded once the operation has
+// finished or been rolled back.
+type auditEntry struct {
+	OperationID      string   `json:"operation_id"`
+	Type             string   `json:"type"`
+	UndoneID         string   `json:"undone_operation_id,omitempty"`
+	UserID           string   `json:"user_id"`
+	SourceChannelIDs []string `json:"source_channel_ids"`
+	SourceTeamIDs    []string `json:"source_team_ids,omitempty"`
+	TargetChannelID  string   `json:"target_channel_id"`
+	TargetTeamID     string   `json:"target_team_id,omitempty"`
+	OriginalRootIDs  []string `json:"original_root_ids"`
+	NewRootID        string   `json:"new_root_id,omitempty"`
+	PostCount        int      `json:"post_count"`
+	FileCount        int      `json:"file_count"`
+	Flags            []string `json:"flags,omitempty"`
+	Outcome          string   `json:"outcome"`
+	Error            string   `json:"error,omitempty"`
+	StartAt          int64    `json:"start_at"`
+	EndAt            int64    `json:"end_at"`
+	DurationMillis   int64    `json:"duration_ms"`
+}
+
+// auditCSVHeader is the header row of the audit log CSV export. It matches the
+// fields returned by csvRecord.
+var auditCSVHeader = []string{
+	"operation_id",
+	"type",
+	"user_id",
+	"outcome",
+	"error",
+	"start_at",
+	"end_at",
+	"duration_ms",
+	"source_channel_ids",
+	"source_team_ids",
+	"target_channel_id",
+	"target_team_id",
+	"original_root_ids",
+	"new_root_id",
+	"post_count",
+	"file_count",
+	"flags",
+}
+
+// csvRecord returns the entry as a row of the audit log CSV export. Times are
+// formatted as RFC3339 in UTC and lists are separated by spaces.
+func (e *auditEntry) csvRecord() []string {
+	formatTime := func(millis int64) string {
+		return time.Unix(0, millis*int64(time.Millisecond)).UTC().Format(time.RFC3339)
+	}
+
+	return []string{
+		e.OperationID,
+		e.Type,
+		e.UserID,
+		e.Outcome,
+		e.Error,
+		formatTime(e.StartAt),
+		formatTime(e.EndAt),
+		strconv.FormatInt(e.DurationMillis, 10),
+		strings.Join(e.SourceChannelIDs, " "),
+		strings.Join(e.SourceTeamIDs, " "),
+		e.TargetChannelID,
+		e.TargetTeamID,
+		strings.Join(e.OriginalRootIDs, " "),
+		e.NewRootID,
+		strconv.Itoa(e.PostCount),
+		strconv.Itoa(e.FileCount),
+		strings.Join(e.Flags, " "),
+	}
+}
+
+// auditFilter selects audit entries. Empty fields match every entry.
+type auditFilter struct {
+	userID        string
+	channelID     string
+	teamID        string
+	operationType string
+	since         int64
+	until         int64
+}
+
+func (f *auditFilter) matches(entry *auditEntry) bool {
+	if len(f.userID) != 0 && entry.UserID != f.userID {
+		return false
+	}
+	if len(f.operationType) != 0 && entry.Type != f.operationType {
+		return false
+	}
+	if len(f.channelID) != 0 && entry.TargetChannelID != f.channelID && !containsString(entry.SourceChannelIDs, f.channelID) {
+		return false
+	}
+	if len(f.teamID) != 0 && entry.TargetTeamID != f.teamID && !containsString(entry.SourceTeamIDs, f.teamID) {
+		return false
+	}
+	if f.since != 0 && entry.EndAt < f.since {
+		return false
+	}
+	if f.until != 0 && entry.EndAt > f.until {
+		return false
+	}
+
+	return true
+}
+
+// includesDay returns whether entries recorded on the given UTC day can match
+// the filter's time range.
+func (f *auditFilter) includesDay(day time.Time) bool {
+	if f.since != 0 && model.GetMillisForTime(day.AddDate(0, 0, 1)) <= f.since {
+		return false
+	}
+	if f.until != 0 && model.GetMillisForTime(day) > f.until {
+		return false
+	}
+
+	return true
+}
+
+// auditKey returns the key of the audit log entry of an operation recorded on
+// the given day. An operation recorded again on the same day, such as when it
+// is resumed, replaces its earlier entry.
+func auditKey(day time.Time, operationID string) string {
+	return fmt.Sprintf("%s%s_%s", auditKeyPrefix, day.UTC().Format(auditDayFormat), operationID)
+}
+
+// auditDayKey returns the key of the operation IDs of the audit log entries
+// recorded on the given day.
+func auditDayKey(day string) string {
+	return auditDayKeyPrefix + day
+}
+
+// startAudit starts the audit entry of an operation that wrangles the given
+// original posts from the source channels to the target channel. The new root
+// ID can be set later with setAuditNewRootID if it isn't known yet. Starting
+// an audit on a nil operation does nothing.
+func (o *operation) startAudit(sourceChannels []*model.Channel, targetChannel *model.Channel, originalPosts []*model.Post, newRootID string, flags []string) {
+	if o == nil {
+		return
+	}
+
+	entry := &auditEntry{
+		OperationID:     o.ID,
+		Type:            o.Type,
+		UserID:          o.UserID,
+		TargetChannelID: targetChannel.Id,
+		TargetTeamID:    targetChannel.TeamId,
+		NewRootID:       newRootID,
+		PostCount:       len(originalPosts),
+		Flags:           flags,
+		StartAt:         o.CreateAt,
+	}
+	for _, channel := range sourceChannels {
+		if !containsString(entry.SourceChannelIDs, channel.Id) {
+			entry.SourceChannelIDs = append(entry.SourceChannelIDs, channel.Id)
+		}
+		if len(channel.TeamId) != 0 && !containsString(entry.SourceTeamIDs, channel.TeamId) {
+			entry.SourceTeamIDs = append(entry.SourceTeamIDs, channel.TeamId)
+		}
+	}
+	for _, post := range originalPosts {
+		entry.FileCount += len(post.FileIds)
+		rootID := getPostRootID(post)
+		if !containsString(entry.OriginalRootIDs, rootID) {
+			entry.OriginalRootIDs = append(entry.OriginalRootIDs, rootID)
+		}
+	}
+	o.Audit = entry
+}
+
+// startUndoAudit starts the audit entry of an operation that undoes another
+// operation by wrangling its messages from the target of the undone
+// operation back to the given channel. The undo is only audited if the undone
+// operation was.
+func (o *operation) startUndoAudit(undone *operation, targetChannel *model.Channel) {
+	if o == nil || undone.Audit == nil {
+		return
+	}
+
+	entry := &auditEntry{
+		OperationID:      o.ID,
+		Type:             o.Type,
+		UndoneID:         undone.ID,
+		UserID:           o.UserID,
+		SourceChannelIDs: []string{undone.Audit.TargetChannelID},
+		TargetChannelID:  targetChannel.Id,
+		TargetTeamID:     targetChannel.TeamId,
+		PostCount:        undone.Audit.PostCount,
+		FileCount:        undone.Audit.FileCount,
+		StartAt:          o.CreateAt,
+	}
+	if len(undone.Audit.TargetTeamID) != 0 {
+		entry.SourceTeamIDs = []string{undone.Audit.TargetTeamID}
+	}
+	if len(undone.Audit.NewRootID) != 0 {
+		entry.OriginalRootIDs = []string{undone.Audit.NewRootID}
+	}
+	o.Audit = entry
+}
+
+// setAuditNewRootID records the root ID of the thread the operation created
+// or changed. Operations without an audit entry are not affected.
+func (o *operation) setAuditNewRootID(rootID string) {
+	if o == nil || o.Audit == nil {
+		return
+	}
+
+	o.Audit.NewRootID = rootID
+}
+
+// recordAudit completes the audit entry of an operation with its outcome and
+// adds it to the audit log. Failing to record an entry is logged, but leaves
+// the operation itself unaffected. Operations without an audit entry are
+// skipped.
+func (p *Plugin) recordAudit(op *operation, outcome string, err error) {
+	if op.Audit == nil {
+		return
+	}
+
+	entry := *op.Audit
+	entry.Outcome = outcome
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	entry.EndAt = model.GetMillis()
+	entry.DurationMillis = entry.EndAt - entry.StartAt
+
+	saveErr := p.saveAuditEntry(&entry)
+	if saveErr != nil {
+		p.API.LogError("Unable to record Wrangler operation in the audit log",
+			"error", saveErr.Error(),
+			"operation_id", op.ID,
+		)
+	}
+
+	p.metrics.observeOperation(entry.Type, entry.Outcome, time.Duration(entry.DurationMillis)*time.Millisecond)
+	p.postAuditNotice(&entry)
+}
+
+// saveAuditEntry stores an entry in the audit log. Every entry has its own
+// key so that entries recorded at the same time by other servers are kept.
+func (p *Plugin) saveAuditEntry(entry *auditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal audit entry")
+	}
+
+	endAt := time.Unix(0, entry.EndAt*int64(time.Millisecond))
+	day := endAt.UTC().Format(auditDayFormat)
+	err = p.addToKVList(auditDaysKey, day)
+	if err != nil {
+		return errors.Wrap(err, "unable to index audit day")
+	}
+	err = p.addToKVList(auditDayKey(day), entry.OperationID)
+	if err != nil {
+		return errors.Wrap(err, "unable to index audit entry")
+	}
+
+	appErr := p.API.KVSet(auditKey(endAt, entry.OperationID), data)
+	if appErr != nil {
+		return errors.Wrap(appErr, "unable to save audit entry")
+	}
+
+	return nil
+}
+
+// getAuditEntries returns every audit entry matching the filter, newest
+// first.
+func (p *Plugin) getAuditEntries(filter auditFilter) ([]*auditEntry, error) {
+	var entries []*auditEntry
+	err := p.forEachAuditEntry(filter, func(entry *auditEntry) bool {
+		entries = append(entries, entry)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// forEachAuditEntry calls fn with every audit entry matching the filter,
+// newest first, until fn returns false. Entries are loaded one day at a time
+// and only for the days in the filter's time range, so that stopping early
+// doesn't read the rest of the log.
+func (p *Plugin) forEachAuditEntry(filter auditFilter, fn func(entry *auditEntry) bool) error {
+	days, err := p.getAuditDays(filter)
+	if err != nil {
+		return err
+	}
+
+	for _, day := range days {
+		operationIDs, err := p.getKVList(auditDayKey(day.Format(auditDayFormat)))
+		if err != nil {
+			return err
+		}
+
+		var entries []*auditEntry
+		for _, operationID := range operationIDs {
+			key := auditKey(day, operationID)
+			data, appErr := p.API.KVGet(key)
+			if appErr != nil {
+				return errors.Wrapf(appErr, "unable to get audit entry %s", key)
+			}
+			if data == nil {
+				continue
+			}
+
+			var entry auditEntry
+			err = json.Unmarshal(data, &entry)
+			if err != nil {
+				return errors.Wrapf(err, "unable to unmarshal audit entry %s", key)
+			}
+			if filter.matches(&entry) {
+				entries = append(entries, &entry)
+			}
+		}
+
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].EndAt > entries[j].EndAt
+		})
+		for _, entry := range entries {
+			if !fn(entry) {
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
+// getAuditDays returns the days in the filter's time range that have audit
+// entries, newest first.
+func (p *Plugin) getAuditDays(filter auditFilter) ([]time.Time, error) {
+	storedDays, err := p.getKVList(auditDaysKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var days []time.Time
+	for _, storedDay := range storedDays {
+		day, err := time.Parse(auditDayFormat, storedDay)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to parse audit day %s", storedDay)
+		}
+		if filter.includesDay(day) {
+			days = append(days, day)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].After(days[j])
+	})
+
+	return days, nil
+}
+
+// getSetFlags parses the args with the given flag set and returns the flags
+// that were set, formatted as --name=value, so that they can be audited.
+func getSetFlags(flagSet *pflag.FlagSet, args []string) []string {
+	err := flagSet.Parse(args)
+	if err != nil {
+		return nil
+	}
+
+	var flags []string
+	flagSet.Visit(func(flag *pflag.Flag) {
+		flags = append(flags, fmt.Sprintf("--%s=%s", flag.Name, flag.Value.String()))
+	})
+
+	return flags
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
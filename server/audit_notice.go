@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+// auditNoticeVerbs are the past tense verbs used to describe each audited
+// operation type in audit channel notices.
+var auditNoticeVerbs = map[string]string{
+	operationTypeMove:        "moved",
+	operationTypeCopy:        "copied",
+	operationTypeMerge:       "merged",
+	operationTypeAttach:      "attached",
+	operationTypeSplit:       "split",
+	operationTypeReroot:      "rerooted",
+	operationTypeFlatten:     "flattened",
+	operationTypeMoveReplies: "moved",
+	operationTypeGather:      "gathered",
+	operationTypeDetach:      "detached",
+	operationTypeUndo:        "restored",
+}
+
+// auditNoticeKeepsOriginals are the operation types that leave the root
+// messages of the original threads in place.
+var auditNoticeKeepsOriginals = map[string]bool{
+	operationTypeCopy:        true,
+	operationTypeSplit:       true,
+	operationTypeFlatten:     true,
+	operationTypeMoveReplies: true,
+	operationTypeDetach:      true,
+}
+
+// postAuditNotice posts a notice about an audited operation to the audit
+// channel, if one is configured. Operations are reported no matter whether
+// they were run silently, since silence is only meant for end users. Failing
+// to post a notice is logged, but leaves the operation itself unaffected.
+func (p *Plugin) postAuditNotice(entry *auditEntry) {
+	auditChannelID := p.getConfiguration().AuditChannelID
+	if len(auditChannelID) == 0 {
+		return
+	}
+
+	_, appErr := p.API.CreatePost(&model.Post{
+		UserId:    p.BotUserID,
+		ChannelId: auditChannelID,
+		Message:   p.buildAuditNotice(entry),
+	})
+	if appErr != nil {
+		p.API.LogWarn("Unable to post Wrangler audit notice",
+			"error", appErr.Error(),
+			"operation_id", entry.OperationID,
+			"audit_channel_id", auditChannelID,
+		)
+	}
+}
+
+// buildAuditNotice returns the message describing an audited operation: who
+// ran it, what was wrangled, from where to where and how it ended.
+func (p *Plugin) buildAuditNotice(entry *auditEntry) string {
+	siteURL := ""
+	if config := p.API.GetConfig(); config != nil && config.ServiceSettings.SiteURL != nil {
+		siteURL = *config.ServiceSettings.SiteURL
+	}
+	teamNames := make(map[string]string)
+
+	executor := inlineCode(entry.UserID)
+	if user, appErr := p.API.GetUser(entry.UserID); appErr == nil {
+		executor = "@" + user.Username
+	}
+
+	action := strings.Replace(entry.Type, "_", " ", -1)
+	verb := auditNoticeVerbs[entry.Type]
+	if len(verb) == 0 {
+		verb = action
+	}
+
+	msg := fmt.Sprintf("#### Wrangler %s %s\n", action, strings.Replace(entry.Outcome, "_", " ", -1))
+	if entry.Outcome == auditOutcomeSucceeded {
+		msg += fmt.Sprintf("%s %s %d message(s) and %d file(s) in %s.\n", executor, verb, entry.PostCount, entry.FileCount, time.Duration(entry.DurationMillis)*time.Millisecond)
+	} else {
+		msg += fmt.Sprintf("%s tried to %s %d message(s) and %d file(s), but the operation did not finish.\n", executor, action, entry.PostCount, entry.FileCount)
+	}
+
+	// The original threads can only be linked to if they still exist, which
+	// is the case for operations that leave their root message in place and
+	// operations that didn't succeed.
+	linkOriginals := auditNoticeKeepsOriginals[entry.Type] || entry.Outcome != auditOutcomeSucceeded
+	sourceTeamID := ""
+	if len(entry.SourceTeamIDs) != 0 {
+		sourceTeamID = entry.SourceTeamIDs[0]
+	}
+	var sources []string
+	for _, channelID := range entry.SourceChannelIDs {
+		sources = append(sources, p.formatAuditNoticeChannel(siteURL, channelID, teamNames))
+	}
+	var originalThreads []string
+	for _, rootID := range entry.OriginalRootIDs {
+		if linkOriginals {
+			originalThreads = append(originalThreads, p.formatAuditNoticePost(siteURL, rootID, sourceTeamID, entry.TargetTeamID, teamNames))
+		} else {
+			originalThreads = append(originalThreads, inlineCode(rootID))
+		}
+	}
+	msg += fmt.Sprintf("- **From:** %s (thread %s)\n", strings.Join(sources, ", "), strings.Join(originalThreads, ", "))
+
+	msg += fmt.Sprintf("- **To:** %s", p.formatAuditNoticeChannel(siteURL, entry.TargetChannelID, teamNames))
+	if len(entry.NewRootID) != 0 && entry.Outcome == auditOutcomeSucceeded {
+		msg += fmt.Sprintf(" (thread %s)", p.formatAuditNoticePost(siteURL, entry.NewRootID, entry.TargetTeamID, sourceTeamID, teamNames))
+	}
+	msg += "\n"
+
+	if len(entry.Flags) != 0 {
+		msg += fmt.Sprintf("- **Flags:** %s\n", inlineCodeList(entry.Flags))
+	}
+	if len(entry.Error) != 0 {
+		msg += fmt.Sprintf("- **Error:** %s\n", entry.Error)
+	}
+	msg += fmt.Sprintf("- **Operation:** %s\n", inlineCode(entry.OperationID))
+
+	return msg
+}
+
+// formatAuditNoticeChannel returns a link to a channel, or its ID if the
+// channel can't be linked to, such as direct and group message channels.
+func (p *Plugin) formatAuditNoticeChannel(siteURL, channelID string, teamNames map[string]string) string {
+	channel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		return fmt.Sprintf("channel %s", inlineCode(channelID))
+	}
+
+	teamName, err := p.getAuditNoticeTeamName(channel.TeamId, teamNames)
+	if err != nil {
+		return fmt.Sprintf("%s (%s)", channel.DisplayName, inlineCode(channelID))
+	}
+
+	return fmt.Sprintf("[%s](%s/%s/channels/%s)", channel.DisplayName, siteURL, teamName, channel.Name)
+}
+
+// formatAuditNoticePost returns a permalink to a post using the first team
+// that can be found. Posts in direct and group message channels can be linked
+// to through any team.
+func (p *Plugin) formatAuditNoticePost(siteURL, postID, teamID, fallbackTeamID string, teamNames map[string]string) string {
+	for _, id := range []string{teamID, fallbackTeamID} {
+		teamName, err := p.getAuditNoticeTeamName(id, teamNames)
+		if err == nil {
+			return fmt.Sprintf("[%s](%s)", postID, makePostLink(siteURL, teamName, postID))
+		}
+	}
+
+	return inlineCode(postID)
+}
+
+// getAuditNoticeTeamName returns the name of a team. Names are looked up once
+// and cached in the given map.
+func (p *Plugin) getAuditNoticeTeamName(teamID string, teamNames map[string]string) (string, error) {
+	if len(teamID) == 0 {
+		return "", errors.New("no team")
+	}
+	if teamName, ok := teamNames[teamID]; ok {
+		return teamName, nil
+	}
+
+	team, appErr := p.API.GetTeam(teamID)
+	if appErr != nil {
+		return "", errors.Wrapf(appErr, "unable to get team with ID %s", teamID)
+	}
+	teamNames[teamID] = team.Name
+
+	return team.Name, nil
+}
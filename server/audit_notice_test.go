@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostAuditNotice(t *testing.T) {
+	team := &model.Team{Id: model.NewId(), Name: "team-1"}
+	sourceChannel := &model.Channel{Id: model.NewId(), TeamId: team.Id, Name: "source", DisplayName: "Source"}
+	targetChannel := &model.Channel{Id: model.NewId(), TeamId: team.Id, Name: "target", DisplayName: "Target"}
+	directChannel := &model.Channel{Id: model.NewId(), Type: model.CHANNEL_DIRECT, DisplayName: "Direct"}
+	user := &model.User{Id: model.NewId(), Username: "user1"}
+	auditChannelID := model.NewId()
+
+	posts := newMockPostStore()
+	api := &plugintest.API{}
+	kv := newMockKVStore(api)
+	api.On("GetUser", user.Id).Return(user, nil)
+	api.On("GetChannel", sourceChannel.Id).Return(sourceChannel, nil)
+	api.On("GetChannel", targetChannel.Id).Return(targetChannel, nil)
+	api.On("GetChannel", directChannel.Id).Return(directChannel, nil)
+	api.On("GetTeam", team.Id).Return(team, nil)
+	api.On("GetTeam", "").Return(nil, &model.AppError{Message: "not found"})
+	api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: NewString("http://example.com")}})
+	api.On("CreatePost", mock.Anything).Return(posts.createPost, nil)
+
+	var plugin Plugin
+	plugin.SetAPI(api)
+	plugin.BotUserID = model.NewId()
+
+	rootPost := &model.Post{Id: model.NewId(), FileIds: []string{"file1"}}
+	record := func(opType string, source *model.Channel, outcome string, err error) *model.Post {
+		posts.created = nil
+		op := newOperation(opType, user.Id)
+		op.startAudit([]*model.Channel{source}, targetChannel, []*model.Post{rootPost, {Id: model.NewId(), RootId: rootPost.Id}}, "new_root_id", []string{"--silent=true"})
+		plugin.recordAudit(op, outcome, err)
+
+		require.Len(t, posts.created, 1)
+		notice := posts.created[0]
+		assert.Equal(t, auditChannelID, notice.ChannelId)
+		assert.Equal(t, plugin.BotUserID, notice.UserId)
+		return notice
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		posts.created = nil
+
+		op := newOperation(operationTypeMove, user.Id)
+		op.startAudit([]*model.Channel{sourceChannel}, targetChannel, []*model.Post{rootPost}, "", nil)
+		plugin.recordAudit(op, auditOutcomeSucceeded, nil)
+
+		assert.NotNil(t, kv.data[auditKey(time.Now(), op.ID)])
+		assert.Empty(t, posts.created)
+	})
+
+	plugin.setConfiguration(&configuration{AuditChannelID: auditChannelID})
+
+	t.Run("move", func(t *testing.T) {
+		notice := record(operationTypeMove, sourceChannel, auditOutcomeSucceeded, nil)
+		assert.Contains(t, notice.Message, "#### Wrangler move succeeded\n@user1 moved 2 message(s) and 1 file(s) in ")
+		assert.Contains(t, notice.Message, "- **From:** [Source](http://example.com/team-1/channels/source) (thread "+inlineCode(rootPost.Id)+")\n")
+		assert.Contains(t, notice.Message, "- **To:** [Target](http://example.com/team-1/channels/target) (thread [new_root_id](http://example.com/team-1/pl/new_root_id))\n")
+		assert.Contains(t, notice.Message, "- **Flags:** `--silent=true`\n")
+		assert.NotContains(t, notice.Message, "**Error:**")
+	})
+
+	t.Run("copy from a direct message channel", func(t *testing.T) {
+		notice := record(operationTypeCopy, directChannel, auditOutcomeSucceeded, nil)
+		assert.Contains(t, notice.Message, "@user1 copied 2 message(s)")
+		assert.Contains(t, notice.Message, "- **From:** Direct ("+inlineCode(directChannel.Id)+") (thread ["+rootPost.Id+"](http://example.com/team-1/pl/"+rootPost.Id+"))\n")
+	})
+
+	t.Run("rolled back", func(t *testing.T) {
+		notice := record(operationTypeMerge, sourceChannel, auditOutcomeRolledBack, errors.New("unable to create post"))
+		assert.Contains(t, notice.Message, "#### Wrangler merge rolled back\n@user1 tried to merge 2 message(s) and 1 file(s), but the operation did not finish.\n")
+		assert.Contains(t, notice.Message, "(thread ["+rootPost.Id+"](http://example.com/team-1/pl/"+rootPost.Id+"))\n")
+		assert.Contains(t, notice.Message, "- **To:** [Target](http://example.com/team-1/channels/target)\n")
+		assert.Contains(t, notice.Message, "- **Error:** unable to create post\n")
+	})
+
+	t.Run("move replies", func(t *testing.T) {
+		notice := record(operationTypeMoveReplies, sourceChannel, auditOutcomeSucceeded, nil)
+		assert.Contains(t, notice.Message, "#### Wrangler move replies succeeded\n@user1 moved 2 message(s) and 1 file(s) in ")
+		assert.Contains(t, notice.Message, "- **From:** [Source](http://example.com/team-1/channels/source) (thread ["+rootPost.Id+"](http://example.com/team-1/pl/"+rootPost.Id+"))\n")
+	})
+
+	t.Run("split failed", func(t *testing.T) {
+		notice := record(operationTypeSplit, sourceChannel, auditOutcomeFailed, errors.New("unable to delete post"))
+		assert.Contains(t, notice.Message, "#### Wrangler split failed\n@user1 tried to split 2 message(s) and 1 file(s), but the operation did not finish.\n")
+	})
+
+	t.Run("failing to post is logged", func(t *testing.T) {
+		api.On("CreatePost").Unset()
+		api.On("CreatePost", mock.Anything).Return(nil, &model.AppError{Message: "channel not found"})
+		api.On("LogWarn",
+			mock.AnythingOfTypeArgument("string"),
+			mock.AnythingOfTypeArgument("string"),
+			mock.AnythingOfTypeArgument("string"),
+			mock.AnythingOfTypeArgument("string"),
+			mock.AnythingOfTypeArgument("string"),
+			mock.AnythingOfTypeArgument("string"),
+			mock.AnythingOfTypeArgument("string"),
+		).Return(nil)
+
+		op := newOperation(operationTypeAttach, user.Id)
+		op.startAudit([]*model.Channel{sourceChannel}, targetChannel, []*model.Post{rootPost}, "", nil)
+		plugin.recordAudit(op, auditOutcomeSucceeded, nil)
+
+		api.AssertCalled(t, "LogWarn", "Unable to post Wrangler audit notice", "error", mock.Anything, "operation_id", op.ID, "audit_channel_id", auditChannelID)
+	})
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartAudit(t *testing.T) {
+	sourceChannel := &model.Channel{Id: model.NewId(), TeamId: model.NewId()}
+	directChannel := &model.Channel{Id: model.NewId()}
+	targetChannel := &model.Channel{Id: model.NewId(), TeamId: model.NewId()}
+
+	rootID := model.NewId()
+	posts := []*model.Post{
+		{Id: rootID, ChannelId: sourceChannel.Id, FileIds: []string{"file1", "file2"}},
+		{Id: model.NewId(), RootId: rootID, ChannelId: sourceChannel.Id, FileIds: []string{"file3"}},
+		{Id: model.NewId(), ChannelId: directChannel.Id},
+	}
+
+	op := newOperation(operationTypeMerge, model.NewId())
+	op.startAudit([]*model.Channel{sourceChannel, sourceChannel, directChannel}, targetChannel, posts, "", []string{"--mode=append"})
+	op.setAuditNewRootID("new_root")
+
+	require.NotNil(t, op.Audit)
+	assert.Equal(t, op.ID, op.Audit.OperationID)
+	assert.Equal(t, operationTypeMerge, op.Audit.Type)
+	assert.Equal(t, op.UserID, op.Audit.UserID)
+	assert.Equal(t, []string{sourceChannel.Id, directChannel.Id}, op.Audit.SourceChannelIDs)
+	assert.Equal(t, []string{sourceChannel.TeamId}, op.Audit.SourceTeamIDs)
+	assert.Equal(t, targetChannel.Id, op.Audit.TargetChannelID)
+	assert.Equal(t, targetChannel.TeamId, op.Audit.TargetTeamID)
+	assert.Equal(t, []string{rootID, posts[2].Id}, op.Audit.OriginalRootIDs)
+	assert.Equal(t, "new_root", op.Audit.NewRootID)
+	assert.Equal(t, 3, op.Audit.PostCount)
+	assert.Equal(t, 3, op.Audit.FileCount)
+	assert.Equal(t, []string{"--mode=append"}, op.Audit.Flags)
+
+	t.Run("stored with the operation", func(t *testing.T) {
+		data, err := json.Marshal(op)
+		require.NoError(t, err)
+
+		var stored operation
+		require.NoError(t, json.Unmarshal(data, &stored))
+		assert.Equal(t, op.Audit, stored.Audit)
+	})
+}
+
+func TestRecordAudit(t *testing.T) {
+	api := &plugintest.API{}
+	kv := newMockKVStore(api)
+
+	var plugin Plugin
+	plugin.SetAPI(api)
+
+	channel := &model.Channel{Id: model.NewId()}
+	otherChannel := &model.Channel{Id: model.NewId()}
+	userID := model.NewId()
+
+	record := func(opType string, target *model.Channel, outcome string, err error) *operation {
+		op := newOperation(opType, userID)
+		op.startAudit([]*model.Channel{channel}, target, []*model.Post{{Id: model.NewId()}}, "", nil)
+		plugin.recordAudit(op, outcome, err)
+		return op
+	}
+
+	moved := record(operationTypeMove, otherChannel, auditOutcomeSucceeded, nil)
+	copied := record(operationTypeCopy, channel, auditOutcomeRolledBack, errJobCanceled)
+	attached := record(operationTypeAttach, channel, auditOutcomeSucceeded, nil)
+
+	// Operations without an audit entry are not recorded.
+	plugin.recordAudit(newOperation(operationTypeSplit, userID), auditOutcomeSucceeded, nil)
+
+	assert.ElementsMatch(t, []string{
+		auditKey(time.Now(), moved.ID),
+		auditKey(time.Now(), copied.ID),
+		auditKey(time.Now(), attached.ID),
+		auditDayKey(time.Now().UTC().Format(auditDayFormat)),
+		auditDaysKey,
+	}, kv.keys())
+
+	t.Run("all entries", func(t *testing.T) {
+		entries, err := plugin.getAuditEntries(auditFilter{})
+		require.NoError(t, err)
+		require.Len(t, entries, 3)
+
+		byID := make(map[string]*auditEntry)
+		for _, entry := range entries {
+			byID[entry.OperationID] = entry
+		}
+		assert.Equal(t, auditOutcomeSucceeded, byID[moved.ID].Outcome)
+		assert.Equal(t, auditOutcomeRolledBack, byID[copied.ID].Outcome)
+		assert.Equal(t, errJobCanceled.Error(), byID[copied.ID].Error)
+		assert.NotZero(t, byID[attached.ID].EndAt)
+	})
+
+	t.Run("filtered by type", func(t *testing.T) {
+		entries, err := plugin.getAuditEntries(auditFilter{operationType: operationTypeCopy})
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, copied.ID, entries[0].OperationID)
+	})
+
+	t.Run("filtered by channel", func(t *testing.T) {
+		entries, err := plugin.getAuditEntries(auditFilter{channelID: otherChannel.Id})
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, moved.ID, entries[0].OperationID)
+
+		entries, err = plugin.getAuditEntries(auditFilter{channelID: channel.Id})
+		require.NoError(t, err)
+		assert.Len(t, entries, 3)
+	})
+
+	t.Run("filtered by user", func(t *testing.T) {
+		entries, err := plugin.getAuditEntries(auditFilter{userID: model.NewId()})
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("filtered by time", func(t *testing.T) {
+		entries, err := plugin.getAuditEntries(auditFilter{since: model.GetMillisForTime(time.Now().Add(time.Hour))})
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+
+		entries, err = plugin.getAuditEntries(auditFilter{since: model.GetMillisForTime(time.Now().Add(-time.Hour))})
+		require.NoError(t, err)
+		assert.Len(t, entries, 3)
+	})
+
+	t.Run("recorded again", func(t *testing.T) {
+		plugin.recordAudit(moved, auditOutcomeFailed, nil)
+
+		entries, err := plugin.getAuditEntries(auditFilter{operationType: operationTypeMove})
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, auditOutcomeFailed, entries[0].Outcome)
+	})
+}
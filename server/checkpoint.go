@@ -0,0 +1,561 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	checkpointKeyPrefix = "checkpoint_"
+
+	// checkpointIndexKey stores the IDs of every operation with a checkpoint,
+	// so that interrupted operations can be found without listing every key.
+	checkpointIndexKey = "checkpoints"
+
+	// checkpointChunkSize is the number of created posts stored per KV entry
+	// so that checkpointing a post doesn't rewrite every post recorded
+	// before it.
+	checkpointChunkSize = 50
+
+	// checkpointPostInterval is how many posts an operation records between
+	// checkpoints, so that not every created post costs a KV write. Changes
+	// to the operation state, such as re-uploaded files, are still
+	// checkpointed right away.
+	checkpointPostInterval = 10
+
+	// checkpointStaleAfter is how long a checkpoint must go without updates
+	// before it can be resumed, so that operations which are still running
+	// are left alone.
+	checkpointStaleAfter = 10 * time.Minute
+
+	// resumeInterval is how often interrupted operations are looked for
+	// while the plugin is active.
+	resumeInterval = 5 * time.Minute
+
+	// resumeLockKey is the lock that lets only one server in a cluster resume
+	// interrupted operations at a time.
+	resumeLockKey = "resume_lock"
+)
+
+// operationCheckpoint is the stored progress of a running operation. It is
+// kept until the operation finishes or is rolled back, so that an operation
+// interrupted by a plugin restart can be resumed. The posts created by the
+// operation are stored separately in chunks.
+type operationCheckpoint struct {
+	Operation      *operation `json:"operation"`
+	JobID          string     `json:"job_id,omitempty"`
+	PendingFileIDs []string   `json:"pending_file_ids,omitempty"`
+	// DeletePostIDs are the original posts that are deleted once every post
+	// has been created. Once they are set the operation can no longer be
+	// rolled back and is finished instead.
+	DeletePostIDs []string `json:"delete_post_ids,omitempty"`
+	// Quarantined is set once the original threads of a soft move or merge
+	// have been quarantined.
+	Quarantined bool `json:"quarantined,omitempty"`
+	// Error is set when the operation stopped without finishing or being
+	// fully rolled back.
+	Error string `json:"error,omitempty"`
+	// LockKeys are the thread locks held by the operation. An operation isn't
+	// resumed automatically while any of them is still held.
+	LockKeys []string `json:"lock_keys,omitempty"`
+	UpdateAt int64    `json:"update_at"`
+}
+
+type checkpointChunk struct {
+	Posts    []operationPost `json:"posts"`
+	UpdateAt int64           `json:"update_at"`
+}
+
+// resumable returns whether the checkpointed operation can be resumed
+// manually.
+func (cp *operationCheckpoint) resumable(now time.Time) bool {
+	if len(cp.Error) != 0 {
+		return true
+	}
+
+	return cp.stale(now)
+}
+
+// stale returns whether the checkpoint has gone without updates for long
+// enough that the operation can't still be running.
+func (cp *operationCheckpoint) stale(now time.Time) bool {
+	return now.Sub(time.Unix(0, cp.UpdateAt*int64(time.Millisecond))) >= checkpointStaleAfter
+}
+
+// startOperation returns a new operation that checkpoints its progress while
+// it runs.
+func (p *Plugin) startOperation(operationType, userID string) *operation {
+	op := newOperation(operationType, userID)
+	op.store = p
+
+	return op
+}
+
+// checkpoint stores the progress of the operation if it was started with
+// startOperation. The checkpoint state is only rewritten when it changed,
+// otherwise only the chunks holding posts recorded since the last checkpoint
+// are written. Failing to
+// checkpoint only prevents the operation from being resumed, so it is logged
+// and otherwise ignored.
+func (o *operation) checkpoint(stateChanged bool) {
+	if o == nil || o.store == nil {
+		return
+	}
+
+	err := o.store.saveCheckpoint(o, stateChanged || !o.checkpointed)
+	if err != nil {
+		o.store.API.LogWarn("Unable to checkpoint Wrangler operation",
+			"error", err.Error(),
+			"operation_id", o.ID,
+		)
+		return
+	}
+	o.checkpointed = true
+}
+
+// beginDeletes records the original posts that are about to be deleted. From
+// this point on, an interrupted operation is finished instead of rolled back.
+func (o *operation) beginDeletes(postIDs ...string) {
+	if o == nil {
+		return
+	}
+
+	o.deletePostIDs = postIDs
+	o.checkpoint(true)
+}
+
+// finishOperation journals a completed operation, if its type can be undone,
+// records it in the audit log and removes its checkpoint.
+func (p *Plugin) finishOperation(op *operation) {
+	op.finished = true
+	if op.journaled() {
+		p.journalOperation(op)
+	}
+	p.recordAudit(op, auditOutcomeSucceeded, nil)
+	p.deleteCheckpoint(op)
+}
+
+func checkpointKey(operationID string) string {
+	return checkpointKeyPrefix + operationID
+}
+
+func checkpointChunkKey(operationID string, chunk int) string {
+	return fmt.Sprintf("%s%s_%d", checkpointKeyPrefix, operationID, chunk)
+}
+
+func (p *Plugin) saveCheckpoint(op *operation, saveState bool) error {
+	now := model.GetMillis()
+
+	// The operation is indexed before its first checkpoint is written so that
+	// no checkpoint can go unnoticed.
+	if !op.checkpointed {
+		err := p.addToKVList(checkpointIndexKey, op.ID)
+		if err != nil {
+			return errors.Wrap(err, "unable to index checkpoint")
+		}
+	}
+
+	if saveState {
+		stored := *op
+		stored.Posts = nil
+		cp := operationCheckpoint{
+			Operation:      &stored,
+			PendingFileIDs: op.pendingFileIDs,
+			DeletePostIDs:  op.deletePostIDs,
+			Quarantined:    op.quarantined,
+			Error:          op.checkpointError,
+			UpdateAt:       now,
+		}
+		if op.job != nil {
+			cp.JobID = op.job.snapshot().ID
+		}
+		if op.lock != nil {
+			cp.LockKeys = op.lock.keys
+		}
+
+		data, err := json.Marshal(cp)
+		if err != nil {
+			return errors.Wrap(err, "unable to marshal checkpoint")
+		}
+		appErr := p.API.KVSet(checkpointKey(op.ID), data)
+		if appErr != nil {
+			return errors.Wrap(appErr, "unable to save checkpoint")
+		}
+	}
+
+	if len(op.Posts) == 0 {
+		return nil
+	}
+
+	// Only the chunks holding posts recorded since the last checkpoint are
+	// written.
+	firstChunk := op.checkpointedPosts / checkpointChunkSize
+	lastChunk := (len(op.Posts) - 1) / checkpointChunkSize
+	for chunk := firstChunk; chunk <= lastChunk; chunk++ {
+		end := (chunk + 1) * checkpointChunkSize
+		if end > len(op.Posts) {
+			end = len(op.Posts)
+		}
+		data, err := json.Marshal(checkpointChunk{
+			Posts:    op.Posts[chunk*checkpointChunkSize : end],
+			UpdateAt: now,
+		})
+		if err != nil {
+			return errors.Wrap(err, "unable to marshal checkpoint chunk")
+		}
+		appErr := p.API.KVSet(checkpointChunkKey(op.ID, chunk), data)
+		if appErr != nil {
+			return errors.Wrap(appErr, "unable to save checkpoint chunk")
+		}
+	}
+	op.checkpointedPosts = len(op.Posts)
+
+	return nil
+}
+
+// getCheckpoint returns the checkpoint of the operation with the given ID,
+// along with every post the operation created, or nil if there is none.
+func (p *Plugin) getCheckpoint(operationID string) (*operationCheckpoint, error) {
+	data, appErr := p.API.KVGet(checkpointKey(operationID))
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "unable to get checkpoint")
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	var cp operationCheckpoint
+	err := json.Unmarshal(data, &cp)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to unmarshal checkpoint")
+	}
+	if cp.Operation == nil {
+		return nil, errors.New("checkpoint contains no operation")
+	}
+
+	for chunk := 0; ; chunk++ {
+		data, appErr = p.API.KVGet(checkpointChunkKey(operationID, chunk))
+		if appErr != nil {
+			return nil, errors.Wrap(appErr, "unable to get checkpoint chunk")
+		}
+		if data == nil {
+			break
+		}
+
+		var c checkpointChunk
+		err = json.Unmarshal(data, &c)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to unmarshal checkpoint chunk")
+		}
+		cp.Operation.Posts = append(cp.Operation.Posts, c.Posts...)
+		if c.UpdateAt > cp.UpdateAt {
+			cp.UpdateAt = c.UpdateAt
+		}
+	}
+
+	return &cp, nil
+}
+
+// getCheckpointOperationIDs returns the IDs of every operation that has a
+// checkpoint.
+func (p *Plugin) getCheckpointOperationIDs() ([]string, error) {
+	return p.getKVList(checkpointIndexKey)
+}
+
+// deleteCheckpoint removes the checkpoint of an operation. Failures are
+// logged, but leave the operation itself unaffected.
+func (p *Plugin) deleteCheckpoint(op *operation) {
+	if !op.checkpointed {
+		return
+	}
+
+	keys := []string{checkpointKey(op.ID)}
+	for chunk := 0; chunk*checkpointChunkSize < len(op.Posts); chunk++ {
+		keys = append(keys, checkpointChunkKey(op.ID, chunk))
+	}
+
+	for _, key := range keys {
+		appErr := p.API.KVDelete(key)
+		if appErr != nil {
+			p.API.LogWarn("Unable to delete Wrangler operation checkpoint",
+				"error", appErr.Error(),
+				"key", key,
+			)
+		}
+	}
+
+	err := p.removeFromKVList(checkpointIndexKey, op.ID)
+	if err != nil {
+		p.API.LogWarn("Unable to remove Wrangler operation checkpoint from the index",
+			"error", err.Error(),
+			"operation_id", op.ID,
+		)
+	}
+	op.checkpointed = false
+}
+
+// runOperationResume resumes interrupted operations when the plugin activates
+// and then periodically until stop is closed.
+func (p *Plugin) runOperationResume(stop <-chan struct{}) {
+	ticker := time.NewTicker(resumeInterval)
+	defer ticker.Stop()
+
+	for {
+		p.resumeOperations(time.Now())
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// resumeOperations resumes the checkpointed operations that were interrupted.
+// A checkpoint may belong to an operation that another server in the cluster
+// is still running, so only checkpoints that have gone stale and whose thread
+// locks have been released are resumed. Checkpoints with an error are left
+// for a manual resume. Only one server resumes operations at a time.
+func (p *Plugin) resumeOperations(now time.Time) {
+	value, err := newLockValue("", "resume")
+	if err != nil {
+		p.API.LogError("Unable to lock resuming interrupted Wrangler operations", "error", err.Error())
+		return
+	}
+	resumeLock, heldKey, err := p.acquireLocks([]string{resumeLockKey}, value)
+	if err != nil {
+		p.API.LogError("Unable to lock resuming interrupted Wrangler operations", "error", err.Error())
+		return
+	}
+	if len(heldKey) != 0 {
+		// Another server is resuming operations.
+		return
+	}
+	go resumeLock.refresh()
+	defer resumeLock.release()
+
+	operationIDs, err := p.getCheckpointOperationIDs()
+	if err != nil {
+		p.API.LogError("Unable to look up interrupted Wrangler operations", "error", err.Error())
+		return
+	}
+
+	for _, operationID := range operationIDs {
+		cp, err := p.getCheckpoint(operationID)
+		if err != nil {
+			p.API.LogError("Unable to get Wrangler operation checkpoint",
+				"error", err.Error(),
+				"operation_id", operationID,
+			)
+			continue
+		}
+		if cp == nil || len(cp.Error) != 0 || !cp.stale(now) {
+			continue
+		}
+
+		// Holding the operation's thread locks keeps new operations away from
+		// the threads while it is resumed.
+		value, err := newLockValue(cp.Operation.UserID, cp.Operation.Type)
+		if err != nil {
+			p.API.LogError("Unable to lock interrupted Wrangler operation",
+				"error", err.Error(),
+				"operation_id", operationID,
+			)
+			continue
+		}
+		lock, heldKey, err := p.acquireLocks(cp.LockKeys, value)
+		if err != nil {
+			p.API.LogError("Unable to lock interrupted Wrangler operation",
+				"error", err.Error(),
+				"operation_id", operationID,
+			)
+			continue
+		}
+		if len(heldKey) != 0 {
+			continue
+		}
+
+		_, err = p.resumeOperation(cp)
+		lock.release()
+		if err != nil {
+			p.API.LogError("Unable to resume interrupted Wrangler operation",
+				"error", err.Error(),
+				"operation_id", operationID,
+			)
+		}
+	}
+}
+
+// resumeOperation resumes an interrupted operation. Operations that were still
+// creating posts are rolled back, while operations that had started deleting
+// the original posts are finished. The user who ran the operation is told
+// about the outcome, and whether it was rolled back or finished is returned.
+func (p *Plugin) resumeOperation(cp *operationCheckpoint) (string, error) {
+	op := cp.Operation
+	op.store = p
+	op.checkpointed = true
+	op.pendingFileIDs = cp.PendingFileIDs
+	op.deletePostIDs = cp.DeletePostIDs
+	op.quarantined = cp.Quarantined
+
+	p.API.LogInfo("Wrangler is resuming an interrupted operation",
+		"operation_id", op.ID,
+		"operation_type", op.Type,
+	)
+
+	var msg string
+	var err error
+	if len(op.deletePostIDs) == 0 {
+		msg, err = p.resumeRollback(op)
+	} else {
+		msg, err = p.resumeFinish(op)
+	}
+	if err != nil {
+		op.checkpointError = err.Error()
+		op.checkpoint(true)
+		return "", err
+	}
+
+	p.API.LogInfo("Wrangler resumed an interrupted operation",
+		"operation_id", op.ID,
+		"operation_type", op.Type,
+	)
+
+	dmErr := p.PostBotDM(op.UserID, msg)
+	if dmErr != nil {
+		p.API.LogError("Unable to send resumed operation DM to user",
+			"error", dmErr.Error(),
+			"user_id", op.UserID,
+		)
+	}
+	if len(cp.JobID) != 0 {
+		status := jobStatusSucceeded
+		if len(op.deletePostIDs) == 0 {
+			status = jobStatusFailed
+		}
+		p.finishInterruptedJob(cp.JobID, status, msg)
+	}
+
+	if len(op.deletePostIDs) == 0 {
+		return "rolled back", nil
+	}
+
+	return "finished", nil
+}
+
+// resumeRollback removes every post created by an interrupted operation.
+// Posts that were already removed are skipped.
+func (p *Plugin) resumeRollback(op *operation) (string, error) {
+	var failedPostIDs []string
+	for i := len(op.Posts) - 1; i >= 0; i-- {
+		_, err := p.deletePostIfExists(op.Posts[i].NewID)
+		if err != nil {
+			failedPostIDs = append(failedPostIDs, op.Posts[i].NewID)
+		}
+	}
+	if len(failedPostIDs) != 0 {
+		return "", errors.Errorf("unable to remove %d created post(s): %s", len(failedPostIDs), strings.Join(failedPostIDs, ", "))
+	}
+
+	msg := fmt.Sprintf("Wrangler was interrupted while running your %s operation %s. It has been rolled back; %d created message(s) were removed and the original messages are unchanged.", op.Type, inlineCode(op.ID), len(op.Posts))
+	if len(op.pendingFileIDs) != 0 {
+		p.API.LogWarn("Wrangler was unable to remove re-uploaded files",
+			"operation_id", op.ID,
+			"file_ids", strings.Join(op.pendingFileIDs, ","),
+		)
+		msg += fmt.Sprintf(" %d re-uploaded file(s) that were never attached to a message could not be removed.", len(op.pendingFileIDs))
+	}
+	p.recordAudit(op, auditOutcomeRolledBack, errors.New("the operation was interrupted"))
+	p.deleteCheckpoint(op)
+
+	return msg, nil
+}
+
+// resumeFinish deletes the remaining original posts of an interrupted
+// operation and completes it.
+func (p *Plugin) resumeFinish(op *operation) (string, error) {
+	// The original threads of a soft move or merge are kept in the
+	// quarantine channel, so they are quarantined first if the operation was
+	// interrupted before it got to do so.
+	quarantine, err := p.quarantineRemainingThreads(op)
+	if err != nil {
+		return "", err
+	}
+
+	for _, postID := range op.deletePostIDs {
+		_, err := p.deletePostIfExists(postID)
+		if err != nil {
+			return "", err
+		}
+	}
+	if len(op.UndoneOperationID) != 0 {
+		undoneOp, err := p.getOperation(op.UndoneOperationID)
+		if err != nil {
+			return "", err
+		}
+		if undoneOp != nil {
+			undoneOp.Undone = true
+			err = p.saveOperation(undoneOp)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+	p.finishOperation(op)
+
+	msg := fmt.Sprintf("Wrangler was interrupted while running your %s operation %s. It has now been finished; the original messages were removed.%s", op.Type, inlineCode(op.ID), quarantine.summary())
+	if op.journaled() {
+		msg += fmt.Sprintf(" Run `/wrangler undo %s` to reverse it.", op.ID)
+	}
+
+	return msg, nil
+}
+
+// deletePostIfExists deletes a post unless it was already deleted and returns
+// whether it was deleted.
+func (p *Plugin) deletePostIfExists(postID string) (bool, error) {
+	post, appErr := p.API.GetPost(postID)
+	if appErr != nil {
+		if appErr.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, errors.Wrapf(appErr, "unable to get post with ID %s", postID)
+	}
+	if post.DeleteAt != 0 {
+		return false, nil
+	}
+
+	appErr = p.API.DeletePost(postID)
+	if appErr != nil {
+		return false, errors.Wrapf(appErr, "unable to delete post with ID %s", postID)
+	}
+
+	return true, nil
+}
+
+// finishInterruptedJob stores the outcome of a job whose operation was
+// resumed after an interruption.
+func (p *Plugin) finishInterruptedJob(jobID, status, result string) {
+	j, err := p.getJob(jobID)
+	if err != nil || j == nil {
+		return
+	}
+
+	j.Status = status
+	j.Result = result
+	j.UpdateAt = model.GetMillis()
+	err = p.saveJob(j)
+	if err != nil {
+		p.API.LogError("Unable to save background job",
+			"error", err.Error(),
+			"job_id", j.ID,
+		)
+	}
+	p.updateJobStatusPost(j)
+}
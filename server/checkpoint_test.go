@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// mockKVStore is an in-memory KV store backing the KV methods of a mock API.
+type mockKVStore struct {
+	lock sync.Mutex
+	data map[string][]byte
+}
+
+func newMockKVStore(api *plugintest.API) *mockKVStore {
+	kv := &mockKVStore{data: make(map[string][]byte)}
+
+	api.On("KVSet", mock.AnythingOfType("string"), mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		kv.lock.Lock()
+		defer kv.lock.Unlock()
+		kv.data[args.String(0)] = args.Get(1).([]byte)
+	})
+	api.On("KVGet", mock.AnythingOfType("string")).Return(func(key string) []byte {
+		kv.lock.Lock()
+		defer kv.lock.Unlock()
+		return kv.data[key]
+	}, nil)
+	api.On("KVDelete", mock.AnythingOfType("string")).Return(nil).Run(func(args mock.Arguments) {
+		kv.lock.Lock()
+		defer kv.lock.Unlock()
+		delete(kv.data, args.String(0))
+	})
+	api.On("KVSetWithOptions", mock.AnythingOfType("string"), mock.Anything, mock.AnythingOfType("model.PluginKVSetOptions")).Return(func(key string, value []byte, options model.PluginKVSetOptions) bool {
+		kv.lock.Lock()
+		defer kv.lock.Unlock()
+		if options.Atomic && !bytes.Equal(kv.data[key], options.OldValue) {
+			return false
+		}
+		if value == nil {
+			delete(kv.data, key)
+			return true
+		}
+		kv.data[key] = value
+		return true
+	}, nil)
+	api.On("KVCompareAndDelete", mock.AnythingOfType("string"), mock.Anything).Return(func(key string, oldValue []byte) bool {
+		kv.lock.Lock()
+		defer kv.lock.Unlock()
+		if !bytes.Equal(kv.data[key], oldValue) {
+			return false
+		}
+		delete(kv.data, key)
+		return true
+	}, nil)
+	api.On("KVList", mock.AnythingOfType("int"), mock.AnythingOfType("int")).Return(func(page, perPage int) []string {
+		keys := kv.keys()
+		start := page * perPage
+		if start > len(keys) {
+			return []string{}
+		}
+		end := start + perPage
+		if end > len(keys) {
+			end = len(keys)
+		}
+		return keys[start:end]
+	}, nil)
+
+	return kv
+}
+
+// keys returns every stored key in sorted order.
+func (kv *mockKVStore) keys() []string {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+
+	var keys []string
+	for key := range kv.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (kv *mockKVStore) checkpointKeys() []string {
+	var keys []string
+	for _, key := range kv.keys() {
+		if strings.HasPrefix(key, checkpointKeyPrefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+func TestCheckpoint(t *testing.T) {
+	api := &plugintest.API{}
+	kv := newMockKVStore(api)
+
+	var plugin Plugin
+	plugin.SetAPI(api)
+
+	op := plugin.startOperation(operationTypeMove, model.NewId())
+	var created []*model.Post
+	for i := 0; i < checkpointChunkSize+10; i++ {
+		newPost := mockGeneratePost()
+		created = append(created, newPost)
+		op.recordPost(mockGeneratePost(), newPost)
+	}
+	op.recordUploadedFiles([]string{"file1"})
+	op.beginDeletes("original1", "original2")
+
+	t.Run("stored in chunks", func(t *testing.T) {
+		assert.ElementsMatch(t, []string{
+			checkpointKey(op.ID),
+			checkpointChunkKey(op.ID, 0),
+			checkpointChunkKey(op.ID, 1),
+		}, kv.checkpointKeys())
+	})
+
+	t.Run("get checkpoint", func(t *testing.T) {
+		cp, err := plugin.getCheckpoint(op.ID)
+		require.NoError(t, err)
+		require.NotNil(t, cp)
+		assert.Equal(t, op.Type, cp.Operation.Type)
+		assert.Equal(t, op.UserID, cp.Operation.UserID)
+		require.Len(t, cp.Operation.Posts, len(created))
+		for i, post := range created {
+			assert.Equal(t, post.Id, cp.Operation.Posts[i].NewID)
+		}
+		assert.Equal(t, []string{"file1"}, cp.PendingFileIDs)
+		assert.Equal(t, []string{"original1", "original2"}, cp.DeletePostIDs)
+		assert.False(t, cp.resumable(time.Now()))
+		assert.True(t, cp.resumable(time.Now().Add(checkpointStaleAfter)))
+	})
+
+	t.Run("list checkpoints", func(t *testing.T) {
+		operationIDs, err := plugin.getCheckpointOperationIDs()
+		require.NoError(t, err)
+		assert.Equal(t, []string{op.ID}, operationIDs)
+	})
+
+	t.Run("missing checkpoint", func(t *testing.T) {
+		cp, err := plugin.getCheckpoint(model.NewId())
+		require.NoError(t, err)
+		assert.Nil(t, cp)
+	})
+
+	t.Run("removed when finished", func(t *testing.T) {
+		plugin.finishOperation(op)
+		assert.Empty(t, kv.checkpointKeys())
+		assert.NotContains(t, kv.keys(), checkpointIndexKey)
+
+		journaled, err := plugin.getOperation(op.ID)
+		require.NoError(t, err)
+		require.NotNil(t, journaled)
+		assert.Len(t, journaled.Posts, len(created))
+	})
+
+	t.Run("posts are checkpointed in batches", func(t *testing.T) {
+		batched := plugin.startOperation(operationTypeMove, model.NewId())
+		callCount := len(api.Calls)
+		for i := 0; i < 2*checkpointPostInterval+5; i++ {
+			batched.recordPost(mockGeneratePost(), mockGeneratePost())
+		}
+
+		var chunkWrites int
+		for _, call := range api.Calls[callCount:] {
+			if call.Method == "KVSet" && call.Arguments.String(0) == checkpointChunkKey(batched.ID, 0) {
+				chunkWrites++
+			}
+		}
+		assert.Equal(t, 3, chunkWrites)
+
+		cp, err := plugin.getCheckpoint(batched.ID)
+		require.NoError(t, err)
+		require.NotNil(t, cp)
+		assert.Len(t, cp.Operation.Posts, 2*checkpointPostInterval+1)
+
+		batched.beginDeletes("original1")
+		cp, err = plugin.getCheckpoint(batched.ID)
+		require.NoError(t, err)
+		assert.Len(t, cp.Operation.Posts, 2*checkpointPostInterval+5)
+
+		plugin.deleteCheckpoint(batched)
+	})
+
+	t.Run("operations without a store are not checkpointed", func(t *testing.T) {
+		unstored := newOperation(operationTypeMove, model.NewId())
+		unstored.recordPost(mockGeneratePost(), mockGeneratePost())
+		assert.Empty(t, kv.checkpointKeys())
+	})
+}
+
+func TestResumeOperation(t *testing.T) {
+	userID := model.NewId()
+	existingPost := &model.Post{Id: model.NewId()}
+	deletedPost := &model.Post{Id: model.NewId(), DeleteAt: 1}
+	missingPostID := model.NewId()
+	undeletablePost := &model.Post{Id: model.NewId()}
+
+	api := &plugintest.API{}
+	kv := newMockKVStore(api)
+	api.On("GetPost", existingPost.Id).Return(existingPost, nil)
+	api.On("GetPost", deletedPost.Id).Return(deletedPost, nil)
+	api.On("GetPost", missingPostID).Return(nil, &model.AppError{StatusCode: http.StatusNotFound})
+	api.On("GetPost", undeletablePost.Id).Return(undeletablePost, nil)
+	api.On("DeletePost", undeletablePost.Id).Return(&model.AppError{Message: "failed"})
+	api.On("DeletePost", mock.AnythingOfType("string")).Return(nil)
+	api.On("GetDirectChannel", userID, mock.AnythingOfType("string")).Return(&model.Channel{Id: model.NewId()}, nil)
+	api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(mockGeneratePost(), nil)
+	api.On("LogInfo",
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+	).Return(nil)
+
+	var plugin Plugin
+	plugin.SetAPI(api)
+
+	deletedPostIDs := func(callCount int) []string {
+		var deleted []string
+		for _, call := range api.Calls[callCount:] {
+			if call.Method == "DeletePost" {
+				deleted = append(deleted, call.Arguments.String(0))
+			}
+		}
+		return deleted
+	}
+
+	t.Run("rolled back", func(t *testing.T) {
+		op := plugin.startOperation(operationTypeCopy, userID)
+		op.recordPost(mockGeneratePost(), existingPost)
+		op.recordPost(mockGeneratePost(), deletedPost)
+		op.recordPost(mockGeneratePost(), &model.Post{Id: missingPostID})
+
+		cp, err := plugin.getCheckpoint(op.ID)
+		require.NoError(t, err)
+
+		callCount := len(api.Calls)
+		outcome, err := plugin.resumeOperation(cp)
+		require.NoError(t, err)
+		assert.Equal(t, "rolled back", outcome)
+		assert.Equal(t, []string{existingPost.Id}, deletedPostIDs(callCount))
+		assert.Empty(t, kv.checkpointKeys())
+
+		journaled, err := plugin.getOperation(op.ID)
+		require.NoError(t, err)
+		assert.Nil(t, journaled)
+	})
+
+	t.Run("finished", func(t *testing.T) {
+		op := plugin.startOperation(operationTypeMove, userID)
+		op.recordPost(mockGeneratePost(), mockGeneratePost())
+		op.beginDeletes(existingPost.Id)
+
+		cp, err := plugin.getCheckpoint(op.ID)
+		require.NoError(t, err)
+
+		callCount := len(api.Calls)
+		outcome, err := plugin.resumeOperation(cp)
+		require.NoError(t, err)
+		assert.Equal(t, "finished", outcome)
+		assert.Equal(t, []string{existingPost.Id}, deletedPostIDs(callCount))
+		assert.Empty(t, kv.checkpointKeys())
+
+		journaled, err := plugin.getOperation(op.ID)
+		require.NoError(t, err)
+		require.NotNil(t, journaled)
+		assert.Len(t, journaled.Posts, 1)
+	})
+
+	t.Run("finished undo", func(t *testing.T) {
+		undoneOp := newOperation(operationTypeMove, userID)
+		require.NoError(t, plugin.saveOperation(undoneOp))
+
+		op := plugin.startOperation(operationTypeUndo, userID)
+		op.UndoneOperationID = undoneOp.ID
+		op.beginDeletes(existingPost.Id)
+
+		cp, err := plugin.getCheckpoint(op.ID)
+		require.NoError(t, err)
+
+		outcome, err := plugin.resumeOperation(cp)
+		require.NoError(t, err)
+		assert.Equal(t, "finished", outcome)
+
+		undoneOp, err = plugin.getOperation(undoneOp.ID)
+		require.NoError(t, err)
+		assert.True(t, undoneOp.Undone)
+	})
+
+	t.Run("finished soft move", func(t *testing.T) {
+		quarantineChannel := &model.Channel{Id: model.NewId(), Name: "quarantine-channel"}
+		thread := model.NewPostList()
+		thread.AddPost(existingPost)
+		thread.AddOrder(existingPost.Id)
+		api.On("GetChannel", quarantineChannel.Id).Return(quarantineChannel, nil)
+		api.On("GetPostThread", existingPost.Id).Return(thread, nil)
+		api.On("GetReactions", mock.AnythingOfType("string")).Return(nil, nil)
+		api.On("UpdatePost", mock.AnythingOfType("*model.Post")).Return(func(post *model.Post) *model.Post { return post }, nil)
+
+		plugin.setConfiguration(&configuration{QuarantineChannelID: quarantineChannel.Id})
+		defer plugin.setConfiguration(&configuration{})
+
+		op := plugin.startOperation(operationTypeMove, userID)
+		op.recordPost(mockGeneratePost(), mockGeneratePost())
+		op.beginDeletes(existingPost.Id)
+
+		cp, err := plugin.getCheckpoint(op.ID)
+		require.NoError(t, err)
+		assert.False(t, cp.Quarantined)
+
+		callCount := len(api.Calls)
+		outcome, err := plugin.resumeOperation(cp)
+		require.NoError(t, err)
+		assert.Equal(t, "finished", outcome)
+		assert.Equal(t, []string{existingPost.Id}, deletedPostIDs(callCount))
+		assert.Empty(t, kv.checkpointKeys())
+
+		var quarantineKeys []string
+		for _, key := range kv.keys() {
+			if strings.HasPrefix(key, quarantineKeyPrefix) {
+				quarantineKeys = append(quarantineKeys, key)
+			}
+		}
+		assert.Len(t, quarantineKeys, 1)
+	})
+
+	t.Run("unable to resume", func(t *testing.T) {
+		op := plugin.startOperation(operationTypeCopy, userID)
+		op.recordPost(mockGeneratePost(), undeletablePost)
+
+		cp, err := plugin.getCheckpoint(op.ID)
+		require.NoError(t, err)
+
+		_, err = plugin.resumeOperation(cp)
+		require.Error(t, err)
+
+		cp, err = plugin.getCheckpoint(op.ID)
+		require.NoError(t, err)
+		require.NotNil(t, cp)
+		assert.Contains(t, cp.Error, undeletablePost.Id)
+		assert.True(t, cp.resumable(time.Now()))
+
+		plugin.deleteCheckpoint(op)
+	})
+
+	t.Run("resume automatically", func(t *testing.T) {
+		stale := time.Now().Add(checkpointStaleAfter + time.Minute)
+
+		t.Run("still running", func(t *testing.T) {
+			op := plugin.startOperation(operationTypeMerge, userID)
+			op.recordPost(mockGeneratePost(), existingPost)
+			defer plugin.deleteCheckpoint(op)
+
+			plugin.resumeOperations(time.Now())
+			assert.NotEmpty(t, kv.checkpointKeys())
+		})
+
+		t.Run("thread lock still held", func(t *testing.T) {
+			op := plugin.startOperation(operationTypeMerge, userID)
+			value, err := newLockValue(userID, op.Type)
+			require.NoError(t, err)
+			lock, heldKey, err := plugin.acquireLocks([]string{threadLockKey(existingPost.Id)}, value)
+			require.NoError(t, err)
+			require.Empty(t, heldKey)
+			op.lock = lock
+			op.recordPost(mockGeneratePost(), existingPost)
+			defer plugin.deleteCheckpoint(op)
+
+			plugin.resumeOperations(stale)
+			assert.NotEmpty(t, kv.checkpointKeys())
+
+			lock.release()
+			plugin.resumeOperations(stale)
+			assert.Empty(t, kv.checkpointKeys())
+		})
+
+		t.Run("failed before", func(t *testing.T) {
+			op := plugin.startOperation(operationTypeMerge, userID)
+			op.checkpointError = "unable to delete post"
+			op.recordPost(mockGeneratePost(), existingPost)
+			defer plugin.deleteCheckpoint(op)
+
+			plugin.resumeOperations(stale)
+			assert.NotEmpty(t, kv.checkpointKeys())
+		})
+
+		t.Run("resumed by another server", func(t *testing.T) {
+			op := plugin.startOperation(operationTypeMerge, userID)
+			op.recordPost(mockGeneratePost(), existingPost)
+			defer plugin.deleteCheckpoint(op)
+
+			value, err := newLockValue("", "resume")
+			require.NoError(t, err)
+			resumeLock, heldKey, err := plugin.acquireLocks([]string{resumeLockKey}, value)
+			require.NoError(t, err)
+			require.Empty(t, heldKey)
+
+			plugin.resumeOperations(stale)
+			assert.NotEmpty(t, kv.checkpointKeys())
+
+			resumeLock.release()
+			plugin.resumeOperations(stale)
+			assert.Empty(t, kv.checkpointKeys())
+		})
+
+		t.Run("interrupted", func(t *testing.T) {
+			op := plugin.startOperation(operationTypeMerge, userID)
+			op.recordPost(mockGeneratePost(), existingPost)
+
+			plugin.resumeOperations(stale)
+			assert.Empty(t, kv.checkpointKeys())
+			assert.NotContains(t, kv.keys(), resumeLockKey)
+		})
+	})
+}
@@ -10,13 +10,28 @@ import (
 
 const helpText = `Wrangler Plugin - Slash Command Help
 
+%s
+%s
 %s
 %s
 
-/wrangler attach message [MESSAGE_ID_TO_ATTACH] [ROOT_MESSAGE_ID]
-  Attach a given message to a thread in the same channel
-    - Obtain the message IDs by running '/wrangler list messages' or via the 'Permalink' message dropdown option (it's the last part of the URL)
 %s
+
+%s
+
+%s
+%s
+%s
+
+%s%s
+%s
+
+%s
+
+%s
+
+%s
+
 /wrangler list channels [flags]
   List the IDs of all channels you have joined
 	Flags:
@@ -31,14 +46,26 @@ const helpText = `Wrangler Plugin - Slash Command Help
 func (p *Plugin) getHelp() string {
 	var optionalMergeThread string
 	if p.getConfiguration().MergeThreadEnable {
-		optionalMergeThread = mergeThreadUsage
+		optionalMergeThread = getMergeThreadUsage()
 	}
 
 	return codeBlock(fmt.Sprintf(
 		helpText,
 		getMoveThreadUsage(),
-		copyThreadUsage,
+		getMoveRepliesUsage(),
+		getCopyThreadUsage(),
+		splitThreadUsage,
+		flattenThreadUsage,
+		rerootThreadUsage,
+		getAttachMessageUsage(),
+		getAttachRecentUsage(),
+		detachMessageUsage,
+		getGatherUsage(),
 		optionalMergeThread,
+		undoUsage,
+		jobsUsage,
+		getAuditUsage(),
+		getStatsUsage(),
 		getListChannelsFlagSet().FlagUsages(),
 		getListMessagesFlagSet().FlagUsages(),
 	))
@@ -50,7 +77,7 @@ func getCommand(autocomplete, mergedEnabled bool) *model.Command {
 		DisplayName:      "Wrangler",
 		Description:      "Manage Mattermost messages!",
 		AutoComplete:     autocomplete,
-		AutoCompleteDesc: "Available commands: move thread, copy thread, attach message, list messages, list channels, info",
+		AutoCompleteDesc: "Available commands: move thread, move replies, copy thread, split thread, flatten thread, reroot thread, attach message, attach recent, detach message, gather, undo, jobs, audit, stats, list messages, list channels, info",
 		AutoCompleteHint: "[command]",
 		AutocompleteData: getAutocompleteData(mergedEnabled),
 	}
@@ -72,6 +99,10 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 	}
 
 	stringArgs := strings.Split(args.Command, " ")
+	stringArgs, idempotencyKey, err := extractIdempotencyKey(stringArgs)
+	if err != nil {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: %s", err.Error())), nil
+	}
 
 	if len(stringArgs) < 2 {
 		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, p.getHelp()), nil
@@ -80,6 +111,9 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 	command := stringArgs[1]
 
 	var handler func([]string, *model.CommandArgs) (*model.CommandResponse, bool, error)
+	// commandName names the handler in metrics and idempotency keys, so that
+	// aliases such as "merge threads" are counted as the same command.
+	var commandName string
 
 	switch command {
 	case "move":
@@ -90,6 +124,11 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 		switch stringArgs[2] {
 		case "thread":
 			handler = p.runMoveThreadCommand
+			commandName = "move thread"
+			stringArgs = stringArgs[3:]
+		case "replies":
+			handler = p.runMoveRepliesCommand
+			commandName = "move replies"
 			stringArgs = stringArgs[3:]
 		}
 	case "copy":
@@ -100,6 +139,40 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 		switch stringArgs[2] {
 		case "thread":
 			handler = p.runCopyThreadCommand
+			commandName = "copy thread"
+			stringArgs = stringArgs[3:]
+		}
+	case "split":
+		if len(stringArgs) < 3 {
+			break
+		}
+
+		switch stringArgs[2] {
+		case "thread":
+			handler = p.runSplitThreadCommand
+			commandName = "split thread"
+			stringArgs = stringArgs[3:]
+		}
+	case "flatten":
+		if len(stringArgs) < 3 {
+			break
+		}
+
+		switch stringArgs[2] {
+		case "thread":
+			handler = p.runFlattenThreadCommand
+			commandName = "flatten thread"
+			stringArgs = stringArgs[3:]
+		}
+	case "reroot":
+		if len(stringArgs) < 3 {
+			break
+		}
+
+		switch stringArgs[2] {
+		case "thread":
+			handler = p.runRerootThreadCommand
+			commandName = "reroot thread"
 			stringArgs = stringArgs[3:]
 		}
 	case "attach":
@@ -110,16 +183,53 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 		switch stringArgs[2] {
 		case "message":
 			handler = p.runAttachMessageCommand
+			commandName = "attach message"
 			stringArgs = stringArgs[3:]
+		case "recent":
+			handler = p.runAttachRecentCommand
+			commandName = "attach recent"
+			stringArgs = stringArgs[3:]
+		}
+	case "detach":
+		if len(stringArgs) < 3 {
+			break
 		}
+
+		switch stringArgs[2] {
+		case "message":
+			handler = p.runDetachMessageCommand
+			commandName = "detach message"
+			stringArgs = stringArgs[3:]
+		}
+	case "gather":
+		handler = p.runGatherCommand
+		commandName = "gather"
+		stringArgs = stringArgs[2:]
+	case "undo":
+		handler = p.runUndoCommand
+		commandName = "undo"
+		stringArgs = stringArgs[2:]
+	case "jobs":
+		handler = p.runJobsCommand
+		commandName = "jobs"
+		stringArgs = stringArgs[2:]
+	case "audit":
+		handler = p.runAuditCommand
+		commandName = "audit"
+		stringArgs = stringArgs[2:]
+	case "stats":
+		handler = p.runStatsCommand
+		commandName = "stats"
+		stringArgs = stringArgs[2:]
 	case "merge":
 		if len(stringArgs) < 3 {
 			break
 		}
 
 		switch stringArgs[2] {
-		case "thread":
+		case "thread", "threads":
 			handler = p.runMergeThreadCommand
+			commandName = "merge thread"
 			stringArgs = stringArgs[3:]
 		}
 	case "list":
@@ -130,13 +240,16 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 		switch stringArgs[2] {
 		case "channels":
 			handler = p.runListChannelsCommand
+			commandName = "list channels"
 			stringArgs = stringArgs[3:]
 		case "messages":
 			handler = p.runListMessagesCommand
+			commandName = "list messages"
 			stringArgs = stringArgs[3:]
 		}
 	case "info":
 		handler = p.runInfoCommand
+		commandName = "info"
 		stringArgs = stringArgs[2:]
 	}
 
@@ -144,7 +257,17 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, p.getHelp()), nil
 	}
 
-	resp, userError, err := handler(stringArgs, args)
+	resp, userError, err := p.runIdempotent(args.UserId, commandName, idempotencyKey, func() (*model.CommandResponse, bool, error) {
+		return handler(stringArgs, args)
+	})
+	switch {
+	case err != nil && !userError:
+		p.metrics.observeCommand(commandName, commandOutcomeError)
+	case userError:
+		p.metrics.observeCommand(commandName, commandOutcomeUserError)
+	default:
+		p.metrics.observeCommand(commandName, commandOutcomeSuccess)
+	}
 
 	if err != nil {
 		p.API.LogError(err.Error())
@@ -215,14 +338,27 @@ func (p *Plugin) authorizedPluginUser(userID string) bool {
 	return true
 }
 
+func getMergeModeAutocompleteItems() []model.AutocompleteListItem {
+	return []model.AutocompleteListItem{
+		{Item: mergeModeInterleave, HelpText: "Preserve message timestamps so merged messages are interleaved with existing replies"},
+		{Item: mergeModeAppend, HelpText: "Add merged messages after the existing replies"},
+		{Item: mergeModeRebuild, HelpText: "Recreate all threads as one new thread in chronological order"},
+	}
+}
+
 func getAutocompleteData(mergedEnabled bool) *model.AutocompleteData {
-	wrangler := model.NewAutocompleteData("wrangler", "[command]", "Available commands: move, copy, attach, list, info, help")
+	wrangler := model.NewAutocompleteData("wrangler", "[command]", "Available commands: move, copy, split, flatten, reroot, attach, detach, gather, undo, jobs, audit, stats, list, info, help")
 
 	move := model.NewAutocompleteData("move", "[subcommand]", "Move messages")
 	moveThread := model.NewAutocompleteData("thread", "[MESSAGE_ID] [CHANNEL_ID]", "Move a message and the thread it belongs to")
 	moveThread.AddTextArgument("The ID of the message to be moved", "[MESSAGE_ID]", "")
 	moveThread.AddTextArgument("The ID of the channel where the message will be moved to", "[CHANNEL_ID]", "")
 	move.AddCommand(moveThread)
+	moveReplies := model.NewAutocompleteData("replies", "[ROOT_MESSAGE_ID] [REPLY_MESSAGE_ID...] [--to-thread ROOT_MESSAGE_ID | --to-channel CHANNEL_ID]", "Move a selection of replies to another thread or channel")
+	moveReplies.AddTextArgument("The root message ID of the thread followed by the IDs of the replies to be moved", "[ROOT_MESSAGE_ID] [REPLY_MESSAGE_ID...]", "")
+	moveReplies.AddNamedTextArgument(flagMoveRepliesToThread, "The root message ID of the thread to move the replies to", "[ROOT_MESSAGE_ID]", "", false)
+	moveReplies.AddNamedTextArgument(flagMoveRepliesToChannel, "The ID of the channel to move the replies to as a new thread", "[CHANNEL_ID]", "", false)
+	move.AddCommand(moveReplies)
 	wrangler.AddCommand(move)
 
 	copy := model.NewAutocompleteData("copy", "[subcommand]", "Copy messages")
@@ -232,19 +368,84 @@ func getAutocompleteData(mergedEnabled bool) *model.AutocompleteData {
 	copy.AddCommand(copyThread)
 	wrangler.AddCommand(copy)
 
+	split := model.NewAutocompleteData("split", "[subcommand]", "Split messages")
+	splitThread := model.NewAutocompleteData("thread", "[REPLY_MESSAGE_ID] [CHANNEL_ID]", "Split a thread into a new thread starting at a given reply")
+	splitThread.AddTextArgument("The ID of the reply that will become the root of the new thread", "[REPLY_MESSAGE_ID]", "")
+	splitThread.AddTextArgument("The ID of the channel where the new thread will be created", "[CHANNEL_ID]", "")
+	split.AddCommand(splitThread)
+	wrangler.AddCommand(split)
+
+	flatten := model.NewAutocompleteData("flatten", "[subcommand]", "Flatten threads")
+	flattenThread := model.NewAutocompleteData("thread", "[MESSAGE_ID]", "Recreate each reply of a thread as a message in the channel")
+	flattenThread.AddTextArgument("The ID of a message in the thread to be flattened", "[MESSAGE_ID]", "")
+	flatten.AddCommand(flattenThread)
+	wrangler.AddCommand(flatten)
+
+	reroot := model.NewAutocompleteData("reroot", "[subcommand]", "Reroot threads")
+	rerootThread := model.NewAutocompleteData("thread", "[REPLY_MESSAGE_ID]", "Rebuild a thread with a given reply as the new root message")
+	rerootThread.AddTextArgument("The ID of the reply that will become the new root message", "[REPLY_MESSAGE_ID]", "")
+	reroot.AddCommand(rerootThread)
+	wrangler.AddCommand(reroot)
+
 	attach := model.NewAutocompleteData("attach", "[subcommand]", "Attach messages")
-	attachMessage := model.NewAutocompleteData("message", "[MESSAGE_ID_TO_ATTACH] [ROOT_MESSAGE_ID]", "Attach a message to a thread in the channel")
-	attachMessage.AddTextArgument("The ID of the message to be attached", "[MESSAGE_ID_TO_ATTACH]", "")
-	attachMessage.AddTextArgument("The root message ID of the thread", "[ROOT_MESSAGE_ID]", "")
+	attachMessage := model.NewAutocompleteData("message", "[MESSAGE_ID_TO_ATTACH...] [ROOT_MESSAGE_ID] [--range] [--cross-channel]", "Attach one or more messages to a thread")
+	attachMessage.AddTextArgument("The IDs of the messages to be attached followed by the root message ID of the thread", "[MESSAGE_ID_TO_ATTACH...] [ROOT_MESSAGE_ID]", "")
 	attach.AddCommand(attachMessage)
+	attachRecent := model.NewAutocompleteData("recent", "[ROOT_MESSAGE_ID] --user USERNAME --within DURATION", "Attach a user's recent messages to a thread in the channel")
+	attachRecent.AddTextArgument("The root message ID of the thread", "[ROOT_MESSAGE_ID]", "")
+	attachRecent.AddNamedTextArgument(flagAttachRecentUser, "The username of the user whose messages will be attached", "[USERNAME]", "", true)
+	attachRecent.AddNamedTextArgument(flagAttachRecentWithin, "Attach messages posted within this duration", "[DURATION]", "", true)
+	attach.AddCommand(attachRecent)
 	wrangler.AddCommand(attach)
 
+	detach := model.NewAutocompleteData("detach", "[subcommand]", "Detach messages")
+	detachMessage := model.NewAutocompleteData("message", "[MESSAGE_ID]", "Detach a reply from its thread and recreate it in the channel")
+	detachMessage.AddTextArgument("The ID of the reply to be detached", "[MESSAGE_ID]", "")
+	detach.AddCommand(detachMessage)
+	wrangler.AddCommand(detach)
+
+	gather := model.NewAutocompleteData("gather", "[MESSAGE_ID...] [--since TIME --until TIME --user USERNAME]", "Gather messages that are not in a thread into one new thread")
+	gather.AddTextArgument("The IDs of the messages to be gathered", "[MESSAGE_ID...]", "")
+	gather.AddNamedTextArgument(flagGatherSince, "Gather messages posted after this time", "[TIME]", "", false)
+	gather.AddNamedTextArgument(flagGatherUntil, "Gather messages posted before this time", "[TIME]", "", false)
+	gather.AddNamedTextArgument(flagGatherUser, "Only gather messages posted by this username", "[USERNAME]", "", false)
+	wrangler.AddCommand(gather)
+
+	undo := model.NewAutocompleteData("undo", "[OPERATION_ID]", "Undo your most recent move, copy, merge or attach operation")
+	undo.AddTextArgument("The ID of the operation to undo", "[OPERATION_ID]", "")
+	wrangler.AddCommand(undo)
+
+	jobs := model.NewAutocompleteData("jobs", "[subcommand]", "List your running and recent background jobs")
+	jobsCancel := model.NewAutocompleteData("cancel", "[JOB_ID]", "Cancel a running background job")
+	jobsCancel.AddTextArgument("The ID of the job to cancel", "[JOB_ID]", "")
+	jobs.AddCommand(jobsCancel)
+	jobsResume := model.NewAutocompleteData("resume", "[OPERATION_ID]", "Resume interrupted operations (system admins only)")
+	jobsResume.AddTextArgument("The ID of the operation to resume", "[OPERATION_ID]", "")
+	jobs.AddCommand(jobsResume)
+	wrangler.AddCommand(jobs)
+
+	audit := model.NewAutocompleteData("audit", "[--user USERNAME] [--channel CHANNEL_ID] [--since TIME] [--op TYPE]", "Show the audit log of Wrangler operations (system admins only)")
+	audit.AddNamedTextArgument(flagAuditUser, "Only show operations run by this username", "[USERNAME]", "", false)
+	audit.AddNamedTextArgument(flagAuditChannel, "Only show operations from or to this channel ID", "[CHANNEL_ID]", "", false)
+	audit.AddNamedTextArgument(flagAuditSince, "Only show operations since this time", "[TIME]", "", false)
+	audit.AddNamedStaticListArgument(flagAuditOp, "Only show operations of this type", false, auditOperationTypes)
+	wrangler.AddCommand(audit)
+
+	stats := model.NewAutocompleteData("stats", "[--since TIME] [--team] [--json]", "Summarize Wrangler operations")
+	stats.AddNamedTextArgument(flagStatsSince, "Only include operations since this time", "[TIME]", "", false)
+	wrangler.AddCommand(stats)
+
 	if mergedEnabled {
 		merge := model.NewAutocompleteData("merge", "[subcommand]", "Merge threads")
 		mergeThread := model.NewAutocompleteData("thread", "[ROOT_MESSAGE_ID] [TARGET_ROOT_MESSAGE_ID]", "Merge a thread's messages into another existing thread")
 		mergeThread.AddTextArgument("The root message ID of the thread to be merged", "[ROOT_MESSAGE_ID]", "")
 		mergeThread.AddTextArgument("The root message ID of the thread to merge into", "[TARGET_ROOT_MESSAGE_ID]", "")
+		mergeThread.AddNamedStaticListArgument(flagMergeThreadMode, "How merged messages are ordered", false, getMergeModeAutocompleteItems())
 		merge.AddCommand(mergeThread)
+		mergeThreads := model.NewAutocompleteData("threads", "[ROOT_MESSAGE_ID...] [TARGET_ROOT_MESSAGE_ID]", "Merge multiple threads' messages into another existing thread")
+		mergeThreads.AddTextArgument("The root message IDs of the threads to be merged followed by the root message ID of the thread to merge into", "[ROOT_MESSAGE_ID...] [TARGET_ROOT_MESSAGE_ID]", "")
+		mergeThreads.AddNamedStaticListArgument(flagMergeThreadMode, "How merged messages are ordered", false, getMergeModeAutocompleteItems())
+		merge.AddCommand(mergeThreads)
 		wrangler.AddCommand(merge)
 	}
 
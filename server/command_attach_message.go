@@ -2,163 +2,431 @@ package main
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/mattermost/mattermost-server/v5/model"
 	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
 )
 
-const attachMessageCommand = `Error: missing arguments
+const (
+	attachMessageUsage = `/wrangler attach message [MESSAGE_ID_TO_ATTACH...] [ROOT_MESSAGE_ID] [flags]
+  Attach one or more messages to a thread
+    - Obtain the message IDs by running '/wrangler list messages' or via the 'Permalink' message dropdown option (it's the last part of the URL)
+    - With --range, provide the first and last message IDs to attach every message in between that is not in a thread
+    - With --cross-channel, the thread can be in another channel; run the command from the channel containing the messages
+	Flags:
+%s`
 
-/wrangler attach message [MESSAGE_ID_TO_BE_ATTACHED] [ROOT_MESSAGE_ID]
-	Attach a given message to a thread in the same channel
-	  - Obtain the message IDs by running '/wrangler list messages' or via the 'Permalink' message dropdown option (it's the last part of the URL)
-`
+	flagAttachMessageRange        = "range"
+	flagAttachMessageCrossChannel = "cross-channel"
+)
+
+type attachMessageOptions struct {
+	postIDs      []string
+	targetPostID string
+	isRange      bool
+	crossChannel bool
+	dryRun       bool
+}
+
+func getAttachMessageFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("attach message", pflag.ContinueOnError)
+	flagSet.Bool(flagAttachMessageRange, false, "Attach every message between the first and last provided message IDs")
+	flagSet.Bool(flagAttachMessageCrossChannel, false, "Allow attaching messages to a thread in another channel")
+	flagSet.Bool(flagDryRun, false, "Show what would be attached without attaching anything")
+
+	return flagSet
+}
+
+func parseAttachMessageArgs(args []string) (attachMessageOptions, error) {
+	var options attachMessageOptions
+
+	flagSet := getAttachMessageFlagSet()
+	err := flagSet.Parse(args)
+	if err != nil {
+		return options, errors.Wrap(err, "unable to parse attach message flag args")
+	}
+
+	options.isRange, err = flagSet.GetBool(flagAttachMessageRange)
+	if err != nil {
+		return options, err
+	}
+	options.crossChannel, err = flagSet.GetBool(flagAttachMessageCrossChannel)
+	if err != nil {
+		return options, err
+	}
+	options.dryRun, err = flagSet.GetBool(flagDryRun)
+	if err != nil {
+		return options, err
+	}
+
+	positionalArgs := flagSet.Args()
+	if len(positionalArgs) < 2 {
+		return options, errors.New("at least one message ID to attach and a root message ID must be provided")
+	}
+	options.postIDs = positionalArgs[:len(positionalArgs)-1]
+	options.targetPostID = positionalArgs[len(positionalArgs)-1]
+	if options.isRange && len(options.postIDs) != 2 {
+		return options, errors.Errorf("--%s requires exactly two message IDs to attach followed by a root message ID", flagAttachMessageRange)
+	}
+
+	return options, nil
+}
+
+func getAttachMessageUsage() string {
+	return fmt.Sprintf(attachMessageUsage, getAttachMessageFlagSet().FlagUsages())
+}
 
 func getAttachMessageCommand() string {
-	return codeBlock(attachMessageCommand)
+	return codeBlock(fmt.Sprintf("`Error: missing arguments\n\n%s", getAttachMessageUsage()))
 }
 
 func (p *Plugin) runAttachMessageCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
 	if len(args) < 2 {
 		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, getAttachMessageCommand()), true, nil
 	}
-	postToBeAttachedID := args[0]
-	postToAttachToID := args[1]
+	options, err := parseAttachMessageArgs(args)
+	if err != nil {
+		return nil, true, err
+	}
 
-	if postToBeAttachedID == postToAttachToID {
-		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: the two provided message IDs should not be the same"), true, nil
+	for _, postID := range options.postIDs {
+		if postID == options.targetPostID {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: the message IDs to attach should not be the same as the root message ID"), true, nil
+		}
 	}
 
-	postToBeAttached, appErr := p.API.GetPost(postToBeAttachedID)
-	if appErr != nil {
-		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: unable to get message with ID %s; ensure this is correct", postToBeAttachedID)), true, nil
+	var postsToBeAttached []*model.Post
+	for _, postID := range options.postIDs {
+		post, appErr := p.API.GetPost(postID)
+		if appErr != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: unable to get message with ID %s; ensure this is correct", postID)), true, nil
+		}
+		postsToBeAttached = append(postsToBeAttached, post)
 	}
-	postToAttachTo, appErr := p.API.GetPost(postToAttachToID)
+	postToAttachTo, appErr := p.API.GetPost(options.targetPostID)
 	if appErr != nil {
-		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: unable to get message with ID %s; ensure this is correct", postToAttachToID)), true, nil
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: unable to get message with ID %s; ensure this is correct", options.targetPostID)), true, nil
 	}
 
-	if postToBeAttached.ChannelId != extra.ChannelId {
-		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: the attach command must be run from the channel containing the messages"), true, nil
+	for _, post := range postsToBeAttached {
+		response := validateAttachPost(post, extra)
+		if response != nil {
+			return response, true, nil
+		}
 	}
-	if postToAttachTo.ChannelId != extra.ChannelId {
-		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: unable to attach message to a thread in another channel"), true, nil
+
+	newRootID := postToAttachTo.Id
+	if len(postToAttachTo.RootId) != 0 {
+		newRootID = postToAttachTo.RootId
 	}
-	if len(postToBeAttached.RootId) != 0 || len(postToBeAttached.ParentId) != 0 {
-		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: the message to be attached is already part of a thread"), true, nil
+
+	if options.isRange {
+		postsToBeAttached, err = p.selectAttachRange(postsToBeAttached[0], postsToBeAttached[1], newRootID)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(postsToBeAttached) == 0 {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: no messages that can be attached were found in the provided range"), true, nil
+		}
 	}
-	if extra.RootId == postToBeAttached.Id || extra.ParentId == postToBeAttached.Id {
-		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: the 'attach message' command cannot be run from inside the thread of the message being attached; please run directly in the channel containing the message you wish to attach"), true, nil
+	postsToBeAttached = uniquePosts(postsToBeAttached)
+	sort.Slice(postsToBeAttached, func(i, j int) bool {
+		return postsToBeAttached[i].CreateAt < postsToBeAttached[j].CreateAt
+	})
+
+	var blockingResponse *model.CommandResponse
+	blockingUserErr := true
+	targetChannelID := postToAttachTo.ChannelId
+	if targetChannelID != extra.ChannelId {
+		if !options.crossChannel {
+			blockingResponse = getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: unable to attach message to a thread in another channel; use --%s to allow this", flagAttachMessageCrossChannel))
+		} else {
+			blockingResponse, blockingUserErr, err = p.validateCrossChannelAttach(extra.ChannelId, targetChannelID, len(postsToBeAttached), extra)
+			if err != nil {
+				return nil, false, err
+			}
+		}
+	}
+
+	if options.dryRun {
+		targetChannel, appErr := p.API.GetChannel(targetChannelID)
+		if appErr != nil {
+			return nil, false, errors.Wrapf(appErr, "unable to get channel with ID %s", targetChannelID)
+		}
+		preview, err := p.buildOperationPreview("attach message", buildWranglerPostListFromPosts(postsToBeAttached), targetChannel, blockingResponse)
+		if err != nil {
+			return nil, false, err
+		}
+		return previewResponse(preview)
+	}
+	if blockingResponse != nil {
+		return blockingResponse, blockingUserErr, nil
 	}
 
 	// We now know:
 	// 1. The post IDs are valid and unique.
-	// 2. The post to be attached is not part of a thread already.
-	// 3. The posts are in the same channel.
+	// 2. The posts to be attached are not part of a thread already.
+	// 3. The posts are in the same channel as the thread, or the configuration
+	//    allows them to be moved to the channel of the thread.
 	// 4. The command was run from the original channel with the posts, so they
 	//    are also a member of that channel.
 
-	currentTeam, appErr := p.API.GetTeam(extra.TeamId)
+	newPostLink, verification, response, err := p.attachPostsToThread(postsToBeAttached, newRootID, targetChannelID, getSetFlags(getAttachMessageFlagSet(), args), extra)
+	if response != nil || err != nil {
+		return response, false, err
+	}
+
+	if len(postsToBeAttached) == 1 {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Message successfully attached to thread\n%s", verification.summary())), false, nil
+	}
+
+	return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("%d messages successfully attached to thread: %s\n%s", len(postsToBeAttached), newPostLink, verification.summary())), false, nil
+}
+
+// attachPostsToThread attaches every post to the thread with the given root
+// ID in the given channel and returns a link to the result along with the
+// verification of the attached posts. Users who created any of the posts,
+// other than the user running the command, are sent a DM. The original posts
+// are only deleted once every post has been attached and verified, so a
+// failure is rolled back and reported with the returned command response.
+// The threads involved are locked while the posts are attached and the
+// attach is audited along with the given command flags.
+func (p *Plugin) attachPostsToThread(postsToBeAttached []*model.Post, newRootID, targetChannelID string, flags []string, extra *model.CommandArgs) (string, *verification, *model.CommandResponse, error) {
+	targetChannel, appErr := p.API.GetChannel(targetChannelID)
 	if appErr != nil {
-		return nil, false, errors.Wrap(appErr, "failed to lookup lookup team")
+		return "", nil, nil, errors.Wrapf(appErr, "unable to get channel with ID %s", targetChannelID)
+	}
+	// The posts being attached are always in the channel the command was run
+	// from.
+	originalChannel := targetChannel
+	if extra.ChannelId != targetChannelID {
+		originalChannel, appErr = p.API.GetChannel(extra.ChannelId)
+		if appErr != nil {
+			return "", nil, nil, errors.Wrapf(appErr, "unable to get channel with ID %s", extra.ChannelId)
+		}
+	}
+	// Direct and group messages don't belong to a team, so they are linked
+	// to from the team the command was run in.
+	targetTeamID := targetChannel.TeamId
+	if len(targetTeamID) == 0 {
+		targetTeamID = extra.TeamId
+	}
+	targetTeam, appErr := p.API.GetTeam(targetTeamID)
+	if appErr != nil {
+		return "", nil, nil, errors.Wrap(appErr, "failed to lookup lookup team")
 	}
 
-	newRootID := postToAttachTo.Id
-	if len(postToAttachTo.RootId) != 0 {
-		newRootID = postToAttachTo.RootId
+	op := p.startOperation(operationTypeAttach, extra.UserId)
+	rootIDs := []string{newRootID}
+	for _, post := range postsToBeAttached {
+		rootIDs = append(rootIDs, getPostRootID(post))
 	}
-	cleanupID := postToBeAttached.Id
+	response, err := p.lockThreads(op, rootIDs...)
+	if response != nil || err != nil {
+		return "", nil, response, err
+	}
+	defer op.unlock()
+	op.startAudit([]*model.Channel{originalChannel}, targetChannel, postsToBeAttached, newRootID, flags)
 
-	// Begin attaching message to the thread.
-	p.API.LogInfo("Wrangler is attaching a message",
+	// Begin attaching messages to the thread.
+	p.API.LogInfo("Wrangler is attaching messages",
 		"user_id", extra.UserId,
-		"post_to_be_attached", postToBeAttachedID,
+		"attach_message_count", fmt.Sprintf("%d", len(postsToBeAttached)),
 		"new_root_id", newRootID,
 	)
 
-	if len(postToBeAttached.FileIds) != 0 {
-		// TODO: check number of files that need to be re-uploaded or file size?
-		p.API.LogInfo("Wrangler is re-uploading file attachments",
-			"file_count", len(postToBeAttached.FileIds),
-		)
-
-		var newFileIDs []string
-		var fileBytes []byte
-		var oldFileInfo, newFileInfo *model.FileInfo
-		for _, fileID := range postToBeAttached.FileIds {
-			oldFileInfo, appErr = p.API.GetFileInfo(fileID)
-			if appErr != nil {
-				return nil, false, errors.Wrap(appErr, "unable to lookup file info to re-upload")
-			}
-			fileBytes, appErr = p.API.GetFile(fileID)
-			if appErr != nil {
-				return nil, false, errors.Wrap(appErr, "unable to get file bytes to re-upload")
-			}
-			newFileInfo, appErr = p.API.UploadFile(fileBytes, postToBeAttached.ChannelId, oldFileInfo.Name)
-			if appErr != nil {
-				return nil, false, errors.Wrap(appErr, "unable to re-upload file")
-			}
-
-			newFileIDs = append(newFileIDs, newFileInfo.Id)
+	var newPost *model.Post
+	var attachedUserIDs []string
+	notifiedUserIDs := make(map[string]bool)
+	for _, post := range postsToBeAttached {
+		newPost, err = p.attachPostToThread(post, newRootID, targetChannelID, op)
+		if err != nil {
+			response, _, _ := p.rollbackResponse(op, err)
+			return "", nil, response, nil
+		}
+		if post.UserId != extra.UserId && !notifiedUserIDs[post.UserId] {
+			notifiedUserIDs[post.UserId] = true
+			attachedUserIDs = append(attachedUserIDs, post.UserId)
 		}
-
-		postToBeAttached.FileIds = newFileIDs
 	}
 
-	// Store reactions to be reapplied later.
-	reactions, appErr := p.API.GetReactions(postToBeAttached.Id)
-	if appErr != nil {
-		return nil, false, errors.Wrap(appErr, "failed to get reactions on original post")
+	verification, err := p.verifyCopiedPosts(postsToBeAttached, newRootID, op)
+	if err == nil && !verification.ok() {
+		err = verification.error()
 	}
-
-	cleanPostID(postToBeAttached)
-	postToBeAttached.RootId = newRootID
-	postToBeAttached.ParentId = newRootID
-
-	newPost, appErr := p.API.CreatePost(postToBeAttached)
-	if appErr != nil {
-		return nil, false, errors.Wrap(appErr, "failed to create new post")
+	if err != nil {
+		response, _, _ := p.rollbackResponse(op, err)
+		return "", nil, response, nil
 	}
 
-	for _, reaction := range reactions {
-		reaction.PostId = newPost.Id
-		_, appErr = p.API.AddReaction(reaction)
+	op.beginDeletes(getPostIDs(postsToBeAttached)...)
+	for i, post := range postsToBeAttached {
+		appErr = p.API.DeletePost(post.Id)
 		if appErr != nil {
-			p.API.LogError("Failed to reapply reactions to moved post", "err", appErr)
+			err = errors.Wrap(appErr, "unable to delete post")
+			if i == 0 {
+				response, _, _ := p.rollbackResponse(op, err)
+				return "", nil, response, nil
+			}
+			response, _, _ := p.partialDeleteResponse(op, err)
+			return "", nil, response, nil
 		}
 	}
 
-	appErr = p.API.DeletePost(cleanupID)
-	if appErr != nil {
-		return nil, false, errors.Wrap(appErr, "unable to delete post")
-	}
+	p.finishOperation(op)
 
-	p.API.LogInfo("Wrangler has attached a message",
+	p.API.LogInfo("Wrangler has attached messages",
 		"user_id", extra.UserId,
-		"post_to_be_attached", postToBeAttachedID,
+		"attach_message_count", fmt.Sprintf("%d", len(postsToBeAttached)),
 		"new_root_id", newRootID,
+		"operation_id", op.ID,
 	)
 
 	executor, execError := p.API.GetUser(extra.UserId)
 	if execError != nil {
-		return nil, false, errors.Wrap(appErr, "unable to find executor")
+		return "", nil, nil, errors.Wrap(execError, "unable to find executor")
 	}
 
-	if extra.UserId != postToBeAttached.UserId {
+	// A single attached message is linked to directly while multiple messages
+	// are linked to through the thread they were attached to.
+	linkPostID := newRootID
+	if len(postsToBeAttached) == 1 {
+		linkPostID = newPost.Id
+	}
+	newPostLink := makePostLink(*p.API.GetConfig().ServiceSettings.SiteURL, targetTeam.Name, linkPostID)
+
+	for _, userID := range attachedUserIDs {
 		// The wrangled message was not created by the user running the command.
 		// Send a DM to the user who created it to let them know.
-		err := p.postAttachMessageBotDM(postToBeAttached.UserId, makePostLink(*p.API.GetConfig().ServiceSettings.SiteURL, currentTeam.Name, newPost.Id), executor.Username)
+		err = p.postAttachMessageBotDM(userID, newPostLink, executor.Username)
 		if err != nil {
 			p.API.LogError("Unable to send attach-message DM to user",
 				"error", err.Error(),
-				"user_id", postToBeAttached.UserId,
+				"user_id", userID,
 			)
 		}
 	}
 
-	msg := fmt.Sprintf("Message successfully attached to thread")
+	return newPostLink, verification, nil, nil
+}
+
+// selectAttachRange returns the posts in the channel of the first post that
+// were created between the first and last post, including both. Posts that
+// are part of a thread are skipped, as is the root of the thread that the
+// posts are being attached to.
+func (p *Plugin) selectAttachRange(first, last *model.Post, newRootID string) ([]*model.Post, error) {
+	if last.CreateAt < first.CreateAt {
+		first, last = last, first
+	}
+
+	channelPosts, err := p.selectUnthreadedChannelPosts(first.ChannelId, first.CreateAt, last.CreateAt, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var posts []*model.Post
+	for _, post := range channelPosts {
+		if post.Id == newRootID {
+			continue
+		}
+		posts = append(posts, post)
+	}
+
+	return posts, nil
+}
+
+// validateCrossChannelAttach checks that messages can be attached from the
+// original channel to a thread in the target channel. The same channel type
+// and team checks that apply to moving threads are enforced.
+func (p *Plugin) validateCrossChannelAttach(originalChannelID, targetChannelID string, postCount int, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	err := p.ensureOriginalAndTargetChannelMember(originalChannelID, targetChannelID, extra.UserId)
+	if err != nil {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, err.Error()), true, nil
+	}
+
+	originalChannel, appErr := p.API.GetChannel(originalChannelID)
+	if appErr != nil {
+		return nil, false, errors.Wrapf(appErr, "unable to get channel with ID %s", originalChannelID)
+	}
+	targetChannel, appErr := p.API.GetChannel(targetChannelID)
+	if appErr != nil {
+		return nil, false, errors.Wrapf(appErr, "unable to get channel with ID %s", targetChannelID)
+	}
+
+	response := p.validateChannelTypeAndTeam(originalChannel, targetChannel)
+	if response != nil {
+		return response, false, nil
+	}
+
+	config := p.getConfiguration()
+	if config.MaxThreadCountMoveSizeInt() != 0 && config.MaxThreadCountMoveSizeInt() < postCount {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: %d messages were selected, but this command is configured to only move up to %d posts", postCount, config.MaxThreadCountMoveSizeInt())), true, nil
+	}
+
+	return nil, false, nil
+}
+
+// validateAttachPost checks that a post can be attached to a thread in the
+// channel the command was run from.
+func validateAttachPost(postToBeAttached *model.Post, extra *model.CommandArgs) *model.CommandResponse {
+	if postToBeAttached.ChannelId != extra.ChannelId {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: the attach command must be run from the channel containing the messages")
+	}
+	if len(postToBeAttached.RootId) != 0 || len(postToBeAttached.ParentId) != 0 {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: the message to be attached is already part of a thread")
+	}
+	if extra.RootId == postToBeAttached.Id || extra.ParentId == postToBeAttached.Id {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: the 'attach message' command cannot be run from inside the thread of the message being attached; please run directly in the channel containing the message you wish to attach")
+	}
+
+	return nil
+}
+
+// attachPostToThread recreates a post as a reply in the thread with the given
+// root ID in the given channel. File attachments are re-uploaded and reactions
+// are reapplied to the new post. The new post and re-uploaded files are
+// recorded in the operation, and deleting the original post is left to the
+// caller.
+func (p *Plugin) attachPostToThread(originalPost *model.Post, newRootID, channelID string, op *operation) (*model.Post, error) {
+	postToBeAttached := originalPost.Clone()
+
+	if len(postToBeAttached.FileIds) != 0 {
+		// TODO: check number of files that need to be re-uploaded or file size?
+		p.API.LogInfo("Wrangler is re-uploading file attachments",
+			"file_count", len(postToBeAttached.FileIds),
+		)
+
+		newFileIDs, err := p.reuploadFileAttachments(postToBeAttached.FileIds, channelID)
+		op.recordUploadedFiles(newFileIDs)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to re-upload files of message %s", originalPost.Id)
+		}
+
+		postToBeAttached.FileIds = newFileIDs
+	}
+
+	// Store reactions to be reapplied later.
+	reactions, appErr := p.API.GetReactions(postToBeAttached.Id)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get reactions on original post")
+	}
+
+	cleanPostID(postToBeAttached)
+	postToBeAttached.ChannelId = channelID
+	postToBeAttached.RootId = newRootID
+	postToBeAttached.ParentId = newRootID
+
+	newPost, err := p.createPostWithRetries(postToBeAttached, retryBaseDelay, retryMaxRetries)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create new post")
+	}
+	op.recordPost(originalPost, newPost)
+
+	p.reapplyReactions(reactions, newPost.Id)
 
-	return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, msg), false, nil
+	return newPost, nil
 }
 
 func (p *Plugin) postAttachMessageBotDM(userID, newPostLink, executor string) error {
@@ -38,9 +38,38 @@ func TestAttachMessageCommand(t *testing.T) {
 		RootId:    rootID,
 		ParentId:  rootID,
 	}
+	channel2 := &model.Channel{
+		Id:     model.NewId(),
+		TeamId: model.NewId(),
+		Name:   "channel2",
+		Type:   model.CHANNEL_OPEN,
+	}
 	postInAnotherChannel := &model.Post{
 		Id:        model.NewId(),
-		ChannelId: model.NewId(),
+		ChannelId: channel2.Id,
+	}
+	firstRangePost := &model.Post{
+		Id:        model.NewId(),
+		UserId:    model.NewId(),
+		ChannelId: channel1.Id,
+		CreateAt:  1000,
+	}
+	middleRangePost := &model.Post{
+		Id:        model.NewId(),
+		UserId:    model.NewId(),
+		ChannelId: channel1.Id,
+		CreateAt:  1001,
+	}
+	lastRangePost := &model.Post{
+		Id:        model.NewId(),
+		UserId:    model.NewId(),
+		ChannelId: channel1.Id,
+		CreateAt:  1002,
+	}
+	rangePostList := model.NewPostList()
+	for _, post := range []*model.Post{lastRangePost, middleRangePost, firstRangePost} {
+		rangePostList.AddPost(post)
+		rangePostList.AddOrder(post.Id)
 	}
 	directChannel := &model.Channel{
 		Id:     model.NewId(),
@@ -48,6 +77,21 @@ func TestAttachMessageCommand(t *testing.T) {
 		Name:   "direct1",
 		Type:   model.CHANNEL_DIRECT,
 	}
+	groupChannel := &model.Channel{
+		Id:   model.NewId(),
+		Name: "group1",
+		Type: model.CHANNEL_GROUP,
+	}
+	groupPostToBeAttached := &model.Post{
+		Id:        model.NewId(),
+		UserId:    model.NewId(),
+		ChannelId: groupChannel.Id,
+	}
+	groupPostToAttachTo := &model.Post{
+		Id:        model.NewId(),
+		UserId:    model.NewId(),
+		ChannelId: groupChannel.Id,
+	}
 	currentTeam := &model.Team{
 		Id:   model.NewId(),
 		Name: "target-team",
@@ -70,29 +114,30 @@ func TestAttachMessageCommand(t *testing.T) {
 		},
 	}
 
+	posts := newMockPostStore()
+
 	api := &plugintest.API{}
 	api.On("GetPost", postToBeAttached.Id).Return(postToBeAttached, nil)
 	api.On("GetPost", postToAttachTo.Id).Return(postToAttachTo, nil)
 	api.On("GetPost", postInThreadAlready.Id).Return(postInThreadAlready, nil)
 	api.On("GetPost", postInAnotherChannel.Id).Return(postInAnotherChannel, nil)
+	api.On("GetPost", firstRangePost.Id).Return(firstRangePost, nil)
+	api.On("GetPost", middleRangePost.Id).Return(middleRangePost, nil)
+	api.On("GetPost", lastRangePost.Id).Return(lastRangePost, nil)
+	api.On("GetPost", groupPostToBeAttached.Id).Return(groupPostToBeAttached, nil)
+	api.On("GetPost", groupPostToAttachTo.Id).Return(groupPostToAttachTo, nil)
+	api.On("GetPostsForChannel", channel1.Id, 0, channelPostsPerPage).Return(rangePostList, nil)
+	api.On("GetChannel", channel1.Id).Return(channel1, nil)
+	api.On("GetChannel", channel2.Id).Return(channel2, nil)
+	api.On("GetChannel", groupChannel.Id).Return(groupChannel, nil)
 	api.On("GetPost", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(nil, model.NewAppError("where", model.NewId(), nil, "not found", 0))
-	api.On("CreatePost", mock.Anything, mock.Anything).Return(mockGeneratePost(), nil)
-	api.On("DeletePost", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(nil)
+	api.On("CreatePost", mock.Anything, mock.Anything).Return(posts.createPost, nil)
+	api.On("GetPostThread", mock.AnythingOfType("string")).Return(posts.getPostThread, nil)
 	api.On("GetDirectChannel", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(directChannel, nil)
 	api.On("GetReactions", mock.AnythingOfType("string")).Return(reactions, nil)
-	api.On("AddReaction", mock.Anything).Return(nil, nil)
+	api.On("GetTeam", "").Return(nil, model.NewAppError("where", model.NewId(), nil, "not found", 0))
 	api.On("GetTeam", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(currentTeam, nil)
 	api.On("GetUser", mock.Anything).Return(executor, nil)
-	api.On("GetConfig", mock.Anything).Return(config)
-	api.On("LogInfo",
-		mock.AnythingOfTypeArgument("string"),
-		mock.AnythingOfTypeArgument("string"),
-		mock.AnythingOfTypeArgument("string"),
-		mock.AnythingOfTypeArgument("string"),
-		mock.AnythingOfTypeArgument("string"),
-		mock.AnythingOfTypeArgument("string"),
-		mock.AnythingOfTypeArgument("string"),
-	).Return(nil)
 	api.On("LogError",
 		mock.AnythingOfTypeArgument("string"),
 		mock.AnythingOfTypeArgument("string"),
@@ -103,8 +148,7 @@ func TestAttachMessageCommand(t *testing.T) {
 		mock.AnythingOfTypeArgument("string"),
 	).Return(nil)
 
-	var plugin Plugin
-	plugin.SetAPI(api)
+	plugin, _ := setupCommandTestPlugin(api, config)
 
 	t.Run("no args", func(t *testing.T) {
 		resp, isUserError, err := plugin.runAttachMessageCommand([]string{}, &model.CommandArgs{ChannelId: channel1.Id})
@@ -124,7 +168,7 @@ func TestAttachMessageCommand(t *testing.T) {
 		resp, isUserError, err := plugin.runAttachMessageCommand([]string{postToAttachTo.Id, postToAttachTo.Id}, &model.CommandArgs{ChannelId: model.NewId()})
 		require.NoError(t, err)
 		assert.True(t, isUserError)
-		assert.Contains(t, resp.Text, "Error: the two provided message IDs should not be the same")
+		assert.Contains(t, resp.Text, "Error: the message IDs to attach should not be the same as the root message ID")
 	})
 
 	t.Run("post to be attached invalid", func(t *testing.T) {
@@ -173,6 +217,13 @@ func TestAttachMessageCommand(t *testing.T) {
 		assert.Contains(t, resp.Text, "Error: unable to attach message to a thread in another channel")
 	})
 
+	t.Run("range without two messages", func(t *testing.T) {
+		resp, isUserError, err := plugin.runAttachMessageCommand([]string{firstRangePost.Id, postToAttachTo.Id, "--range"}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.Error(t, err)
+		assert.True(t, isUserError)
+		assert.Nil(t, resp)
+	})
+
 	t.Run("attach message already in another thread", func(t *testing.T) {
 		resp, isUserError, err := plugin.runAttachMessageCommand([]string{postInThreadAlready.Id, postToAttachTo.Id}, &model.CommandArgs{ChannelId: channel1.Id})
 		require.NoError(t, err)
@@ -189,4 +240,73 @@ func TestAttachMessageCommand(t *testing.T) {
 		assert.False(t, isUserError)
 		assert.Contains(t, resp.Text, "Message successfully attached to thread")
 	})
+
+	t.Run("attach multiple messages successfully", func(t *testing.T) {
+		plugin.metrics = newMetrics()
+		defer func() { plugin.metrics = nil }()
+
+		resp, isUserError, err := plugin.runAttachMessageCommand([]string{firstRangePost.Id, lastRangePost.Id, postToAttachTo.Id}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "2 messages successfully attached to thread")
+		assert.Equal(t, uint64(2), plugin.metrics.postsRecreated)
+	})
+
+	t.Run("attach range of messages successfully", func(t *testing.T) {
+		resp, isUserError, err := plugin.runAttachMessageCommand([]string{lastRangePost.Id, firstRangePost.Id, postToAttachTo.Id, "--range"}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "3 messages successfully attached to thread")
+	})
+
+	t.Run("attach message in a group message successfully", func(t *testing.T) {
+		resp, isUserError, err := plugin.runAttachMessageCommand([]string{groupPostToBeAttached.Id, groupPostToAttachTo.Id}, &model.CommandArgs{ChannelId: groupChannel.Id, TeamId: currentTeam.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "Message successfully attached to thread")
+	})
+
+	t.Run("cross channel", func(t *testing.T) {
+		t.Run("to another team disabled", func(t *testing.T) {
+			plugin.setConfiguration(&configuration{MoveThreadToAnotherTeamEnable: false})
+			require.NoError(t, plugin.configuration.IsValid())
+
+			resp, isUserError, err := plugin.runAttachMessageCommand([]string{postToBeAttached.Id, postInAnotherChannel.Id, "--cross-channel"}, &model.CommandArgs{ChannelId: channel1.Id})
+			require.NoError(t, err)
+			assert.False(t, isUserError)
+			assert.Contains(t, resp.Text, "Wrangler is currently configured to not allow moving messages to different teams")
+		})
+
+		t.Run("successfully", func(t *testing.T) {
+			plugin.setConfiguration(&configuration{MoveThreadToAnotherTeamEnable: true})
+			require.NoError(t, plugin.configuration.IsValid())
+
+			resp, isUserError, err := plugin.runAttachMessageCommand([]string{postToBeAttached.Id, postInAnotherChannel.Id, "--cross-channel"}, &model.CommandArgs{ChannelId: channel1.Id})
+			require.NoError(t, err)
+			assert.False(t, isUserError)
+			assert.Contains(t, resp.Text, "Message successfully attached to thread")
+		})
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		t.Run("allowed", func(t *testing.T) {
+			callCount := len(api.Calls)
+			resp, isUserError, err := plugin.runAttachMessageCommand([]string{firstRangePost.Id, lastRangePost.Id, postToAttachTo.Id, "--dry-run"}, &model.CommandArgs{ChannelId: channel1.Id})
+			require.NoError(t, err)
+			assert.False(t, isUserError)
+			assert.Contains(t, resp.Text, "Dry run: attach message")
+			assert.Contains(t, resp.Text, "- Messages: 2")
+			assert.Contains(t, resp.Text, "This operation would be allowed.")
+			for _, call := range api.Calls[callCount:] {
+				assert.NotContains(t, []string{"CreatePost", "DeletePost", "KVSet"}, call.Method)
+			}
+		})
+
+		t.Run("blocked without cross channel", func(t *testing.T) {
+			resp, isUserError, err := plugin.runAttachMessageCommand([]string{postToBeAttached.Id, postInAnotherChannel.Id, "--dry-run"}, &model.CommandArgs{ChannelId: channel1.Id})
+			require.NoError(t, err)
+			assert.False(t, isUserError)
+			assert.Contains(t, resp.Text, "This operation would be blocked: Error: unable to attach message to a thread in another channel")
+		})
+	})
 }
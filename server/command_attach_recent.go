@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+const (
+	attachRecentUsage = `/wrangler attach recent [ROOT_MESSAGE_ID] [flags]
+  Attach a user's recent messages that are not in a thread to a thread in this channel
+    - Useful for collecting follow-up messages that were posted in the channel instead of the thread
+    - Obtain the message ID by running '/wrangler list messages' or via the 'Permalink' message dropdown option (it's the last part of the URL)
+	Flags:
+%s`
+
+	flagAttachRecentUser   = "user"
+	flagAttachRecentWithin = "within"
+)
+
+type attachRecentOptions struct {
+	targetPostID string
+	username     string
+	since        int64
+	until        int64
+}
+
+func getAttachRecentFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("attach recent", pflag.ContinueOnError)
+	flagSet.String(flagAttachRecentUser, "", "The username of the user whose messages will be attached")
+	flagSet.String(flagAttachRecentWithin, "", "Attach messages posted within this duration, such as 10m or 2h")
+
+	return flagSet
+}
+
+func parseAttachRecentArgs(args []string, now time.Time) (attachRecentOptions, error) {
+	var options attachRecentOptions
+
+	flagSet := getAttachRecentFlagSet()
+	err := flagSet.Parse(args)
+	if err != nil {
+		return options, errors.Wrap(err, "unable to parse attach recent flag args")
+	}
+
+	positionalArgs := flagSet.Args()
+	if len(positionalArgs) != 1 {
+		return options, errors.New("exactly one root message ID must be provided")
+	}
+	options.targetPostID = positionalArgs[0]
+
+	username, err := flagSet.GetString(flagAttachRecentUser)
+	if err != nil {
+		return options, err
+	}
+	options.username = strings.TrimPrefix(username, "@")
+	if len(options.username) == 0 {
+		return options, errors.Errorf("--%s must be provided", flagAttachRecentUser)
+	}
+
+	within, err := flagSet.GetString(flagAttachRecentWithin)
+	if err != nil {
+		return options, err
+	}
+	if len(within) == 0 {
+		return options, errors.Errorf("--%s must be provided", flagAttachRecentWithin)
+	}
+	options.since, err = parseTimeFlag(within, now)
+	if err != nil {
+		return options, errors.Wrapf(err, "invalid --%s value", flagAttachRecentWithin)
+	}
+	options.until = model.GetMillisForTime(now)
+
+	return options, nil
+}
+
+func getAttachRecentUsage() string {
+	return fmt.Sprintf(attachRecentUsage, getAttachRecentFlagSet().FlagUsages())
+}
+
+func getAttachRecentMessage() string {
+	return codeBlock(fmt.Sprintf("`Error: missing arguments\n\n%s", getAttachRecentUsage()))
+}
+
+func (p *Plugin) runAttachRecentCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	if len(args) < 1 {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, getAttachRecentMessage()), true, nil
+	}
+	options, err := parseAttachRecentArgs(args, time.Now())
+	if err != nil {
+		return nil, true, err
+	}
+
+	postToAttachTo, appErr := p.API.GetPost(options.targetPostID)
+	if appErr != nil {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: unable to get message with ID %s; ensure this is correct", options.targetPostID)), true, nil
+	}
+	if postToAttachTo.ChannelId != extra.ChannelId {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: the attach command must be run from the channel containing the messages"), true, nil
+	}
+
+	newRootID := postToAttachTo.Id
+	if len(postToAttachTo.RootId) != 0 {
+		newRootID = postToAttachTo.RootId
+	}
+
+	channelPosts, err := p.selectUnthreadedChannelPosts(extra.ChannelId, options.since, options.until, options.username)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var postsToBeAttached []*model.Post
+	for _, post := range channelPosts {
+		if post.Id == newRootID {
+			continue
+		}
+		response := validateAttachPost(post, extra)
+		if response != nil {
+			return response, true, nil
+		}
+		postsToBeAttached = append(postsToBeAttached, post)
+	}
+	if len(postsToBeAttached) == 0 {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: no messages from @%s that can be attached were found", options.username)), true, nil
+	}
+
+	// Channel posts are returned newest first, but replies should be attached
+	// in the order they were posted.
+	sort.Slice(postsToBeAttached, func(i, j int) bool {
+		return postsToBeAttached[i].CreateAt < postsToBeAttached[j].CreateAt
+	})
+
+	newPostLink, verification, response, err := p.attachPostsToThread(postsToBeAttached, newRootID, extra.ChannelId, getSetFlags(getAttachRecentFlagSet(), args), extra)
+	if response != nil || err != nil {
+		return response, false, err
+	}
+
+	return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("%d message(s) from @%s successfully attached to thread: %s\n%s", len(postsToBeAttached), options.username, newPostLink, verification.summary())), false, nil
+}
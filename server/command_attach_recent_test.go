@@ -0,0 +1,186 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAttachRecentArgs(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("valid", func(t *testing.T) {
+		options, err := parseAttachRecentArgs([]string{"root1", "--user", "@user1", "--within", "10m"}, now)
+		require.NoError(t, err)
+		assert.Equal(t, "root1", options.targetPostID)
+		assert.Equal(t, "user1", options.username)
+		assert.Equal(t, model.GetMillisForTime(now.Add(-10*time.Minute)), options.since)
+		assert.Equal(t, model.GetMillisForTime(now), options.until)
+	})
+
+	t.Run("missing root message ID", func(t *testing.T) {
+		_, err := parseAttachRecentArgs([]string{"--user", "user1", "--within", "10m"}, now)
+		require.Error(t, err)
+	})
+
+	t.Run("missing user", func(t *testing.T) {
+		_, err := parseAttachRecentArgs([]string{"root1", "--within", "10m"}, now)
+		require.Error(t, err)
+	})
+
+	t.Run("missing within", func(t *testing.T) {
+		_, err := parseAttachRecentArgs([]string{"root1", "--user", "user1"}, now)
+		require.Error(t, err)
+	})
+
+	t.Run("invalid within", func(t *testing.T) {
+		_, err := parseAttachRecentArgs([]string{"root1", "--user", "user1", "--within", "soon"}, now)
+		require.Error(t, err)
+	})
+}
+
+func TestAttachRecentCommand(t *testing.T) {
+	team1 := &model.Team{
+		Id:   model.NewId(),
+		Name: "team-1",
+	}
+	channel1 := &model.Channel{
+		Id:     model.NewId(),
+		TeamId: team1.Id,
+		Name:   "channel1",
+		Type:   model.CHANNEL_OPEN,
+	}
+	user := &model.User{
+		Id:       model.NewId(),
+		Username: "user1",
+	}
+	otherUser := &model.User{
+		Id:       model.NewId(),
+		Username: "user2",
+	}
+	directChannel := &model.Channel{
+		Id:     model.NewId(),
+		TeamId: team1.Id,
+		Name:   "direct1",
+		Type:   model.CHANNEL_DIRECT,
+	}
+
+	now := model.GetMillis()
+	rootPost := &model.Post{
+		Id:        model.NewId(),
+		UserId:    user.Id,
+		ChannelId: channel1.Id,
+		CreateAt:  now - 3000,
+	}
+	followUp1 := &model.Post{
+		Id:        model.NewId(),
+		UserId:    user.Id,
+		ChannelId: channel1.Id,
+		CreateAt:  now - 2000,
+	}
+	otherUserPost := &model.Post{
+		Id:        model.NewId(),
+		UserId:    otherUser.Id,
+		ChannelId: channel1.Id,
+		CreateAt:  now - 1500,
+	}
+	followUp2 := &model.Post{
+		Id:        model.NewId(),
+		UserId:    user.Id,
+		ChannelId: channel1.Id,
+		CreateAt:  now - 1000,
+	}
+	postInAnotherChannel := &model.Post{
+		Id:        model.NewId(),
+		ChannelId: model.NewId(),
+	}
+
+	channelPostList := model.NewPostList()
+	for _, post := range []*model.Post{followUp2, otherUserPost, followUp1, rootPost} {
+		channelPostList.AddPost(post)
+		channelPostList.AddOrder(post.Id)
+	}
+
+	config := &model.Config{
+		ServiceSettings: model.ServiceSettings{
+			SiteURL: NewString("test.sampledomain.com"),
+		},
+	}
+
+	posts := newMockPostStore()
+
+	api := &plugintest.API{}
+	api.On("GetPost", rootPost.Id).Return(rootPost, nil)
+	api.On("GetPost", postInAnotherChannel.Id).Return(postInAnotherChannel, nil)
+	api.On("GetPost", followUp1.Id).Return(followUp1, nil)
+	api.On("GetPost", followUp2.Id).Return(followUp2, nil)
+	api.On("GetPost", mock.AnythingOfType("string")).Return(nil, model.NewAppError("where", model.NewId(), nil, "not found", 0))
+	api.On("GetUserByUsername", user.Username).Return(user, nil)
+	api.On("GetUserByUsername", otherUser.Username).Return(otherUser, nil)
+	api.On("GetPostsForChannel", channel1.Id, 0, channelPostsPerPage).Return(channelPostList, nil)
+	api.On("GetChannel", channel1.Id).Return(channel1, nil)
+	api.On("GetTeam", team1.Id).Return(team1, nil)
+	api.On("GetUser", mock.AnythingOfType("string")).Return(otherUser, nil)
+	api.On("GetDirectChannel", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(directChannel, nil)
+	api.On("CreatePost", mock.Anything).Return(posts.createPost, nil)
+	api.On("GetPostThread", mock.AnythingOfType("string")).Return(posts.getPostThread, nil)
+
+	plugin, _ := setupCommandTestPlugin(api, config)
+
+	t.Run("no args", func(t *testing.T) {
+		resp, isUserError, err := plugin.runAttachRecentCommand([]string{}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: missing arguments")
+	})
+
+	t.Run("invalid args", func(t *testing.T) {
+		resp, isUserError, err := plugin.runAttachRecentCommand([]string{rootPost.Id}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.Error(t, err)
+		assert.True(t, isUserError)
+		assert.Nil(t, resp)
+	})
+
+	t.Run("root post invalid", func(t *testing.T) {
+		resp, isUserError, err := plugin.runAttachRecentCommand([]string{model.NewId(), "--user", user.Username, "--within", "10m"}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: unable to get message with ID")
+	})
+
+	t.Run("root post in another channel", func(t *testing.T) {
+		resp, isUserError, err := plugin.runAttachRecentCommand([]string{postInAnotherChannel.Id, "--user", user.Username, "--within", "10m"}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: the attach command must be run from the channel containing the messages")
+	})
+
+	t.Run("no messages found", func(t *testing.T) {
+		resp, isUserError, err := plugin.runAttachRecentCommand([]string{rootPost.Id, "--user", otherUser.Username, "--within", "1ms"}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: no messages from @user2 that can be attached were found")
+	})
+
+	t.Run("attach recent messages successfully", func(t *testing.T) {
+		callCount := len(api.Calls)
+		resp, isUserError, err := plugin.runAttachRecentCommand([]string{rootPost.Id, "--user", "@" + user.Username, "--within", "10m"}, &model.CommandArgs{ChannelId: channel1.Id, UserId: user.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "2 message(s) from @user1 successfully attached to thread")
+		assert.Contains(t, resp.Text, "Verified 2 message(s), 0 file(s) and 0 reaction(s) before removing the originals.")
+
+		var deleted []string
+		for _, call := range api.Calls[callCount:] {
+			if call.Method == "DeletePost" {
+				deleted = append(deleted, call.Arguments.String(0))
+			}
+		}
+		assert.Equal(t, []string{followUp1.Id, followUp2.Id}, deleted)
+	})
+}
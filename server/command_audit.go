@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+const (
+	auditUsage = `/wrangler audit [flags]
+  Show the audit log of Wrangler operations, newest first
+    - Only available to system administrators
+	Flags:
+%s`
+
+	flagAuditUser    = "user"
+	flagAuditChannel = "channel"
+	flagAuditSince   = "since"
+	flagAuditOp      = "op"
+	flagAuditLimit   = "limit"
+
+	defaultAuditLimit = 20
+)
+
+// auditOperationTypes are the operation types that can be looked up in the
+// audit log. They are offered by the autocomplete of the --op flag and are
+// the only values the flag accepts.
+var auditOperationTypes = []model.AutocompleteListItem{
+	{Item: operationTypeMove, HelpText: "Moved threads"},
+	{Item: operationTypeCopy, HelpText: "Copied threads"},
+	{Item: operationTypeMerge, HelpText: "Merged threads"},
+	{Item: operationTypeAttach, HelpText: "Attached messages"},
+	{Item: operationTypeSplit, HelpText: "Split threads"},
+	{Item: operationTypeReroot, HelpText: "Rerooted threads"},
+	{Item: operationTypeFlatten, HelpText: "Flattened threads"},
+	{Item: operationTypeMoveReplies, HelpText: "Moved replies"},
+	{Item: operationTypeGather, HelpText: "Gathered messages"},
+	{Item: operationTypeDetach, HelpText: "Detached messages"},
+	{Item: operationTypeUndo, HelpText: "Undone operations"},
+}
+
+// getAuditOperationTypeList returns the audit operation types as a readable
+// list, such as "move, copy or merge".
+func getAuditOperationTypeList() string {
+	var types []string
+	for _, item := range auditOperationTypes {
+		types = append(types, item.Item)
+	}
+
+	return strings.Join(types[:len(types)-1], ", ") + " or " + types[len(types)-1]
+}
+
+func isAuditOperationType(operationType string) bool {
+	for _, item := range auditOperationTypes {
+		if item.Item == operationType {
+			return true
+		}
+	}
+
+	return false
+}
+
+type auditOptions struct {
+	filter   auditFilter
+	username string
+	limit    int
+}
+
+func getAuditFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("audit", pflag.ContinueOnError)
+	flagSet.String(flagAuditUser, "", "Only show operations run by this username or user ID")
+	flagSet.String(flagAuditChannel, "", "Only show operations from or to this channel ID")
+	flagSet.String(flagAuditSince, "", "Only show operations since this time. Accepts a duration such as 30m, 2h or 7d or an RFC3339 timestamp")
+	flagSet.String(flagAuditOp, "", "Only show operations of this type: "+getAuditOperationTypeList())
+	flagSet.Int(flagAuditLimit, defaultAuditLimit, "The maximum number of operations to show")
+
+	return flagSet
+}
+
+func getAuditUsage() string {
+	return fmt.Sprintf(auditUsage, getAuditFlagSet().FlagUsages())
+}
+
+func parseAuditArgs(args []string, now time.Time) (auditOptions, error) {
+	var options auditOptions
+
+	flagSet := getAuditFlagSet()
+	err := flagSet.Parse(args)
+	if err != nil {
+		return options, errors.Wrap(err, "unable to parse audit flag args")
+	}
+	if len(flagSet.Args()) != 0 {
+		return options, errors.Errorf("unexpected arguments: %s", strings.Join(flagSet.Args(), " "))
+	}
+
+	user, _ := flagSet.GetString(flagAuditUser)
+	user = strings.TrimPrefix(user, "@")
+	if model.IsValidId(user) {
+		options.filter.userID = user
+	} else {
+		options.username = user
+	}
+	options.filter.channelID, _ = flagSet.GetString(flagAuditChannel)
+
+	options.filter.operationType, _ = flagSet.GetString(flagAuditOp)
+	if len(options.filter.operationType) != 0 && !isAuditOperationType(options.filter.operationType) {
+		return options, errors.Errorf("invalid --%s value %s; must be %s", flagAuditOp, options.filter.operationType, getAuditOperationTypeList())
+	}
+
+	since, _ := flagSet.GetString(flagAuditSince)
+	if len(since) != 0 {
+		options.filter.since, err = parseTimeFlag(since, now)
+		if err != nil {
+			return options, errors.Wrapf(err, "invalid --%s value", flagAuditSince)
+		}
+	}
+
+	options.limit, _ = flagSet.GetInt(flagAuditLimit)
+	if options.limit < 1 {
+		return options, errors.Errorf("--%s must be greater than 0", flagAuditLimit)
+	}
+
+	return options, nil
+}
+
+func (p *Plugin) runAuditCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	user, appErr := p.API.GetUser(extra.UserId)
+	if appErr != nil {
+		return nil, false, errors.Wrap(appErr, "unable to find user")
+	}
+	if !user.IsSystemAdmin() {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: only system administrators can view the audit log"), true, nil
+	}
+
+	options, err := parseAuditArgs(args, time.Now())
+	if err != nil {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, codeBlock(fmt.Sprintf("Error: %s\n\n%s", err.Error(), getAuditUsage()))), true, nil
+	}
+	if len(options.username) != 0 {
+		filterUser, appErr := p.API.GetUserByUsername(options.username)
+		if appErr != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: unable to find user %s", options.username)), true, nil
+		}
+		options.filter.userID = filterUser.Id
+	}
+
+	entries, err := p.getAuditEntries(options.filter)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(entries) == 0 {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "No audited operations were found"), false, nil
+	}
+
+	msg := fmt.Sprintf("#### Wrangler audit log\nShowing %d of %d operation(s)\n", minInt(len(entries), options.limit), len(entries))
+	usernames := make(map[string]string)
+	for i, entry := range entries {
+		if i == options.limit {
+			break
+		}
+		msg += p.formatAuditEntry(entry, usernames)
+	}
+
+	return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, msg), false, nil
+}
+
+// formatAuditEntry returns a list item describing an audit entry. Usernames
+// are looked up once and cached in the given map.
+func (p *Plugin) formatAuditEntry(entry *auditEntry, usernames map[string]string) string {
+	username, ok := usernames[entry.UserID]
+	if !ok {
+		username = entry.UserID
+		if user, appErr := p.API.GetUser(entry.UserID); appErr == nil {
+			username = "@" + user.Username
+		}
+		usernames[entry.UserID] = username
+	}
+
+	msg := fmt.Sprintf("- %s: %s by %s, %s after %s, %s\n",
+		inlineCode(entry.OperationID),
+		entry.Type,
+		username,
+		strings.Replace(entry.Outcome, "_", " ", -1),
+		time.Duration(entry.DurationMillis)*time.Millisecond,
+		time.Unix(0, entry.EndAt*int64(time.Millisecond)).UTC().Format(time.RFC822),
+	)
+	msg += fmt.Sprintf("  - %d message(s) and %d file(s) from channel(s) %s to channel %s\n",
+		entry.PostCount,
+		entry.FileCount,
+		inlineCodeList(entry.SourceChannelIDs),
+		inlineCode(entry.TargetChannelID),
+	)
+	msg += fmt.Sprintf("  - Thread(s) %s", inlineCodeList(entry.OriginalRootIDs))
+	if len(entry.NewRootID) != 0 {
+		msg += fmt.Sprintf(" to thread %s", inlineCode(entry.NewRootID))
+	}
+	msg += "\n"
+	if len(entry.Flags) != 0 {
+		msg += fmt.Sprintf("  - Flags: %s\n", inlineCodeList(entry.Flags))
+	}
+	if len(entry.Error) != 0 {
+		msg += fmt.Sprintf("  - Error: %s\n", entry.Error)
+	}
+
+	return msg
+}
+
+func inlineCodeList(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, inlineCode(value))
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAuditArgs(t *testing.T) {
+	now := time.Now()
+	userID := model.NewId()
+	channelID := model.NewId()
+
+	t.Run("no flags", func(t *testing.T) {
+		options, err := parseAuditArgs([]string{}, now)
+		require.NoError(t, err)
+		assert.Equal(t, auditFilter{}, options.filter)
+		assert.Equal(t, defaultAuditLimit, options.limit)
+	})
+
+	t.Run("all flags", func(t *testing.T) {
+		options, err := parseAuditArgs([]string{"--user", userID, "--channel", channelID, "--since", "7d", "--op", "move", "--limit", "5"}, now)
+		require.NoError(t, err)
+		assert.Equal(t, userID, options.filter.userID)
+		assert.Equal(t, channelID, options.filter.channelID)
+		assert.Equal(t, model.GetMillisForTime(now.AddDate(0, 0, -7)), options.filter.since)
+		assert.Equal(t, operationTypeMove, options.filter.operationType)
+		assert.Equal(t, 5, options.limit)
+	})
+
+	t.Run("username", func(t *testing.T) {
+		options, err := parseAuditArgs([]string{"--user", "@user1"}, now)
+		require.NoError(t, err)
+		assert.Equal(t, "user1", options.username)
+		assert.Empty(t, options.filter.userID)
+	})
+
+	t.Run("every operation type", func(t *testing.T) {
+		for _, item := range auditOperationTypes {
+			options, err := parseAuditArgs([]string{"--op", item.Item}, now)
+			require.NoError(t, err)
+			assert.Equal(t, item.Item, options.filter.operationType)
+		}
+	})
+
+	t.Run("invalid operation type", func(t *testing.T) {
+		_, err := parseAuditArgs([]string{"--op", "rename"}, now)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "must be move, copy, merge, attach, split, reroot, flatten, move_replies, gather, detach or undo")
+	})
+
+	t.Run("invalid since", func(t *testing.T) {
+		_, err := parseAuditArgs([]string{"--since", "yesterday"}, now)
+		require.Error(t, err)
+	})
+
+	t.Run("invalid limit", func(t *testing.T) {
+		_, err := parseAuditArgs([]string{"--limit", "0"}, now)
+		require.Error(t, err)
+	})
+
+	t.Run("unexpected arguments", func(t *testing.T) {
+		_, err := parseAuditArgs([]string{"extra"}, now)
+		require.Error(t, err)
+	})
+}
+
+func TestAuditCommand(t *testing.T) {
+	admin := &model.User{Id: model.NewId(), Username: "admin", Roles: model.SYSTEM_ADMIN_ROLE_ID}
+	user := &model.User{Id: model.NewId(), Username: "user", Roles: model.SYSTEM_USER_ROLE_ID}
+
+	api := &plugintest.API{}
+	newMockKVStore(api)
+	api.On("GetUser", admin.Id).Return(admin, nil)
+	api.On("GetUser", user.Id).Return(user, nil)
+	api.On("GetUserByUsername", user.Username).Return(user, nil)
+	api.On("GetUserByUsername", "unknown").Return(nil, &model.AppError{Message: "not found"})
+
+	var plugin Plugin
+	plugin.SetAPI(api)
+
+	t.Run("not an admin", func(t *testing.T) {
+		resp, isUserError, err := plugin.runAuditCommand([]string{}, &model.CommandArgs{UserId: user.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Equal(t, "Error: only system administrators can view the audit log", resp.Text)
+	})
+
+	t.Run("no entries", func(t *testing.T) {
+		resp, isUserError, err := plugin.runAuditCommand([]string{}, &model.CommandArgs{UserId: admin.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Equal(t, "No audited operations were found", resp.Text)
+	})
+
+	sourceChannel := &model.Channel{Id: model.NewId()}
+	targetChannel := &model.Channel{Id: model.NewId()}
+	rootPost := &model.Post{Id: model.NewId(), FileIds: []string{"file1"}}
+	op := newOperation(operationTypeMove, user.Id)
+	op.startAudit([]*model.Channel{sourceChannel}, targetChannel, []*model.Post{rootPost}, "", []string{"--silent=true"})
+	op.setAuditNewRootID("new_root_id")
+	plugin.recordAudit(op, auditOutcomeSucceeded, nil)
+	for i := 0; i < 2; i++ {
+		copyOp := newOperation(operationTypeCopy, admin.Id)
+		copyOp.startAudit([]*model.Channel{sourceChannel}, sourceChannel, []*model.Post{rootPost}, "", nil)
+		plugin.recordAudit(copyOp, auditOutcomeRolledBack, errJobCanceled)
+	}
+
+	t.Run("all entries", func(t *testing.T) {
+		resp, isUserError, err := plugin.runAuditCommand([]string{}, &model.CommandArgs{UserId: admin.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "Showing 3 of 3 operation(s)")
+		assert.Contains(t, resp.Text, inlineCode(op.ID)+": move by @user, succeeded after")
+		assert.Contains(t, resp.Text, "1 message(s) and 1 file(s) from channel(s) "+inlineCode(sourceChannel.Id)+" to channel "+inlineCode(targetChannel.Id))
+		assert.Contains(t, resp.Text, "Thread(s) "+inlineCode(rootPost.Id)+" to thread `new_root_id`")
+		assert.Contains(t, resp.Text, "Flags: `--silent=true`")
+		assert.Contains(t, resp.Text, "copy by @admin, rolled back after")
+		assert.Contains(t, resp.Text, "Error: the job was canceled")
+	})
+
+	t.Run("filtered by username", func(t *testing.T) {
+		resp, isUserError, err := plugin.runAuditCommand([]string{"--user", "@user"}, &model.CommandArgs{UserId: admin.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "Showing 1 of 1 operation(s)")
+		assert.NotContains(t, resp.Text, "copy by")
+	})
+
+	t.Run("unknown username", func(t *testing.T) {
+		resp, isUserError, err := plugin.runAuditCommand([]string{"--user", "unknown"}, &model.CommandArgs{UserId: admin.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Equal(t, "Error: unable to find user unknown", resp.Text)
+	})
+
+	t.Run("limited", func(t *testing.T) {
+		resp, isUserError, err := plugin.runAuditCommand([]string{"--op", "copy", "--limit", "1"}, &model.CommandArgs{UserId: admin.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "Showing 1 of 2 operation(s)")
+	})
+
+	t.Run("invalid flags", func(t *testing.T) {
+		resp, isUserError, err := plugin.runAuditCommand([]string{"--op", "rename"}, &model.CommandArgs{UserId: admin.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "invalid --op value rename")
+	})
+}
@@ -5,25 +5,63 @@ import (
 
 	"github.com/mattermost/mattermost-server/v5/model"
 	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
 )
 
-const copyThreadUsage = `/wrangler copy thread [MESSAGE_ID] [CHANNEL_ID]
+const copyThreadUsage = `/wrangler copy thread [MESSAGE_ID] [CHANNEL_ID] [flags]
   Copy a given message, along with the thread it belongs to, to a given channel
     - This can be on any channel in any team that you have joined
     - Obtain the message ID by running '/wrangler list messages' or via the 'Permalink' message dropdown option (it's the last part of the URL)
-    - Obtain the channel ID by running '/wrangler list channels' or via the channel 'View Info' option`
+    - Obtain the channel ID by running '/wrangler list channels' or via the channel 'View Info' option
+	Flags:
+%s`
+
+func getCopyThreadFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("copy thread", pflag.ContinueOnError)
+	flagSet.Bool(flagDryRun, false, "Show what would be copied without copying anything")
+
+	return flagSet
+}
+
+func parseCopyThreadFlagArgs(args []string) (bool, error) {
+	flagSet := getCopyThreadFlagSet()
+	err := flagSet.Parse(args)
+	if err != nil {
+		return false, errors.Wrap(err, "unable to parse copy thread flag args")
+	}
+
+	dryRun, _ := flagSet.GetBool(flagDryRun)
+
+	return dryRun, nil
+}
+
+func getCopyThreadUsage() string {
+	return fmt.Sprintf(copyThreadUsage, getCopyThreadFlagSet().FlagUsages())
+}
 
 func getCopyThreadMessage() string {
-	return codeBlock(fmt.Sprintf("`Error: missing arguments\n\n%s", copyThreadUsage))
+	return codeBlock(fmt.Sprintf("`Error: missing arguments\n\n%s", getCopyThreadUsage()))
 }
 
 func (p *Plugin) runCopyThreadCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
 	if len(args) < 2 {
 		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, getCopyThreadMessage()), true, nil
 	}
+	dryRun, err := parseCopyThreadFlagArgs(args)
+	if err != nil {
+		return nil, false, err
+	}
 	postID := args[0]
 	channelID := args[1]
 
+	if dryRun {
+		preview, response, err := p.previewMoveOrCopy("copy thread", postID, channelID, extra)
+		if response != nil || err != nil {
+			return response, response != nil, err
+		}
+		return previewResponse(preview)
+	}
+
 	postListResponse, appErr := p.API.GetPostThread(postID)
 	if appErr != nil {
 		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: unable to get post with ID %s; ensure this is correct", postID)), true, nil
@@ -53,18 +91,34 @@ func (p *Plugin) runCopyThreadCommand(args []string, extra *model.CommandArgs) (
 		return nil, false, fmt.Errorf("unable to get team with ID %s", targetChannel.TeamId)
 	}
 
+	op := p.startOperation(operationTypeCopy, extra.UserId)
+	response, err = p.lockThreads(op, wpl.RootPost().Id)
+	if response != nil || err != nil {
+		return response, response != nil, err
+	}
+	op.startAudit([]*model.Channel{originalChannel}, targetChannel, wpl.Posts, "", getSetFlags(getCopyThreadFlagSet(), args))
+
+	return p.runOperation(op, wpl.NumPosts(), extra, func() (*model.CommandResponse, bool, error) {
+		return p.copyThread(wpl, originalChannel, targetChannel, targetTeam, op, extra)
+	})
+}
+
+// copyThread copies a thread to the target channel once the copy has been
+// validated.
+func (p *Plugin) copyThread(wpl *WranglerPostList, originalChannel, targetChannel *model.Channel, targetTeam *model.Team, op *operation, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
 	p.API.LogInfo("Wrangler is copying a thread",
 		"user_id", extra.UserId,
 		"original_post_id", wpl.RootPost().Id,
 		"original_channel_id", originalChannel.Id,
 	)
 
-	newRootPost, err := p.copyWranglerPostlist(wpl, targetChannel)
+	newRootPost, err := p.copyWranglerPostlist(wpl, targetChannel, op)
 	if err != nil {
-		return nil, false, err
+		return p.rollbackResponse(op, err)
 	}
+	op.setAuditNewRootID(newRootPost.Id)
 
-	_, appErr = p.API.CreatePost(&model.Post{
+	botPost, appErr := p.API.CreatePost(&model.Post{
 		UserId:    p.BotUserID,
 		RootId:    newRootPost.Id,
 		ParentId:  newRootPost.Id,
@@ -72,11 +126,12 @@ func (p *Plugin) runCopyThreadCommand(args []string, extra *model.CommandArgs) (
 		Message:   "This thread was copied from another channel",
 	})
 	if appErr != nil {
-		return nil, false, errors.Wrap(appErr, "unable to create new bot post")
+		return p.rollbackResponse(op, errors.Wrap(appErr, "unable to create new bot post"))
 	}
+	op.recordPost(nil, botPost)
 
 	newPostLink := makePostLink(*p.API.GetConfig().ServiceSettings.SiteURL, targetTeam.Name, newRootPost.Id)
-	_, appErr = p.API.CreatePost(&model.Post{
+	botPost, appErr = p.API.CreatePost(&model.Post{
 		UserId:    p.BotUserID,
 		RootId:    wpl.RootPost().Id,
 		ParentId:  wpl.RootPost().Id,
@@ -84,18 +139,22 @@ func (p *Plugin) runCopyThreadCommand(args []string, extra *model.CommandArgs) (
 		Message:   fmt.Sprintf("A copy of this thread has been made: %s", newPostLink),
 	})
 	if appErr != nil {
-		return nil, false, errors.Wrap(appErr, "unable to create new bot post")
+		return p.rollbackResponse(op, errors.Wrap(appErr, "unable to create new bot post"))
 	}
+	op.recordPost(nil, botPost)
+
+	p.finishOperation(op)
 
 	p.API.LogInfo("Wrangler thread copy complete",
 		"user_id", extra.UserId,
 		"new_post_id", newRootPost.Id,
-		"new_channel_id", channelID,
+		"new_channel_id", targetChannel.Id,
+		"operation_id", op.ID,
 	)
 
 	executor, execError := p.API.GetUser(extra.UserId)
 	if execError != nil {
-		return nil, false, errors.Wrap(appErr, "unable to find executor")
+		return nil, false, errors.Wrap(execError, "unable to find executor")
 	}
 
 	if extra.UserId != wpl.RootPost().UserId {
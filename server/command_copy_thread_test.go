@@ -77,27 +77,14 @@ func TestCopyThreadCommand(t *testing.T) {
 	api.On("GetChannel", groupChannel.Id).Return(groupChannel, nil)
 	api.On("GetChannel", mock.AnythingOfType("string")).Return(targetChannel, nil)
 	api.On("GetPostThread", mock.AnythingOfType("string")).Return(generatedPosts, nil)
-	api.On("GetChannelMember", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(mockGenerateChannelMember(), nil)
+	api.On("GetPost", mock.AnythingOfType("string")).Return(mockGeneratePost(), nil)
 	api.On("GetDirectChannel", mock.AnythingOfType("string"), mock.Anything).Return(directChannel, nil)
 	api.On("GetTeam", mock.AnythingOfType("string")).Return(targetTeam, nil)
 	api.On("GetUser", mock.Anything).Return(executor, nil)
 	api.On("CreatePost", mock.Anything, mock.Anything).Return(mockGeneratePost(), nil)
-	api.On("DeletePost", mock.AnythingOfType("string")).Return(nil)
 	api.On("GetReactions", mock.AnythingOfType("string")).Return(reactions, nil)
-	api.On("AddReaction", mock.Anything).Return(nil, nil)
-	api.On("GetConfig").Return(config)
-	api.On("LogInfo",
-		mock.AnythingOfTypeArgument("string"),
-		mock.AnythingOfTypeArgument("string"),
-		mock.AnythingOfTypeArgument("string"),
-		mock.AnythingOfTypeArgument("string"),
-		mock.AnythingOfTypeArgument("string"),
-		mock.AnythingOfTypeArgument("string"),
-		mock.AnythingOfTypeArgument("string"),
-	).Return(nil)
-
-	var plugin Plugin
-	plugin.SetAPI(api)
+
+	plugin, _ := setupCommandTestPlugin(api, config)
 
 	t.Run("no args", func(t *testing.T) {
 		resp, isUserError, err := plugin.runCopyThreadCommand([]string{}, &model.CommandArgs{ChannelId: originalChannel.Id})
@@ -215,6 +202,21 @@ func TestCopyThreadCommand(t *testing.T) {
 		assert.Contains(t, resp.Text, "Thread copy complete")
 	})
 
+	t.Run("dry run", func(t *testing.T) {
+		require.NoError(t, plugin.configuration.IsValid())
+
+		callCount := len(api.Calls)
+		resp, isUserError, err := plugin.runCopyThreadCommand([]string{"id1", "id2", "--dry-run"}, &model.CommandArgs{ChannelId: originalChannel.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "Dry run: copy thread")
+		assert.Contains(t, resp.Text, "- Messages: 3")
+		assert.Contains(t, resp.Text, "This operation would be allowed.")
+		for _, call := range api.Calls[callCount:] {
+			assert.NotContains(t, []string{"CreatePost", "DeletePost", "KVSet"}, call.Method)
+		}
+	})
+
 	t.Run("thread is above configuration move-maximum", func(t *testing.T) {
 		plugin.setConfiguration(&configuration{MoveThreadMaxCount: "1"})
 		require.NoError(t, plugin.configuration.IsValid())
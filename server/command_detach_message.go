@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const detachMessageUsage = `/wrangler detach message [MESSAGE_ID]
+  Detach a given reply from its thread and recreate it as a message in the channel
+    - Obtain the message ID by running '/wrangler list messages' or via the 'Permalink' message dropdown option (it's the last part of the URL)`
+
+func getDetachMessageMessage() string {
+	return codeBlock(fmt.Sprintf("`Error: missing arguments\n\n%s", detachMessageUsage))
+}
+
+func (p *Plugin) runDetachMessageCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	if len(args) < 1 {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, getDetachMessageMessage()), true, nil
+	}
+	postToBeDetachedID := args[0]
+
+	postToBeDetached, appErr := p.API.GetPost(postToBeDetachedID)
+	if appErr != nil {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: unable to get message with ID %s; ensure this is correct", postToBeDetachedID)), true, nil
+	}
+
+	if postToBeDetached.ChannelId != extra.ChannelId {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: the detach command must be run from the channel containing the message"), true, nil
+	}
+	if len(postToBeDetached.RootId) == 0 {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: the message to be detached is not part of a thread"), true, nil
+	}
+	if extra.RootId == postToBeDetached.RootId || extra.ParentId == postToBeDetached.RootId {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: the 'detach message' command cannot be run from inside the thread of the message being detached; please run directly in the channel containing the thread"), true, nil
+	}
+
+	// We now know:
+	// 1. The post ID is valid.
+	// 2. The post to be detached is a reply in a thread.
+	// 3. The command was run from the channel containing the post, so they
+	//    are also a member of that channel.
+
+	currentTeam, appErr := p.API.GetTeam(extra.TeamId)
+	if appErr != nil {
+		return nil, false, errors.Wrap(appErr, "failed to lookup lookup team")
+	}
+	channel, appErr := p.API.GetChannel(extra.ChannelId)
+	if appErr != nil {
+		return nil, false, errors.Wrap(appErr, "failed to lookup channel")
+	}
+
+	originalPost := postToBeDetached.Clone()
+	originalRootID := postToBeDetached.RootId
+	cleanupID := postToBeDetached.Id
+	op := p.startOperation(operationTypeDetach, extra.UserId)
+	response, err := p.lockThreads(op, originalRootID)
+	if response != nil || err != nil {
+		return response, response != nil, err
+	}
+	defer op.unlock()
+	op.startAudit([]*model.Channel{channel}, channel, []*model.Post{originalPost}, "", nil)
+
+	p.API.LogInfo("Wrangler is detaching a message",
+		"user_id", extra.UserId,
+		"post_to_be_detached", postToBeDetachedID,
+		"original_root_id", originalRootID,
+	)
+
+	if len(postToBeDetached.FileIds) != 0 {
+		p.API.LogInfo("Wrangler is re-uploading file attachments",
+			"file_count", len(postToBeDetached.FileIds),
+		)
+
+		newFileIDs, err := p.reuploadFileAttachments(postToBeDetached.FileIds, postToBeDetached.ChannelId)
+		op.recordUploadedFiles(newFileIDs)
+		if err != nil {
+			return p.rollbackResponse(op, err)
+		}
+
+		postToBeDetached.FileIds = newFileIDs
+	}
+
+	// Store reactions to be reapplied later.
+	reactions, appErr := p.API.GetReactions(postToBeDetached.Id)
+	if appErr != nil {
+		return p.rollbackResponse(op, errors.Wrap(appErr, "failed to get reactions on original post"))
+	}
+
+	cleanPostID(postToBeDetached)
+	postToBeDetached.RootId = ""
+	postToBeDetached.ParentId = ""
+
+	newPost, err := p.createPostWithRetries(postToBeDetached, retryBaseDelay, retryMaxRetries)
+	if err != nil {
+		return p.rollbackResponse(op, errors.Wrap(err, "failed to create new post"))
+	}
+	op.recordPost(originalPost, newPost)
+	op.setAuditNewRootID(newPost.Id)
+
+	p.reapplyReactions(reactions, newPost.Id)
+
+	op.beginDeletes(cleanupID)
+	appErr = p.API.DeletePost(cleanupID)
+	if appErr != nil {
+		return p.rollbackResponse(op, errors.Wrap(appErr, "unable to delete post"))
+	}
+	p.finishOperation(op)
+
+	p.API.LogInfo("Wrangler has detached a message",
+		"user_id", extra.UserId,
+		"post_to_be_detached", postToBeDetachedID,
+		"new_post_id", newPost.Id,
+	)
+
+	newPostLink := makePostLink(*p.API.GetConfig().ServiceSettings.SiteURL, currentTeam.Name, newPost.Id)
+
+	return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Message successfully detached from thread: %s", newPostLink)), false, nil
+}
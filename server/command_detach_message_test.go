@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetachMessageCommand(t *testing.T) {
+	team1 := &model.Team{
+		Id:   model.NewId(),
+		Name: "team-1",
+	}
+	channel1 := &model.Channel{
+		Id:     model.NewId(),
+		TeamId: team1.Id,
+		Name:   "channel1",
+		Type:   model.CHANNEL_OPEN,
+	}
+	rootPost := &model.Post{
+		Id:        model.NewId(),
+		UserId:    model.NewId(),
+		ChannelId: channel1.Id,
+	}
+	postToBeDetached := &model.Post{
+		Id:        model.NewId(),
+		UserId:    model.NewId(),
+		ChannelId: channel1.Id,
+		RootId:    rootPost.Id,
+		ParentId:  rootPost.Id,
+	}
+	rootID := model.NewId()
+	postInAnotherChannel := &model.Post{
+		Id:        model.NewId(),
+		ChannelId: model.NewId(),
+		RootId:    rootID,
+		ParentId:  rootID,
+	}
+
+	reactions := []*model.Reaction{
+		{
+			UserId: model.NewId(),
+			PostId: model.NewId(),
+		},
+	}
+
+	config := &model.Config{
+		ServiceSettings: model.ServiceSettings{
+			SiteURL: NewString("test.sampledomain.com"),
+		},
+	}
+
+	api := &plugintest.API{}
+	api.On("GetPost", rootPost.Id).Return(rootPost, nil)
+	api.On("GetPost", postToBeDetached.Id).Return(postToBeDetached, nil)
+	api.On("GetPost", postInAnotherChannel.Id).Return(postInAnotherChannel, nil)
+	api.On("GetPost", mock.AnythingOfType("string")).Return(nil, model.NewAppError("where", model.NewId(), nil, "not found", 0))
+	api.On("CreatePost", mock.Anything).Return(mockGeneratePost(), nil)
+	api.On("GetReactions", mock.AnythingOfType("string")).Return(reactions, nil)
+	api.On("GetTeam", mock.AnythingOfType("string")).Return(team1, nil)
+	api.On("GetChannel", channel1.Id).Return(channel1, nil)
+
+	plugin, kv := setupCommandTestPlugin(api, config)
+
+	t.Run("no args", func(t *testing.T) {
+		resp, isUserError, err := plugin.runDetachMessageCommand([]string{}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: missing arguments")
+	})
+
+	t.Run("post to be detached invalid", func(t *testing.T) {
+		resp, isUserError, err := plugin.runDetachMessageCommand([]string{model.NewId()}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: unable to get message with ID")
+	})
+
+	t.Run("invalid command run location", func(t *testing.T) {
+		t.Run("not in channel with message", func(t *testing.T) {
+			resp, isUserError, err := plugin.runDetachMessageCommand([]string{postInAnotherChannel.Id}, &model.CommandArgs{ChannelId: channel1.Id})
+			require.NoError(t, err)
+			assert.True(t, isUserError)
+			assert.Contains(t, resp.Text, "Error: the detach command must be run from the channel containing the message")
+		})
+
+		t.Run("in thread with message to be detached", func(t *testing.T) {
+			resp, isUserError, err := plugin.runDetachMessageCommand([]string{postToBeDetached.Id}, &model.CommandArgs{ChannelId: channel1.Id, RootId: rootPost.Id})
+			require.NoError(t, err)
+			assert.True(t, isUserError)
+			assert.Contains(t, resp.Text, "Error: the 'detach message' command cannot be run from inside the thread of the message being detached")
+		})
+	})
+
+	t.Run("detach root message", func(t *testing.T) {
+		resp, isUserError, err := plugin.runDetachMessageCommand([]string{rootPost.Id}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: the message to be detached is not part of a thread")
+	})
+
+	t.Run("thread locked by another operation", func(t *testing.T) {
+		kv.data[threadLockKey(rootPost.Id)] = []byte("other")
+		defer delete(kv.data, threadLockKey(rootPost.Id))
+
+		resp, isUserError, err := plugin.runDetachMessageCommand([]string{postToBeDetached.Id}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, fmt.Sprintf("Error: the thread with root message ID %s is being wrangled by another user", rootPost.Id))
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("detach message successfully", func(t *testing.T) {
+		resp, isUserError, err := plugin.runDetachMessageCommand([]string{postToBeDetached.Id}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "Message successfully detached from thread")
+
+		var audited *auditEntry
+		for _, call := range api.Calls {
+			if call.Method == "KVSet" && strings.HasPrefix(call.Arguments.String(0), auditKeyPrefix) {
+				audited = &auditEntry{}
+				require.NoError(t, json.Unmarshal(call.Arguments.Get(1).([]byte), audited))
+			}
+		}
+		require.NotNil(t, audited)
+		assert.Equal(t, operationTypeDetach, audited.Type)
+		assert.Equal(t, auditOutcomeSucceeded, audited.Outcome)
+		assert.Equal(t, []string{rootPost.Id}, audited.OriginalRootIDs)
+		assert.Equal(t, channel1.Id, audited.TargetChannelID)
+	})
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const flattenThreadUsage = `/wrangler flatten thread [MESSAGE_ID]
+  Flatten a thread by recreating each of its replies as a message in the channel
+    - The root message is left as a normal message and replies keep their original order
+    - Obtain the message ID by running '/wrangler list messages' or via the 'Permalink' message dropdown option (it's the last part of the URL)`
+
+func getFlattenThreadMessage() string {
+	return codeBlock(fmt.Sprintf("`Error: missing arguments\n\n%s", flattenThreadUsage))
+}
+
+func (p *Plugin) runFlattenThreadCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	if len(args) < 1 {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, getFlattenThreadMessage()), true, nil
+	}
+	postID := args[0]
+
+	postListResponse, appErr := p.API.GetPostThread(postID)
+	if appErr != nil {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: unable to get post with ID %s; ensure this is correct", postID)), true, nil
+	}
+	wpl := buildWranglerPostList(postListResponse)
+
+	originalChannel, appErr := p.API.GetChannel(extra.ChannelId)
+	if appErr != nil {
+		return nil, false, fmt.Errorf("unable to get channel with ID %s", extra.ChannelId)
+	}
+
+	// The thread stays in the same channel, so the channel is both the
+	// original and the target of the operation.
+	response, userErr, err := p.validateMoveOrCopy(wpl, originalChannel, originalChannel, extra)
+	if response != nil || err != nil {
+		return response, userErr, err
+	}
+
+	if wpl.NumPosts() < 2 {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: the thread has no replies to flatten"), true, nil
+	}
+
+	p.API.LogInfo("Wrangler is flattening a thread",
+		"user_id", extra.UserId,
+		"root_post_id", wpl.RootPost().Id,
+		"channel_id", originalChannel.Id,
+	)
+
+	replies := buildWranglerPostListFromPosts(wpl.Posts[1:])
+	op := p.startOperation(operationTypeFlatten, extra.UserId)
+	response, err = p.lockThreads(op, wpl.RootPost().Id)
+	if response != nil || err != nil {
+		return response, response != nil, err
+	}
+	defer op.unlock()
+	op.startAudit([]*model.Channel{originalChannel}, originalChannel, replies.Posts, "", nil)
+	err = p.flattenWranglerPostlist(replies, op)
+	if err != nil {
+		return p.rollbackResponse(op, err)
+	}
+
+	// The root post is left untouched, so only the replies are removed.
+	op.beginDeletes(getPostIDs(replies.Posts)...)
+	for i, post := range replies.Posts {
+		appErr = p.API.DeletePost(post.Id)
+		if appErr != nil {
+			err = errors.Wrap(appErr, "unable to delete post")
+			if i == 0 {
+				return p.rollbackResponse(op, err)
+			}
+			return p.partialDeleteResponse(op, err)
+		}
+	}
+	p.finishOperation(op)
+
+	p.API.LogInfo("Wrangler thread flatten complete",
+		"user_id", extra.UserId,
+		"root_post_id", wpl.RootPost().Id,
+		"flattened_post_count", fmt.Sprintf("%d", replies.NumPosts()),
+	)
+
+	return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("A thread with %d replies has been flattened", replies.NumPosts())), false, nil
+}
+
+// flattenWranglerPostlist recreates every post in the post list as a root post
+// in its own channel. Original timestamps are kept so the new posts appear in
+// the channel in the same order the replies were made. Created posts and
+// re-uploaded files are recorded in the operation.
+func (p *Plugin) flattenWranglerPostlist(wpl *WranglerPostList, op *operation) error {
+	var err error
+	var appErr *model.AppError
+
+	if wpl.ContainsFileAttachments() {
+		// The thread contains at least one attachment. To properly recreate
+		// the replies, the files will have to be re-uploaded. This is
+		// completed before any messages are recreated.
+		p.API.LogInfo("Wrangler is re-uploading file attachments",
+			"file_count", wpl.FileAttachmentCount,
+		)
+
+		for _, post := range wpl.Posts {
+			newFileIDs, err := p.reuploadFileAttachments(post.FileIds, post.ChannelId)
+			op.recordUploadedFiles(newFileIDs)
+			if err != nil {
+				return errors.Wrapf(err, "unable to re-upload files of message %s", post.Id)
+			}
+
+			post.FileIds = newFileIDs
+		}
+	}
+
+	for _, post := range wpl.Posts {
+		var reactions []*model.Reaction
+
+		// Store reactions to be reapplied later.
+		reactions, appErr = p.API.GetReactions(post.Id)
+		if appErr != nil {
+			// Reaction-based errors are logged, but do not cause the plugin to
+			// abort the flatten thread process.
+			p.API.LogError("Failed to get reactions on original post", "err", appErr)
+		}
+
+		newPost := post.Clone()
+		cleanPostID(newPost)
+		newPost.RootId = ""
+		newPost.ParentId = ""
+
+		newPost, err = p.createPostWithRetries(newPost, retryBaseDelay, retryMaxRetries)
+		if err != nil {
+			return errors.Wrapf(err, "unable to create new post for message %s", post.Id)
+		}
+		op.recordPost(post, newPost)
+
+		p.reapplyReactions(reactions, newPost.Id)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlattenThreadCommand(t *testing.T) {
+	team1 := &model.Team{
+		Id:   model.NewId(),
+		Name: "team-1",
+	}
+	channel1 := &model.Channel{
+		Id:     model.NewId(),
+		TeamId: team1.Id,
+		Name:   "channel1",
+		Type:   model.CHANNEL_OPEN,
+	}
+	privateChannel := &model.Channel{
+		Id:     model.NewId(),
+		TeamId: team1.Id,
+		Name:   "private-channel",
+		Type:   model.CHANNEL_PRIVATE,
+	}
+
+	generatedPosts := mockGenerateThread(4, channel1.Id)
+	wpl := buildWranglerPostList(generatedPosts)
+	rootPostID := wpl.RootPost().Id
+	singlePost := mockGenerateThread(1, channel1.Id)
+	singlePostID := buildWranglerPostList(singlePost).RootPost().Id
+
+	api := &plugintest.API{}
+	api.On("GetPost", rootPostID).Return(wpl.RootPost(), nil)
+	api.On("GetChannel", channel1.Id).Return(channel1, nil)
+	api.On("GetChannel", privateChannel.Id).Return(privateChannel, nil)
+	api.On("GetPostThread", rootPostID).Return(generatedPosts, nil)
+	api.On("GetPostThread", singlePostID).Return(singlePost, nil)
+	api.On("CreatePost", mock.Anything).Return(mockGeneratePost(), nil)
+
+	plugin, kv := setupCommandTestPlugin(api, nil)
+
+	t.Run("no args", func(t *testing.T) {
+		resp, isUserError, err := plugin.runFlattenThreadCommand([]string{}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: missing arguments")
+	})
+
+	t.Run("private channel disabled", func(t *testing.T) {
+		resp, isUserError, err := plugin.runFlattenThreadCommand([]string{rootPostID}, &model.CommandArgs{ChannelId: privateChannel.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "Wrangler is currently configured to not allow moving posts from private channels")
+	})
+
+	t.Run("inside thread", func(t *testing.T) {
+		resp, isUserError, err := plugin.runFlattenThreadCommand([]string{rootPostID}, &model.CommandArgs{ChannelId: channel1.Id, RootId: rootPostID})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: this command cannot be run from inside the thread")
+	})
+
+	t.Run("no replies", func(t *testing.T) {
+		resp, isUserError, err := plugin.runFlattenThreadCommand([]string{singlePostID}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: the thread has no replies to flatten")
+	})
+
+	t.Run("thread locked by another operation", func(t *testing.T) {
+		kv.data[threadLockKey(rootPostID)] = []byte("other")
+		defer delete(kv.data, threadLockKey(rootPostID))
+
+		resp, isUserError, err := plugin.runFlattenThreadCommand([]string{rootPostID}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, fmt.Sprintf("Error: the thread with root message ID %s is being wrangled by another user", rootPostID))
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("flatten thread successfully", func(t *testing.T) {
+		resp, isUserError, err := plugin.runFlattenThreadCommand([]string{rootPostID}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "A thread with 3 replies has been flattened")
+		api.AssertNotCalled(t, "DeletePost", rootPostID)
+		api.AssertNumberOfCalls(t, "DeletePost", 3)
+		api.AssertNumberOfCalls(t, "CreatePost", 3)
+	})
+}
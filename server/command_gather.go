@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+const (
+	gatherUsage = `/wrangler gather [MESSAGE_ID...] [flags]
+  Gather messages that are not in a thread into one new thread in this channel
+    - The oldest gathered message becomes the root message of the thread
+    - Provide either message IDs or a time range to select messages
+    - Obtain the message IDs by running '/wrangler list messages' or via the 'Permalink' message dropdown option (it's the last part of the URL)
+	Flags:
+%s`
+
+	flagGatherSince = "since"
+	flagGatherUntil = "until"
+	flagGatherUser  = "user"
+)
+
+type gatherOptions struct {
+	postIDs  []string
+	since    int64
+	until    int64
+	username string
+}
+
+func getGatherFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("gather", pflag.ContinueOnError)
+	flagSet.String(flagGatherSince, "", "Gather messages posted after this time. Accepts a duration such as 30m, 2h or 7d or an RFC3339 timestamp")
+	flagSet.String(flagGatherUntil, "", "Gather messages posted before this time. Accepts a duration such as 30m, 2h or 7d or an RFC3339 timestamp")
+	flagSet.String(flagGatherUser, "", "Only gather messages posted by this username")
+
+	return flagSet
+}
+
+func parseGatherArgs(args []string, now time.Time) (gatherOptions, error) {
+	var options gatherOptions
+
+	flagSet := getGatherFlagSet()
+	err := flagSet.Parse(args)
+	if err != nil {
+		return options, errors.Wrap(err, "unable to parse gather flag args")
+	}
+	options.postIDs = flagSet.Args()
+
+	since, err := flagSet.GetString(flagGatherSince)
+	if err != nil {
+		return options, err
+	}
+	until, err := flagSet.GetString(flagGatherUntil)
+	if err != nil {
+		return options, err
+	}
+	username, err := flagSet.GetString(flagGatherUser)
+	if err != nil {
+		return options, err
+	}
+	options.username = strings.TrimPrefix(username, "@")
+
+	if len(options.postIDs) != 0 {
+		if len(since) != 0 || len(until) != 0 || len(options.username) != 0 {
+			return options, errors.New("messages can be selected by ID or by flags, but not both")
+		}
+		return options, nil
+	}
+
+	if len(since) == 0 {
+		return options, errors.Errorf("either message IDs or --%s must be provided", flagGatherSince)
+	}
+	options.since, err = parseTimeFlag(since, now)
+	if err != nil {
+		return options, errors.Wrapf(err, "invalid --%s value", flagGatherSince)
+	}
+	options.until = model.GetMillisForTime(now)
+	if len(until) != 0 {
+		options.until, err = parseTimeFlag(until, now)
+		if err != nil {
+			return options, errors.Wrapf(err, "invalid --%s value", flagGatherUntil)
+		}
+	}
+	if options.until < options.since {
+		return options, errors.Errorf("--%s must be before --%s", flagGatherSince, flagGatherUntil)
+	}
+
+	return options, nil
+}
+
+func getGatherUsage() string {
+	return fmt.Sprintf(gatherUsage, getGatherFlagSet().FlagUsages())
+}
+
+func getGatherMessage() string {
+	return codeBlock(fmt.Sprintf("`Error: missing arguments\n\n%s", getGatherUsage()))
+}
+
+func (p *Plugin) runGatherCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	if len(args) < 1 {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, getGatherMessage()), true, nil
+	}
+	options, err := parseGatherArgs(args, time.Now())
+	if err != nil {
+		return nil, true, err
+	}
+
+	var posts []*model.Post
+	if len(options.postIDs) != 0 {
+		for _, postID := range options.postIDs {
+			post, appErr := p.API.GetPost(postID)
+			if appErr != nil {
+				return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: unable to get message with ID %s; ensure this is correct", postID)), true, nil
+			}
+			posts = append(posts, post)
+		}
+	} else {
+		posts, err = p.selectUnthreadedChannelPosts(extra.ChannelId, options.since, options.until, options.username)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	posts = uniquePosts(posts)
+	for _, post := range posts {
+		response := validateAttachPost(post, extra)
+		if response != nil {
+			return response, true, nil
+		}
+	}
+	if len(posts) < 2 {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: at least two messages are needed to gather into a thread, but %d were found", len(posts))), true, nil
+	}
+
+	// We now know:
+	// 1. All of the posts exist and are in the channel the command was run
+	//    from, so the user is also a member of that channel.
+	// 2. None of the posts are part of a thread already.
+
+	currentTeam, appErr := p.API.GetTeam(extra.TeamId)
+	if appErr != nil {
+		return nil, false, errors.Wrap(appErr, "failed to lookup lookup team")
+	}
+	channel, appErr := p.API.GetChannel(extra.ChannelId)
+	if appErr != nil {
+		return nil, false, errors.Wrap(appErr, "failed to lookup channel")
+	}
+
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].CreateAt < posts[j].CreateAt
+	})
+	rootPost := posts[0]
+
+	p.API.LogInfo("Wrangler is gathering messages into a thread",
+		"user_id", extra.UserId,
+		"root_post_id", rootPost.Id,
+		"gather_message_count", fmt.Sprintf("%d", len(posts)),
+	)
+
+	var attachedUserIDs []string
+	notifiedUserIDs := make(map[string]bool)
+	op := p.startOperation(operationTypeGather, extra.UserId)
+	// Each gathered message is the root of its own thread until it has been
+	// attached, so all of them are locked.
+	response, err := p.lockThreads(op, getPostIDs(posts)...)
+	if response != nil || err != nil {
+		return response, response != nil, err
+	}
+	defer op.unlock()
+	op.startAudit([]*model.Channel{channel}, channel, posts[1:], rootPost.Id, getSetFlags(getGatherFlagSet(), args))
+	for _, post := range posts[1:] {
+		_, err = p.attachPostToThread(post, rootPost.Id, rootPost.ChannelId, op)
+		if err != nil {
+			return p.rollbackResponse(op, err)
+		}
+		if post.UserId != extra.UserId && !notifiedUserIDs[post.UserId] {
+			notifiedUserIDs[post.UserId] = true
+			attachedUserIDs = append(attachedUserIDs, post.UserId)
+		}
+	}
+
+	// The original messages are only deleted once every message has been
+	// gathered so that a failure can be rolled back.
+	op.beginDeletes(getPostIDs(posts[1:])...)
+	for i, post := range posts[1:] {
+		appErr = p.API.DeletePost(post.Id)
+		if appErr != nil {
+			err = errors.Wrap(appErr, "unable to delete post")
+			if i == 0 {
+				return p.rollbackResponse(op, err)
+			}
+			return p.partialDeleteResponse(op, err)
+		}
+	}
+	p.finishOperation(op)
+
+	p.API.LogInfo("Wrangler has gathered messages into a thread",
+		"user_id", extra.UserId,
+		"root_post_id", rootPost.Id,
+		"gather_message_count", fmt.Sprintf("%d", len(posts)),
+	)
+
+	newPostLink := makePostLink(*p.API.GetConfig().ServiceSettings.SiteURL, currentTeam.Name, rootPost.Id)
+
+	executor, appErr := p.API.GetUser(extra.UserId)
+	if appErr != nil {
+		return nil, false, errors.Wrap(appErr, "unable to find executor")
+	}
+
+	for _, userID := range attachedUserIDs {
+		// The wrangled messages were not created by the user running the
+		// command. Send a DM to each user who created one to let them know.
+		err = p.postAttachMessageBotDM(userID, newPostLink, executor.Username)
+		if err != nil {
+			p.API.LogError("Unable to send attach-message DM to user",
+				"error", err.Error(),
+				"user_id", userID,
+			)
+		}
+	}
+
+	return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("%d messages have been gathered into a thread: %s", len(posts), newPostLink)), false, nil
+}
+
+// selectUnthreadedChannelPosts returns the posts in a channel that were
+// created in the given time range and are neither replies nor the root of a
+// thread. When a username is provided, only posts from that user are returned.
+func (p *Plugin) selectUnthreadedChannelPosts(channelID string, since, until int64, username string) ([]*model.Post, error) {
+	var userID string
+	if len(username) != 0 {
+		user, appErr := p.API.GetUserByUsername(username)
+		if appErr != nil {
+			return nil, errors.Wrapf(appErr, "unable to find user %s", username)
+		}
+		userID = user.Id
+	}
+
+	channelPosts, err := p.getChannelPostsSince(channelID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	// Replies are always newer than their root post, so every reply to a root
+	// post in the time range is also in the list of channel posts.
+	threadRootIDs := make(map[string]bool)
+	for _, post := range channelPosts {
+		if len(post.RootId) != 0 {
+			threadRootIDs[post.RootId] = true
+		}
+	}
+
+	var posts []*model.Post
+	for _, post := range channelPosts {
+		if post.CreateAt > until || post.IsSystemMessage() {
+			continue
+		}
+		if len(post.RootId) != 0 || threadRootIDs[post.Id] {
+			continue
+		}
+		if len(userID) != 0 && post.UserId != userID {
+			continue
+		}
+		posts = append(posts, post)
+	}
+
+	return posts, nil
+}
+
+func uniquePosts(posts []*model.Post) []*model.Post {
+	var unique []*model.Post
+	seen := make(map[string]bool)
+	for _, post := range posts {
+		if seen[post.Id] {
+			continue
+		}
+		seen[post.Id] = true
+		unique = append(unique, post)
+	}
+
+	return unique
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatherCommand(t *testing.T) {
+	team1 := &model.Team{
+		Id:   model.NewId(),
+		Name: "team-1",
+	}
+	channel1 := &model.Channel{
+		Id:     model.NewId(),
+		TeamId: team1.Id,
+		Name:   "channel1",
+		Type:   model.CHANNEL_OPEN,
+	}
+	user := &model.User{
+		Id:       model.NewId(),
+		Username: "user1",
+	}
+
+	now := model.GetMillis()
+	oldestPost := &model.Post{
+		Id:        model.NewId(),
+		UserId:    user.Id,
+		ChannelId: channel1.Id,
+		CreateAt:  now - 3000,
+	}
+	newerPost := &model.Post{
+		Id:        model.NewId(),
+		UserId:    user.Id,
+		ChannelId: channel1.Id,
+		CreateAt:  now - 2000,
+	}
+	otherUserPost := &model.Post{
+		Id:        model.NewId(),
+		UserId:    model.NewId(),
+		ChannelId: channel1.Id,
+		CreateAt:  now - 1500,
+	}
+	threadRootPost := &model.Post{
+		Id:        model.NewId(),
+		UserId:    user.Id,
+		ChannelId: channel1.Id,
+		CreateAt:  now - 1000,
+	}
+	replyPost := &model.Post{
+		Id:        model.NewId(),
+		UserId:    user.Id,
+		ChannelId: channel1.Id,
+		RootId:    threadRootPost.Id,
+		ParentId:  threadRootPost.Id,
+		CreateAt:  now - 500,
+	}
+	postInAnotherChannel := &model.Post{
+		Id:        model.NewId(),
+		ChannelId: model.NewId(),
+	}
+
+	channelPosts := model.NewPostList()
+	for _, post := range []*model.Post{replyPost, threadRootPost, otherUserPost, newerPost, oldestPost} {
+		channelPosts.AddPost(post)
+		channelPosts.AddOrder(post.Id)
+	}
+
+	config := &model.Config{
+		ServiceSettings: model.ServiceSettings{
+			SiteURL: NewString("test.sampledomain.com"),
+		},
+	}
+
+	api := &plugintest.API{}
+	api.On("GetPost", oldestPost.Id).Return(oldestPost.Clone(), nil)
+	api.On("GetPost", newerPost.Id).Return(newerPost.Clone(), nil)
+	api.On("GetPost", replyPost.Id).Return(replyPost.Clone(), nil)
+	api.On("GetPost", postInAnotherChannel.Id).Return(postInAnotherChannel, nil)
+	api.On("GetPost", mock.AnythingOfType("string")).Return(nil, model.NewAppError("where", model.NewId(), nil, "not found", 0))
+	api.On("GetPostsForChannel", channel1.Id, 0, channelPostsPerPage).Return(channelPosts, nil)
+	api.On("GetUserByUsername", user.Username).Return(user, nil)
+	api.On("GetUser", mock.AnythingOfType("string")).Return(user, nil)
+	api.On("GetTeam", mock.AnythingOfType("string")).Return(team1, nil)
+	api.On("GetChannel", channel1.Id).Return(channel1, nil)
+	api.On("CreatePost", mock.Anything).Return(mockGeneratePost(), nil)
+
+	plugin, kv := setupCommandTestPlugin(api, config)
+
+	t.Run("no args", func(t *testing.T) {
+		resp, isUserError, err := plugin.runGatherCommand([]string{}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: missing arguments")
+	})
+
+	t.Run("IDs and flags", func(t *testing.T) {
+		_, isUserError, err := plugin.runGatherCommand([]string{oldestPost.Id, "--since", "1h"}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.Error(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, err.Error(), "messages can be selected by ID or by flags, but not both")
+	})
+
+	t.Run("flags without since", func(t *testing.T) {
+		_, isUserError, err := plugin.runGatherCommand([]string{"--user", user.Username}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.Error(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, err.Error(), "either message IDs or --since must be provided")
+	})
+
+	t.Run("invalid message ID", func(t *testing.T) {
+		resp, isUserError, err := plugin.runGatherCommand([]string{oldestPost.Id, model.NewId()}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: unable to get message with ID")
+	})
+
+	t.Run("message in another channel", func(t *testing.T) {
+		resp, isUserError, err := plugin.runGatherCommand([]string{oldestPost.Id, postInAnotherChannel.Id}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: the attach command must be run from the channel containing the messages")
+	})
+
+	t.Run("message already in a thread", func(t *testing.T) {
+		resp, isUserError, err := plugin.runGatherCommand([]string{oldestPost.Id, replyPost.Id}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: the message to be attached is already part of a thread")
+	})
+
+	t.Run("single message", func(t *testing.T) {
+		resp, isUserError, err := plugin.runGatherCommand([]string{oldestPost.Id, oldestPost.Id}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: at least two messages are needed to gather into a thread, but 1 were found")
+	})
+
+	t.Run("message locked by another operation", func(t *testing.T) {
+		kv.data[threadLockKey(newerPost.Id)] = []byte("other")
+		defer delete(kv.data, threadLockKey(newerPost.Id))
+
+		resp, isUserError, err := plugin.runGatherCommand([]string{newerPost.Id, oldestPost.Id}, &model.CommandArgs{ChannelId: channel1.Id, UserId: user.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, fmt.Sprintf("Error: the thread with root message ID %s is being wrangled by another user", newerPost.Id))
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("gather by ID successfully", func(t *testing.T) {
+		resp, isUserError, err := plugin.runGatherCommand([]string{newerPost.Id, oldestPost.Id}, &model.CommandArgs{ChannelId: channel1.Id, UserId: user.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "2 messages have been gathered into a thread")
+		api.AssertCalled(t, "CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+			return post.RootId == oldestPost.Id
+		}))
+		api.AssertCalled(t, "DeletePost", newerPost.Id)
+		api.AssertNotCalled(t, "DeletePost", oldestPost.Id)
+
+		var audited *auditEntry
+		for _, call := range api.Calls {
+			if call.Method == "KVSet" && strings.HasPrefix(call.Arguments.String(0), auditKeyPrefix) {
+				audited = &auditEntry{}
+				require.NoError(t, json.Unmarshal(call.Arguments.Get(1).([]byte), audited))
+			}
+		}
+		require.NotNil(t, audited)
+		assert.Equal(t, operationTypeGather, audited.Type)
+		assert.Equal(t, oldestPost.Id, audited.NewRootID)
+		assert.Equal(t, 1, audited.PostCount)
+	})
+
+	t.Run("gather by flags successfully", func(t *testing.T) {
+		options, err := parseGatherArgs([]string{"--since", "1h", "--user", "@" + user.Username}, time.Now())
+		require.NoError(t, err)
+		posts, err := plugin.selectUnthreadedChannelPosts(channel1.Id, options.since, options.until, options.username)
+		require.NoError(t, err)
+		require.Len(t, posts, 2)
+		assert.Equal(t, newerPost.Id, posts[0].Id)
+		assert.Equal(t, oldestPost.Id, posts[1].Id)
+
+		resp, isUserError, err := plugin.runGatherCommand([]string{"--since", "1h", "--user", "@" + user.Username}, &model.CommandArgs{ChannelId: channel1.Id, UserId: user.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "2 messages have been gathered into a thread")
+	})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const jobsUsage = `/wrangler jobs
+  List your running and recent background jobs
+    - Move, copy and merge operations with many messages run in the background
+
+/wrangler jobs cancel [JOB_ID]
+  Cancel one of your running background jobs
+    - Messages created by the job are removed and the original messages are left unchanged
+
+/wrangler jobs resume [OPERATION_ID]
+  Resume operations that were interrupted and could not resume on their own
+    - Only available to system administrators
+    - Operations that were still creating messages are rolled back and the rest are finished
+    - When no operation ID is provided, every interrupted operation is resumed`
+
+func getJobsCancelMessage() string {
+	return codeBlock(fmt.Sprintf("Error: missing arguments\n\n%s", jobsUsage))
+}
+
+func (p *Plugin) runJobsCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "cancel":
+			return p.runCancelJobCommand(args[1:], extra)
+		case "resume":
+			return p.runResumeJobsCommand(args[1:], extra)
+		}
+	}
+
+	jobIDs, err := p.getUserJobIDs(extra.UserId)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(jobIDs) == 0 {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "You have no background jobs"), false, nil
+	}
+
+	msg := "#### Wrangler jobs\n"
+	for _, jobID := range jobIDs {
+		var j *job
+		if rj := p.getRunningJob(jobID); rj != nil {
+			snapshot := rj.snapshot()
+			j = &snapshot
+		} else {
+			j, err = p.getJob(jobID)
+			if err != nil {
+				return nil, false, err
+			}
+			if j == nil {
+				continue
+			}
+			if j.Status == jobStatusRunning {
+				// The job was interrupted before it could finish, such as
+				// by the server stopping unexpectedly.
+				j.Status = "interrupted"
+			}
+		}
+
+		msg += fmt.Sprintf("- %s: %s operation %s, %s, started %s\n",
+			inlineCode(j.ID),
+			j.Type,
+			inlineCode(j.OperationID),
+			j.progressText(),
+			time.Unix(0, j.CreateAt*int64(time.Millisecond)).UTC().Format(time.RFC822),
+		)
+	}
+
+	return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, msg), false, nil
+}
+
+func (p *Plugin) runCancelJobCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	if len(args) < 1 {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, getJobsCancelMessage()), true, nil
+	}
+	jobID := args[0]
+
+	rj := p.getRunningJob(jobID)
+	if rj == nil {
+		j, err := p.getJob(jobID)
+		if err != nil {
+			return nil, false, err
+		}
+		if j == nil || j.UserID != extra.UserId {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: unable to find job with ID %s; ensure this is correct", jobID)), true, nil
+		}
+
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: job %s is not running", jobID)), true, nil
+	}
+
+	if rj.snapshot().UserID != extra.UserId {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: unable to find job with ID %s; ensure this is correct", jobID)), true, nil
+	}
+
+	rj.cancel("")
+
+	p.API.LogInfo("Wrangler background job canceled",
+		"user_id", extra.UserId,
+		"job_id", jobID,
+	)
+
+	return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Job %s is being canceled. Messages it created so far will be removed and the result will be posted in its status message.", inlineCode(jobID))), false, nil
+}
+
+func (p *Plugin) runResumeJobsCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	user, appErr := p.API.GetUser(extra.UserId)
+	if appErr != nil {
+		return nil, false, errors.Wrap(appErr, "unable to find user")
+	}
+	if !user.IsSystemAdmin() {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: only system administrators can resume interrupted operations"), true, nil
+	}
+
+	var operationIDs []string
+	if len(args) > 0 {
+		operationIDs = args[:1]
+	} else {
+		var err error
+		operationIDs, err = p.getCheckpointOperationIDs()
+		if err != nil {
+			return nil, false, err
+		}
+		if len(operationIDs) == 0 {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "There are no interrupted operations to resume"), false, nil
+		}
+	}
+
+	now := time.Now()
+	msg := "#### Resumed operations\n"
+	for _, operationID := range operationIDs {
+		cp, err := p.getCheckpoint(operationID)
+		if err != nil {
+			return nil, false, err
+		}
+		if cp == nil {
+			if len(args) > 0 {
+				return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: unable to find an interrupted operation with ID %s; ensure this is correct", operationID)), true, nil
+			}
+			continue
+		}
+		if !cp.resumable(now) {
+			msg += fmt.Sprintf("- %s: %s operation is still running; it can be resumed once it has made no progress for %d minutes\n", inlineCode(operationID), cp.Operation.Type, int(checkpointStaleAfter.Minutes()))
+			continue
+		}
+
+		outcome, err := p.resumeOperation(cp)
+		if err != nil {
+			msg += fmt.Sprintf("- %s: %s operation could not be resumed: %s\n", inlineCode(operationID), cp.Operation.Type, err.Error())
+			continue
+		}
+		msg += fmt.Sprintf("- %s: %s operation %s\n", inlineCode(operationID), cp.Operation.Type, outcome)
+	}
+
+	return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, msg), false, nil
+}
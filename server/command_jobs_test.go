@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobsCommand(t *testing.T) {
+	userID := model.NewId()
+	otherUserID := model.NewId()
+
+	finishedJob := &job{
+		ID:          model.NewId(),
+		OperationID: model.NewId(),
+		Type:        operationTypeCopy,
+		UserID:      userID,
+		Status:      jobStatusSucceeded,
+		Total:       120,
+		Done:        120,
+		CreateAt:    model.GetMillis(),
+	}
+	interruptedJob := &job{
+		ID:          model.NewId(),
+		OperationID: model.NewId(),
+		Type:        operationTypeMerge,
+		UserID:      userID,
+		Status:      jobStatusRunning,
+		Total:       300,
+		Done:        42,
+		CreateAt:    model.GetMillis(),
+	}
+	runningUserJob := &runningJob{
+		job: &job{
+			ID:          model.NewId(),
+			OperationID: model.NewId(),
+			Type:        operationTypeMove,
+			UserID:      userID,
+			Status:      jobStatusRunning,
+			Total:       200,
+			Done:        50,
+			CreateAt:    model.GetMillis(),
+		},
+		cancelCh: make(chan struct{}),
+	}
+	runningOtherJob := &runningJob{
+		job: &job{
+			ID:     model.NewId(),
+			UserID: otherUserID,
+			Status: jobStatusRunning,
+		},
+		cancelCh: make(chan struct{}),
+	}
+
+	finishedJobData, err := json.Marshal(finishedJob)
+	require.NoError(t, err)
+	interruptedJobData, err := json.Marshal(interruptedJob)
+	require.NoError(t, err)
+	userJobsData, err := json.Marshal([]string{runningUserJob.job.ID, interruptedJob.ID, finishedJob.ID})
+	require.NoError(t, err)
+
+	api := &plugintest.API{}
+	api.On("KVGet", userJobsKey(userID)).Return(userJobsData, nil)
+	api.On("KVGet", userJobsKey(otherUserID)).Return(nil, nil)
+	api.On("KVGet", jobKey(finishedJob.ID)).Return(finishedJobData, nil)
+	api.On("KVGet", jobKey(interruptedJob.ID)).Return(interruptedJobData, nil)
+	api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+	api.On("LogInfo",
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+	).Return(nil)
+
+	var plugin Plugin
+	plugin.SetAPI(api)
+	plugin.runningJobs = map[string]*runningJob{
+		runningUserJob.job.ID:  runningUserJob,
+		runningOtherJob.job.ID: runningOtherJob,
+	}
+
+	t.Run("list jobs", func(t *testing.T) {
+		resp, isUserError, err := plugin.runJobsCommand([]string{}, &model.CommandArgs{UserId: userID})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, runningUserJob.job.ID+"`: move operation")
+		assert.Contains(t, resp.Text, "running, 50 of 200 messages")
+		assert.Contains(t, resp.Text, "interrupted after 42 of 300 messages")
+		assert.Contains(t, resp.Text, "succeeded after 120 of 120 messages")
+	})
+
+	t.Run("list no jobs", func(t *testing.T) {
+		resp, isUserError, err := plugin.runJobsCommand([]string{}, &model.CommandArgs{UserId: otherUserID})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Equal(t, "You have no background jobs", resp.Text)
+	})
+
+	t.Run("cancel with no job ID", func(t *testing.T) {
+		resp, isUserError, err := plugin.runJobsCommand([]string{"cancel"}, &model.CommandArgs{UserId: userID})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: missing arguments")
+	})
+
+	t.Run("cancel unknown job", func(t *testing.T) {
+		resp, isUserError, err := plugin.runJobsCommand([]string{"cancel", model.NewId()}, &model.CommandArgs{UserId: userID})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "unable to find job")
+	})
+
+	t.Run("cancel finished job", func(t *testing.T) {
+		resp, isUserError, err := plugin.runJobsCommand([]string{"cancel", finishedJob.ID}, &model.CommandArgs{UserId: userID})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Equal(t, "Error: job "+finishedJob.ID+" is not running", resp.Text)
+	})
+
+	t.Run("cancel another user's job", func(t *testing.T) {
+		resp, isUserError, err := plugin.runJobsCommand([]string{"cancel", runningOtherJob.job.ID}, &model.CommandArgs{UserId: userID})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "unable to find job")
+		assert.False(t, runningOtherJob.isCanceled())
+	})
+
+	t.Run("cancel running job", func(t *testing.T) {
+		resp, isUserError, err := plugin.runJobsCommand([]string{"cancel", runningUserJob.job.ID}, &model.CommandArgs{UserId: userID})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "is being canceled")
+		assert.True(t, runningUserJob.isCanceled())
+	})
+}
+
+func TestJobsResumeCommand(t *testing.T) {
+	admin := &model.User{Id: model.NewId(), Roles: model.SYSTEM_ADMIN_ROLE_ID}
+	user := &model.User{Id: model.NewId(), Roles: model.SYSTEM_USER_ROLE_ID}
+	createdPost := mockGeneratePost()
+
+	api := &plugintest.API{}
+	newMockKVStore(api)
+	api.On("GetUser", admin.Id).Return(admin, nil)
+	api.On("GetUser", user.Id).Return(user, nil)
+	api.On("GetPost", createdPost.Id).Return(createdPost, nil)
+	api.On("DeletePost", createdPost.Id).Return(nil)
+	api.On("GetDirectChannel", user.Id, mock.AnythingOfType("string")).Return(&model.Channel{Id: model.NewId()}, nil)
+	api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(mockGeneratePost(), nil)
+	api.On("LogInfo",
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+	).Return(nil)
+
+	var plugin Plugin
+	plugin.SetAPI(api)
+
+	op := plugin.startOperation(operationTypeCopy, user.Id)
+	op.recordPost(mockGeneratePost(), createdPost)
+
+	t.Run("not an admin", func(t *testing.T) {
+		resp, isUserError, err := plugin.runJobsCommand([]string{"resume"}, &model.CommandArgs{UserId: user.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Equal(t, "Error: only system administrators can resume interrupted operations", resp.Text)
+	})
+
+	t.Run("unknown operation", func(t *testing.T) {
+		resp, isUserError, err := plugin.runJobsCommand([]string{"resume", model.NewId()}, &model.CommandArgs{UserId: admin.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "unable to find an interrupted operation")
+	})
+
+	t.Run("operation still running", func(t *testing.T) {
+		resp, isUserError, err := plugin.runJobsCommand([]string{"resume"}, &model.CommandArgs{UserId: admin.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, op.ID+"`: copy operation is still running")
+		api.AssertNotCalled(t, "DeletePost", createdPost.Id)
+	})
+
+	t.Run("resume failed operation", func(t *testing.T) {
+		op.checkpointError = "unable to delete post"
+		op.checkpoint(true)
+
+		resp, isUserError, err := plugin.runJobsCommand([]string{"resume", op.ID}, &model.CommandArgs{UserId: admin.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, op.ID+"`: copy operation rolled back")
+		api.AssertCalled(t, "DeletePost", createdPost.Id)
+	})
+
+	t.Run("nothing to resume", func(t *testing.T) {
+		resp, isUserError, err := plugin.runJobsCommand([]string{"resume"}, &model.CommandArgs{UserId: admin.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Equal(t, "There are no interrupted operations to resume", resp.Text)
+	})
+}
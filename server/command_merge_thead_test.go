@@ -69,6 +69,7 @@ func TestMergeThreadCommand(t *testing.T) {
 
 	generatedTargetPosts := mockGeneratePostList(3, targetChannel.Id, false)
 	generatedOriginalPosts := mockGeneratePostList(3, originalChannel.Id, false)
+	generatedSecondOriginalPosts := mockGeneratePostList(2, originalChannel.Id, false)
 	generatedPrivatePosts := mockGeneratePostList(3, privateChannel.Id, false)
 	generatedDirectPosts := mockGeneratePostList(3, directChannel.Id, false)
 	generatedGroupPosts := mockGeneratePostList(3, groupChannel.Id, false)
@@ -79,11 +80,21 @@ func TestMergeThreadCommand(t *testing.T) {
 
 	targetPostID := generatedTargetPosts.ToSlice()[0].Id
 	originalPostID := generatedOriginalPosts.ToSlice()[0].Id
+	secondOriginalPostID := generatedSecondOriginalPosts.ToSlice()[0].Id
 	privatePostID := generatedPrivatePosts.ToSlice()[0].Id
 	directPostID := generatedDirectPosts.ToSlice()[0].Id
 	groupPostID := generatedGroupPosts.ToSlice()[0].Id
 	oldPostID := oldGeneratedPosts.ToSlice()[0].Id
 
+	posts := newMockPostStore()
+	posts.addThread(originalPostID, generatedOriginalPosts)
+	posts.addThread(secondOriginalPostID, generatedSecondOriginalPosts)
+	posts.addThread(privatePostID, generatedPrivatePosts)
+	posts.addThread(directPostID, generatedDirectPosts)
+	posts.addThread(groupPostID, generatedGroupPosts)
+	posts.addThread(targetPostID, generatedTargetPosts)
+	posts.addThread(oldPostID, oldGeneratedPosts)
+
 	api := &plugintest.API{}
 
 	api.On("GetChannel", originalChannel.Id).Return(originalChannel, nil)
@@ -93,21 +104,13 @@ func TestMergeThreadCommand(t *testing.T) {
 	api.On("GetChannel", targetChannel.Id).Return(targetChannel, nil)
 	api.On("GetChannel", oldPostID).Return(targetChannel, nil)
 
-	api.On("GetPostThread", originalPostID).Return(generatedOriginalPosts, nil)
-	api.On("GetPostThread", privatePostID).Return(generatedPrivatePosts, nil)
-	api.On("GetPostThread", directPostID).Return(generatedDirectPosts, nil)
-	api.On("GetPostThread", groupPostID).Return(generatedGroupPosts, nil)
-	api.On("GetPostThread", targetPostID).Return(generatedTargetPosts, nil)
-	api.On("GetPostThread", oldPostID).Return(oldGeneratedPosts, nil)
+	api.On("GetPostThread", mock.AnythingOfType("string")).Return(posts.getPostThread, nil)
+	api.On("GetPost", mock.AnythingOfType("string")).Return(mockGeneratePost(), nil)
 
-	api.On("GetChannelMember", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(mockGenerateChannelMember(), nil)
 	api.On("GetTeam", mock.AnythingOfType("string")).Return(targetTeam, nil)
 	api.On("GetUser", mock.AnythingOfType("string")).Return(executor, nil)
-	api.On("CreatePost", mock.Anything).Return(mockGeneratePost(), nil)
-	api.On("DeletePost", mock.AnythingOfType("string")).Return(nil)
+	api.On("CreatePost", mock.Anything).Return(posts.createPost, nil)
 	api.On("GetReactions", mock.AnythingOfType("string")).Return(reactions, nil)
-	api.On("AddReaction", mock.Anything).Return(nil, nil)
-	api.On("GetConfig").Return(config)
 	api.On("LogInfo",
 		mock.AnythingOfTypeArgument("string"),
 		mock.AnythingOfTypeArgument("string"),
@@ -124,8 +127,7 @@ func TestMergeThreadCommand(t *testing.T) {
 		mock.AnythingOfTypeArgument("string"),
 	).Return(nil)
 
-	var plugin Plugin
-	plugin.SetAPI(api)
+	plugin, _ := setupCommandTestPlugin(api, config)
 
 	t.Run("not enabled", func(t *testing.T) {
 		resp, isUserError, err := plugin.runMergeThreadCommand([]string{originalPostID, targetPostID}, &model.CommandArgs{ChannelId: originalChannel.Id})
@@ -233,6 +235,89 @@ func TestMergeThreadCommand(t *testing.T) {
 		require.NoError(t, err)
 		assert.False(t, isUserError)
 		assert.Contains(t, resp.Text, "A thread with 3 message(s) has been merged")
+		assert.Contains(t, resp.Text, "Verified 3 message(s)")
+	})
+
+	t.Run("merge multiple threads", func(t *testing.T) {
+		t.Run("same thread provided twice", func(t *testing.T) {
+			resp, isUserError, err := plugin.runMergeThreadCommand([]string{originalPostID, originalPostID, targetPostID}, &model.CommandArgs{ChannelId: originalChannel.Id})
+			require.NoError(t, err)
+			assert.True(t, isUserError)
+			assert.Contains(t, resp.Text, "was provided more than once")
+		})
+
+		t.Run("one invalid thread prevents all merges", func(t *testing.T) {
+			callCount := len(api.Calls)
+			resp, isUserError, err := plugin.runMergeThreadCommand([]string{originalPostID, oldPostID, targetPostID}, &model.CommandArgs{ChannelId: originalChannel.Id})
+			require.NoError(t, err)
+			assert.True(t, isUserError)
+			assert.Contains(t, resp.Text, "Error: Cannot merge older threads into newer threads")
+			for _, call := range api.Calls[callCount:] {
+				assert.NotEqual(t, "CreatePost", call.Method)
+				assert.NotEqual(t, "DeletePost", call.Method)
+			}
+		})
+
+		t.Run("successfully", func(t *testing.T) {
+			resp, isUserError, err := plugin.runMergeThreadCommand([]string{originalPostID, secondOriginalPostID, targetPostID}, &model.CommandArgs{ChannelId: originalChannel.Id})
+			require.NoError(t, err)
+			assert.False(t, isUserError)
+			assert.Contains(t, resp.Text, "2 threads with a total of 5 message(s) have been merged")
+			assert.Contains(t, resp.Text, ": 3 message(s)")
+			assert.Contains(t, resp.Text, ": 2 message(s)")
+		})
+	})
+
+	t.Run("merge modes", func(t *testing.T) {
+		t.Run("invalid mode", func(t *testing.T) {
+			resp, isUserError, err := plugin.runMergeThreadCommand([]string{originalPostID, targetPostID, "--mode", "shuffle"}, &model.CommandArgs{ChannelId: originalChannel.Id})
+			require.Error(t, err)
+			assert.True(t, isUserError)
+			assert.Nil(t, resp)
+		})
+
+		t.Run("append", func(t *testing.T) {
+			resp, isUserError, err := plugin.runMergeThreadCommand([]string{originalPostID, targetPostID, "--mode", mergeModeAppend}, &model.CommandArgs{ChannelId: originalChannel.Id})
+			require.NoError(t, err)
+			assert.False(t, isUserError)
+			assert.Contains(t, resp.Text, "A thread with 3 message(s) has been merged")
+		})
+
+		t.Run("rebuild", func(t *testing.T) {
+			resp, isUserError, err := plugin.runMergeThreadCommand([]string{originalPostID, targetPostID, "--mode", mergeModeRebuild}, &model.CommandArgs{ChannelId: originalChannel.Id})
+			require.NoError(t, err)
+			assert.False(t, isUserError)
+			assert.Contains(t, resp.Text, "A thread with 3 message(s) has been merged")
+		})
+
+		t.Run("rebuild older thread into newer thread", func(t *testing.T) {
+			resp, isUserError, err := plugin.runMergeThreadCommand([]string{oldPostID, targetPostID, "--mode", mergeModeRebuild}, &model.CommandArgs{ChannelId: originalChannel.Id})
+			require.NoError(t, err)
+			assert.False(t, isUserError)
+			assert.Contains(t, resp.Text, "A thread with 3 message(s) has been merged")
+		})
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		t.Run("allowed", func(t *testing.T) {
+			callCount := len(api.Calls)
+			resp, isUserError, err := plugin.runMergeThreadCommand([]string{originalPostID, secondOriginalPostID, targetPostID, "--dry-run"}, &model.CommandArgs{ChannelId: originalChannel.Id})
+			require.NoError(t, err)
+			assert.False(t, isUserError)
+			assert.Contains(t, resp.Text, "Dry run: merge 2 thread(s) in interleave mode")
+			assert.Contains(t, resp.Text, "- Messages: 5")
+			assert.Contains(t, resp.Text, "This operation would be allowed.")
+			for _, call := range api.Calls[callCount:] {
+				assert.NotContains(t, []string{"CreatePost", "DeletePost", "KVSet"}, call.Method)
+			}
+		})
+
+		t.Run("blocked", func(t *testing.T) {
+			resp, isUserError, err := plugin.runMergeThreadCommand([]string{oldPostID, targetPostID, "--dry-run"}, &model.CommandArgs{ChannelId: originalChannel.Id})
+			require.NoError(t, err)
+			assert.False(t, isUserError)
+			assert.Contains(t, resp.Text, "This operation would be blocked: Error: Cannot merge older threads into newer threads")
+		})
 	})
 
 	t.Run("thread is above configuration move-maximum", func(t *testing.T) {
@@ -244,4 +329,20 @@ func TestMergeThreadCommand(t *testing.T) {
 		assert.True(t, isUserError)
 		assert.Contains(t, resp.Text, "Error: the thread is 3 posts long, but this command is configured to only move threads of up to 1 posts")
 	})
+
+	t.Run("rebuilt thread is above configuration move-maximum", func(t *testing.T) {
+		plugin.configuration.MoveThreadMaxCount = "5"
+		require.NoError(t, plugin.configuration.IsValid())
+
+		resp, isUserError, err := plugin.runMergeThreadCommand([]string{originalPostID, targetPostID, "--mode", mergeModeRebuild}, &model.CommandArgs{ChannelId: originalChannel.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: the rebuilt thread would be")
+		assert.Contains(t, resp.Text, "but this command is configured to only move threads of up to 5 posts")
+
+		resp, isUserError, err = plugin.runMergeThreadCommand([]string{originalPostID, targetPostID, "--mode", mergeModeRebuild, "--dry-run"}, &model.CommandArgs{ChannelId: originalChannel.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "This operation would be blocked: Error: the rebuilt thread would be")
+	})
 }
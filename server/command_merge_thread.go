@@ -2,39 +2,128 @@ package main
 
 import (
 	"fmt"
-	"time"
+	"sort"
 
 	"github.com/mattermost/mattermost-server/v5/model"
 	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
 )
 
-const mergeThreadUsage = `
-/wrangler merge thread [ROOT_MESSAGE_ID] [TARGET_ROOT_MESSAGE_ID]
+const (
+	mergeThreadUsage = `
+/wrangler merge thread [ROOT_MESSAGE_ID] [TARGET_ROOT_MESSAGE_ID] [flags]
   Merge the messages of two threads
-    - Message creation timestamps of both threads will be preserved. This could result in merged threads having messages that seem out of order or with different contexts.
-	- Use the '/wrangler list' commands to get message and channel IDs
-`
+    - Use the '/wrangler list' commands to get message and channel IDs
+
+/wrangler merge threads [ROOT_MESSAGE_ID...] [TARGET_ROOT_MESSAGE_ID] [flags]
+  Merge the messages of multiple threads into one target thread
+    - Every thread is validated before any messages are merged
+	Flags:
+%s`
+
+	flagMergeThreadMode = "mode"
+
+	// mergeModeInterleave preserves message creation timestamps so merged
+	// messages are interleaved with the target thread's replies.
+	mergeModeInterleave = "interleave"
+	// mergeModeAppend gives merged messages new timestamps so they appear
+	// after the target thread's existing replies.
+	mergeModeAppend = "append"
+	// mergeModeRebuild recreates the target thread and the merged threads
+	// together as one new thread in chronological order.
+	mergeModeRebuild = "rebuild"
+)
+
+func getMergeThreadFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("merge thread", pflag.ContinueOnError)
+	flagSet.String(flagMergeThreadMode, mergeModeInterleave, fmt.Sprintf("How merged messages are ordered. One of: %s, %s, %s", mergeModeInterleave, mergeModeAppend, mergeModeRebuild))
+	flagSet.Bool(flagDryRun, false, "Show what would be merged without merging anything")
+
+	return flagSet
+}
+
+type mergeThreadOptions struct {
+	postIDs []string
+	mode    string
+	dryRun  bool
+}
+
+func parseMergeThreadArgs(args []string) (mergeThreadOptions, error) {
+	var options mergeThreadOptions
+
+	flagSet := getMergeThreadFlagSet()
+	err := flagSet.Parse(args)
+	if err != nil {
+		return options, errors.Wrap(err, "unable to parse merge thread flag args")
+	}
+
+	options.mode, err = flagSet.GetString(flagMergeThreadMode)
+	if err != nil {
+		return options, err
+	}
+	switch options.mode {
+	case mergeModeInterleave, mergeModeAppend, mergeModeRebuild:
+	default:
+		return options, errors.Errorf("invalid --%s value %s; must be one of: %s, %s, %s", flagMergeThreadMode, options.mode, mergeModeInterleave, mergeModeAppend, mergeModeRebuild)
+	}
+	options.dryRun, err = flagSet.GetBool(flagDryRun)
+	if err != nil {
+		return options, err
+	}
+	options.postIDs = flagSet.Args()
+
+	return options, nil
+}
+
+func getMergeThreadUsage() string {
+	return fmt.Sprintf(mergeThreadUsage, getMergeThreadFlagSet().FlagUsages())
+}
 
 func getMergeThreadMessage() string {
-	return codeBlock(fmt.Sprintf("`Error: missing arguments\n\n%s", mergeThreadUsage))
+	return codeBlock(fmt.Sprintf("`Error: missing arguments\n\n%s", getMergeThreadUsage()))
+}
+
+// mergeSource is a thread that will be merged into a target thread along with
+// the channel it belongs to.
+type mergeSource struct {
+	wpl     *WranglerPostList
+	channel *model.Channel
 }
 
 func (p *Plugin) runMergeThreadCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
 	if !p.getConfiguration().MergeThreadEnable {
 		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Merge thread command is not enabled"), true, nil
 	}
+	options, err := parseMergeThreadArgs(args)
+	if err != nil {
+		return nil, true, err
+	}
+	flags := getSetFlags(getMergeThreadFlagSet(), args)
+	args = options.postIDs
+	mode := options.mode
 	if len(args) < 2 {
 		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, getMergeThreadMessage()), true, nil
 	}
-	originalPostID := args[0]
-	mergeToPostID := args[1]
+	originalPostIDs := args[:len(args)-1]
+	mergeToPostID := args[len(args)-1]
 
-	postListResponse, appErr := p.API.GetPostThread(originalPostID)
-	if appErr != nil {
-		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: unable to get post with ID %s; ensure this is correct", originalPostID)), true, nil
+	var sources []*mergeSource
+	sourceRootIDs := make(map[string]bool)
+	for _, originalPostID := range originalPostIDs {
+		postListResponse, appErr := p.API.GetPostThread(originalPostID)
+		if appErr != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: unable to get post with ID %s; ensure this is correct", originalPostID)), true, nil
+		}
+		wpl := buildWranglerPostList(postListResponse)
+		if wpl.NumPosts() == 0 {
+			return nil, false, errors.New("The wrangler post list contains no posts")
+		}
+		if sourceRootIDs[wpl.RootPost().Id] {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: the thread with root message ID %s was provided more than once", wpl.RootPost().Id)), true, nil
+		}
+		sourceRootIDs[wpl.RootPost().Id] = true
+		sources = append(sources, &mergeSource{wpl: wpl})
 	}
-	wpl := buildWranglerPostList(postListResponse)
-	originalChannelID := wpl.RootPost().ChannelId
 
 	targetPostListResponse, appErr := p.API.GetPostThread(mergeToPostID)
 	if appErr != nil {
@@ -42,23 +131,74 @@ func (p *Plugin) runMergeThreadCommand(args []string, extra *model.CommandArgs)
 	}
 	targetRootPost := getRootPostFromPostList(targetPostListResponse)
 
-	err := p.ensureOriginalAndTargetChannelMember(originalChannelID, targetRootPost.ChannelId, extra.UserId)
-	if err != nil {
-		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, err.Error()), true, nil
-	}
-
-	originalChannel, appErr := p.API.GetChannel(originalChannelID)
-	if appErr != nil {
-		return nil, false, errors.Errorf("unable to get channel with ID %s", originalChannelID)
-	}
 	targetChannel, appErr := p.API.GetChannel(targetRootPost.ChannelId)
 	if appErr != nil {
 		return nil, false, errors.Errorf("unable to get channel with ID %s", targetRootPost.ChannelId)
 	}
 
-	response, userErr, err := p.validateMerge(wpl, targetRootPost, originalChannel, targetChannel, extra)
-	if response != nil || err != nil {
-		return response, userErr, err
+	// Every source thread is validated before any messages are merged so that
+	// a single invalid thread doesn't result in a partial merge.
+	for _, source := range sources {
+		originalChannelID := source.wpl.RootPost().ChannelId
+
+		err := p.ensureOriginalAndTargetChannelMember(originalChannelID, targetRootPost.ChannelId, extra.UserId)
+		if err != nil {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, err.Error()), true, nil
+		}
+
+		source.channel, appErr = p.API.GetChannel(originalChannelID)
+		if appErr != nil {
+			return nil, false, errors.Errorf("unable to get channel with ID %s", originalChannelID)
+		}
+	}
+
+	var blockingResponse *model.CommandResponse
+	for _, source := range sources {
+		response, userErr, err := p.validateMerge(source.wpl, targetRootPost, source.channel, targetChannel, extra, mode)
+		if err != nil {
+			return nil, false, err
+		}
+		if response != nil {
+			if !options.dryRun {
+				return response, userErr, nil
+			}
+			blockingResponse = response
+			break
+		}
+	}
+
+	// Rebuilding recreates the target thread along with the source threads,
+	// so the combined thread must be within the configured size limit.
+	targetWpl := buildWranglerPostList(targetPostListResponse)
+	if mode == mergeModeRebuild && blockingResponse == nil {
+		postCount := targetWpl.NumPosts()
+		for _, source := range sources {
+			postCount += source.wpl.NumPosts()
+		}
+		maxPostCount := p.getConfiguration().MaxThreadCountMoveSizeInt()
+		if maxPostCount != 0 && maxPostCount < postCount {
+			response := getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: the rebuilt thread would be %d posts long, but this command is configured to only move threads of up to %d posts", postCount, maxPostCount))
+			if !options.dryRun {
+				return response, true, nil
+			}
+			blockingResponse = response
+		}
+	}
+
+	if options.dryRun {
+		var posts []*model.Post
+		for _, source := range sources {
+			posts = append(posts, source.wpl.Posts...)
+		}
+		sort.SliceStable(posts, func(i, j int) bool {
+			return posts[i].CreateAt < posts[j].CreateAt
+		})
+
+		preview, err := p.buildOperationPreview(fmt.Sprintf("merge %d thread(s) in %s mode", len(sources), mode), buildWranglerPostListFromPosts(posts), targetChannel, blockingResponse)
+		if err != nil {
+			return nil, false, err
+		}
+		return previewResponse(preview)
 	}
 
 	targetTeam, appErr := p.API.GetTeam(targetChannel.TeamId)
@@ -66,42 +206,182 @@ func (p *Plugin) runMergeThreadCommand(args []string, extra *model.CommandArgs)
 		return nil, false, errors.Errorf("unable to get team with ID %s", targetChannel.TeamId)
 	}
 
-	// Begin merging the thread.
-	p.API.LogInfo("Wrangler is merging a thread",
-		"user_id", extra.UserId,
-		"original_post_id", wpl.RootPost().Id,
-		"original_channel_id", originalChannel.Id,
-		"target_root_post_id", targetRootPost.Id,
-		"target_root_post_channel_id", targetRootPost.ChannelId,
-		"merge_message_count", fmt.Sprintf("%d", wpl.NumPosts()),
-	)
+	var messageCount int
+	for _, source := range sources {
+		messageCount += source.wpl.NumPosts()
+	}
+	if mode == mergeModeRebuild {
+		messageCount += targetWpl.NumPosts()
+	}
+
+	op := p.startOperation(operationTypeMerge, extra.UserId)
+	rootIDs := []string{targetRootPost.Id}
+	for _, source := range sources {
+		rootIDs = append(rootIDs, source.wpl.RootPost().Id)
+	}
+	response, err := p.lockThreads(op, rootIDs...)
+	if response != nil || err != nil {
+		return response, response != nil, err
+	}
+	var sourceChannels []*model.Channel
+	var originalPosts []*model.Post
+	if mode == mergeModeRebuild {
+		sourceChannels = append(sourceChannels, targetChannel)
+		originalPosts = append(originalPosts, targetWpl.Posts...)
+	}
+	for _, source := range sources {
+		sourceChannels = append(sourceChannels, source.channel)
+		originalPosts = append(originalPosts, source.wpl.Posts...)
+	}
+	op.startAudit(sourceChannels, targetChannel, originalPosts, targetRootPost.Id, flags)
+
+	return p.runOperation(op, messageCount, extra, func() (*model.CommandResponse, bool, error) {
+		return p.mergeThreads(sources, targetWpl, targetChannel, targetTeam, mode, op, extra)
+	})
+}
+
+// mergeThreads merges the source threads into the target thread once the
+// merge has been validated.
+func (p *Plugin) mergeThreads(sources []*mergeSource, targetWpl *WranglerPostList, targetChannel *model.Channel, targetTeam *model.Team, mode string, op *operation, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	targetRootPost := targetWpl.RootPost()
+
+	// Copying the threads replaces the file IDs of their posts with the IDs
+	// of the re-uploaded files, so the original threads are kept aside to be
+	// quarantined.
+	var originalWpls []*WranglerPostList
+	if mode == mergeModeRebuild {
+		originalWpls = append(originalWpls, targetWpl.Clone())
+	}
+	for _, source := range sources {
+		originalWpls = append(originalWpls, source.wpl.Clone())
+	}
+
+	var rootPostIDsToDelete []string
+	var originalPosts []*model.Post
+	if mode == mergeModeRebuild {
+		originalPosts = append(originalPosts, targetWpl.Posts...)
+		newRootPost, err := p.rebuildMergedThreads(sources, targetWpl, targetChannel, extra, op)
+		if err != nil {
+			return p.rollbackResponse(op, err)
+		}
+		rootPostIDsToDelete = append(rootPostIDsToDelete, targetRootPost.Id)
+		targetRootPost = newRootPost
+	}
+
+	var totalPosts int
+	for _, source := range sources {
+		totalPosts += source.wpl.NumPosts()
+		originalPosts = append(originalPosts, source.wpl.Posts...)
+		rootPostIDsToDelete = append(rootPostIDsToDelete, source.wpl.RootPost().Id)
+		if mode == mergeModeRebuild {
+			continue
+		}
+		wpl := source.wpl
+
+		// Begin merging the thread.
+		p.API.LogInfo("Wrangler is merging a thread",
+			"user_id", extra.UserId,
+			"original_post_id", wpl.RootPost().Id,
+			"original_channel_id", source.channel.Id,
+			"target_root_post_id", targetRootPost.Id,
+			"target_root_post_channel_id", targetRootPost.ChannelId,
+			"merge_message_count", fmt.Sprintf("%d", wpl.NumPosts()),
+		)
 
-	// To merge threads, we first copy the original messages(s) to the new
-	// thread and later delete the original messages(s).
-	err = p.mergeWranglerPostlist(wpl, targetRootPost)
+		// To merge threads, we first copy the original messages(s) to the new
+		// thread and later delete the original messages(s).
+		err := p.mergeWranglerPostlist(wpl, targetRootPost, mode, op)
+		if err != nil {
+			return p.rollbackResponse(op, err)
+		}
+	}
+
+	verification, err := p.verifyCopiedPosts(originalPosts, targetRootPost.Id, op)
 	if err != nil {
-		return nil, false, err
+		return p.rollbackResponse(op, err)
+	}
+	if !verification.ok() {
+		return p.rollbackResponse(op, verification.error())
 	}
 
-	// Cleanup is handled by simply deleting the root post. Any comments/replies
-	// are automatically marked as deleted for us.
-	appErr = p.API.DeletePost(wpl.RootPost().Id)
-	if appErr != nil {
-		return nil, false, errors.Wrap(appErr, "unable to delete post")
+	// In soft-move mode the original threads are kept in the quarantine
+	// channel before they are deleted.
+	quarantine, err := p.quarantineThreads(op, originalWpls...)
+	if err != nil {
+		return p.rollbackResponse(op, err)
 	}
 
+	// Cleanup is handled by simply deleting the root posts. Any
+	// comments/replies are automatically marked as deleted for us. This is
+	// only done once every message has been created so that a failure can be
+	// rolled back, which is no longer possible once an original is deleted.
+	op.beginDeletes(rootPostIDsToDelete...)
+	for i, rootPostID := range rootPostIDsToDelete {
+		appErr := p.API.DeletePost(rootPostID)
+		if appErr != nil {
+			err := errors.Wrap(appErr, "unable to delete post")
+			if i == 0 {
+				p.releaseQuarantine(quarantine)
+				return p.rollbackResponse(op, err)
+			}
+			return p.partialDeleteResponse(op, err)
+		}
+	}
+
+	op.setAuditNewRootID(targetRootPost.Id)
+	p.finishOperation(op)
+
 	p.API.LogInfo("Wrangler thread merge complete",
 		"user_id", extra.UserId,
 		"target_root_post_id", targetRootPost.Id,
 		"target_root_post_channel_id", targetRootPost.ChannelId,
+		"operation_id", op.ID,
 	)
 
 	newPostLink := makePostLink(*p.API.GetConfig().ServiceSettings.SiteURL, targetTeam.Name, targetRootPost.Id)
 
-	return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("A thread with %d message(s) has been merged: %s\n", wpl.NumPosts(), newPostLink)), false, nil
+	if len(sources) == 1 {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("A thread with %d message(s) has been merged: %s\n%s%s\n", totalPosts, newPostLink, verification.summary(), quarantine.summary())), false, nil
+	}
+
+	msg := fmt.Sprintf("%d threads with a total of %d message(s) have been merged: %s\n", len(sources), totalPosts, newPostLink)
+	for _, source := range sources {
+		msg += fmt.Sprintf("- %s: %d message(s)\n", inlineCode(source.wpl.RootPost().Id), source.wpl.NumPosts())
+	}
+	msg += verification.summary() + quarantine.summary() + "\n"
+
+	return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, msg), false, nil
+}
+
+// rebuildMergedThreads recreates the target thread and all source threads as
+// one new thread in the target channel. All posts are recreated in the order
+// they were originally created, so the oldest root post becomes the root of
+// the new thread. The original threads are left for the caller to delete.
+func (p *Plugin) rebuildMergedThreads(sources []*mergeSource, targetWpl *WranglerPostList, targetChannel *model.Channel, extra *model.CommandArgs, op *operation) (*model.Post, error) {
+	posts := append([]*model.Post{}, targetWpl.Posts...)
+	for _, source := range sources {
+		posts = append(posts, source.wpl.Posts...)
+	}
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].CreateAt < posts[j].CreateAt
+	})
+	wpl := buildWranglerPostListFromPosts(posts)
+
+	p.API.LogInfo("Wrangler is rebuilding merged threads",
+		"user_id", extra.UserId,
+		"target_root_post_id", targetWpl.RootPost().Id,
+		"target_root_post_channel_id", targetChannel.Id,
+		"merge_message_count", fmt.Sprintf("%d", wpl.NumPosts()),
+	)
+
+	return p.copyWranglerPostlist(wpl, targetChannel, op)
 }
 
-func (p *Plugin) mergeWranglerPostlist(wpl *WranglerPostList, targetRootPost *model.Post) error {
+// mergeWranglerPostlist recreates the posts of a post list as replies in the
+// target thread. Message creation timestamps are preserved unless the append
+// merge mode is used. Created posts and re-uploaded files are recorded in the
+// operation when one is provided.
+func (p *Plugin) mergeWranglerPostlist(wpl *WranglerPostList, targetRootPost *model.Post, mode string, op *operation) error {
 	var err error
 	var appErr *model.AppError
 
@@ -115,24 +395,10 @@ func (p *Plugin) mergeWranglerPostlist(wpl *WranglerPostList, targetRootPost *mo
 		)
 
 		for _, post := range wpl.Posts {
-			var newFileIDs []string
-			var fileBytes []byte
-			var oldFileInfo, newFileInfo *model.FileInfo
-			for _, fileID := range post.FileIds {
-				oldFileInfo, appErr = p.API.GetFileInfo(fileID)
-				if appErr != nil {
-					return errors.Wrap(appErr, "unable to lookup file info to re-upload")
-				}
-				fileBytes, appErr = p.API.GetFile(fileID)
-				if appErr != nil {
-					return errors.Wrap(appErr, "unable to get file bytes to re-upload")
-				}
-				newFileInfo, appErr = p.API.UploadFile(fileBytes, targetRootPost.ChannelId, oldFileInfo.Name)
-				if appErr != nil {
-					return errors.Wrap(appErr, "unable to re-upload file")
-				}
-
-				newFileIDs = append(newFileIDs, newFileInfo.Id)
+			newFileIDs, err := p.reuploadFileAttachments(post.FileIds, targetRootPost.ChannelId)
+			op.recordUploadedFiles(newFileIDs)
+			if err != nil {
+				return errors.Wrapf(err, "unable to re-upload files of message %s", post.Id)
 			}
 
 			post.FileIds = newFileIDs
@@ -151,24 +417,26 @@ func (p *Plugin) mergeWranglerPostlist(wpl *WranglerPostList, targetRootPost *mo
 		}
 
 		newPost := post.Clone()
-		cleanPostID(newPost)
+		if mode == mergeModeAppend {
+			cleanPost(newPost)
+		} else {
+			cleanPostID(newPost)
+		}
 		newPost.RootId = targetRootPost.Id
 		newPost.ParentId = targetRootPost.Id
 		newPost.ChannelId = targetRootPost.ChannelId
 
-		newPost, err = p.createPostWithRetries(newPost, 200*time.Millisecond, 3)
+		newPost, err = p.createPostWithRetries(newPost, retryBaseDelay, retryMaxRetries)
 		if err != nil {
-			return errors.Wrap(err, "unable to create new post")
+			return errors.Wrapf(err, "unable to create new post for message %s", post.Id)
 		}
+		op.recordPost(post, newPost)
 
-		for _, reaction := range reactions {
-			reaction.PostId = newPost.Id
-			_, appErr = p.API.AddReaction(reaction)
-			if appErr != nil {
-				// Reaction-based errors are logged, but do not cause the plugin to
-				// abort the move thread process.
-				p.API.LogError("Failed to reapply reactions to post", "err", appErr)
-			}
+		p.reapplyReactions(reactions, newPost.Id)
+
+		err = op.reportProgress()
+		if err != nil {
+			return err
 		}
 	}
 
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+const (
+	moveRepliesUsage = `/wrangler move replies [ROOT_MESSAGE_ID] [REPLY_MESSAGE_ID...] [flags]
+  Move a selection of replies out of a thread into another thread or channel
+    - The rest of the thread is left as it was
+    - When moving to a channel, the first selected reply becomes the root message of a new thread
+    - Use the '/wrangler list' commands to get message and channel IDs
+	Flags:
+%s`
+
+	flagMoveRepliesToThread  = "to-thread"
+	flagMoveRepliesToChannel = "to-channel"
+)
+
+type moveRepliesOptions struct {
+	rootID    string
+	replyIDs  []string
+	toThread  string
+	toChannel string
+}
+
+func getMoveRepliesFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("move replies", pflag.ContinueOnError)
+	flagSet.String(flagMoveRepliesToThread, "", "The root message ID of the thread to move the replies to")
+	flagSet.String(flagMoveRepliesToChannel, "", "The ID of the channel to move the replies to as a new thread")
+
+	return flagSet
+}
+
+func parseMoveRepliesArgs(args []string) (moveRepliesOptions, error) {
+	var options moveRepliesOptions
+
+	flagSet := getMoveRepliesFlagSet()
+	err := flagSet.Parse(args)
+	if err != nil {
+		return options, errors.Wrap(err, "unable to parse move replies flag args")
+	}
+
+	options.toThread, err = flagSet.GetString(flagMoveRepliesToThread)
+	if err != nil {
+		return options, err
+	}
+	options.toChannel, err = flagSet.GetString(flagMoveRepliesToChannel)
+	if err != nil {
+		return options, err
+	}
+	if len(options.toThread) == 0 && len(options.toChannel) == 0 {
+		return options, errors.Errorf("one of --%s or --%s must be provided", flagMoveRepliesToThread, flagMoveRepliesToChannel)
+	}
+	if len(options.toThread) != 0 && len(options.toChannel) != 0 {
+		return options, errors.Errorf("only one of --%s or --%s can be provided", flagMoveRepliesToThread, flagMoveRepliesToChannel)
+	}
+
+	positionalArgs := flagSet.Args()
+	if len(positionalArgs) < 2 {
+		return options, errors.New("a root message ID and at least one reply message ID must be provided")
+	}
+	options.rootID = positionalArgs[0]
+	options.replyIDs = positionalArgs[1:]
+
+	return options, nil
+}
+
+func getMoveRepliesUsage() string {
+	return fmt.Sprintf(moveRepliesUsage, getMoveRepliesFlagSet().FlagUsages())
+}
+
+func getMoveRepliesMessage() string {
+	return codeBlock(fmt.Sprintf("`Error: missing arguments\n\n%s", getMoveRepliesUsage()))
+}
+
+func (p *Plugin) runMoveRepliesCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	if len(args) < 2 {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, getMoveRepliesMessage()), true, nil
+	}
+	options, err := parseMoveRepliesArgs(args)
+	if err != nil {
+		return nil, true, err
+	}
+
+	postListResponse, appErr := p.API.GetPostThread(options.rootID)
+	if appErr != nil {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: unable to get post with ID %s; ensure this is correct", options.rootID)), true, nil
+	}
+	originalWpl := buildWranglerPostList(postListResponse)
+	if originalWpl.NumPosts() == 0 {
+		return nil, false, errors.New("The wrangler post list contains no posts")
+	}
+	if originalWpl.RootPost().Id != options.rootID {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: message with ID %s is not the root message of its thread", options.rootID)), true, nil
+	}
+
+	for _, replyID := range options.replyIDs {
+		if replyID == options.rootID {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: the root message cannot be moved as a reply; use '/wrangler move thread' to move the whole thread"), true, nil
+		}
+	}
+	wpl, err := originalWpl.Select(options.replyIDs)
+	if err != nil {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: %s in the thread with root message ID %s", err.Error(), options.rootID)), true, nil
+	}
+
+	originalChannel, appErr := p.API.GetChannel(originalWpl.RootPost().ChannelId)
+	if appErr != nil {
+		return nil, false, errors.Errorf("unable to get channel with ID %s", originalWpl.RootPost().ChannelId)
+	}
+
+	var newPostLink string
+	var response *model.CommandResponse
+	var userErr bool
+	flags := getSetFlags(getMoveRepliesFlagSet(), args)
+	op := p.startOperation(operationTypeMoveReplies, extra.UserId)
+	defer op.unlock()
+	if len(options.toThread) != 0 {
+		newPostLink, response, userErr, err = p.moveRepliesToThread(wpl, options.toThread, originalChannel, flags, extra, op)
+	} else {
+		newPostLink, response, userErr, err = p.moveRepliesToChannel(wpl, options.toChannel, originalChannel, flags, extra, op)
+	}
+	if response != nil || err != nil {
+		return response, userErr, err
+	}
+
+	// Only the selected replies are removed; the rest of the original thread
+	// is left as it was.
+	op.beginDeletes(getPostIDs(wpl.Posts)...)
+	for i, post := range wpl.Posts {
+		appErr = p.API.DeletePost(post.Id)
+		if appErr != nil {
+			err = errors.Wrap(appErr, "unable to delete post")
+			if i == 0 {
+				return p.rollbackResponse(op, err)
+			}
+			return p.partialDeleteResponse(op, err)
+		}
+	}
+	p.finishOperation(op)
+
+	_, appErr = p.API.CreatePost(&model.Post{
+		UserId:    p.BotUserID,
+		RootId:    originalWpl.RootPost().Id,
+		ParentId:  originalWpl.RootPost().Id,
+		ChannelId: originalChannel.Id,
+		Message:   fmt.Sprintf("%d message(s) from this thread have been moved: %s", wpl.NumPosts(), newPostLink),
+	})
+	if appErr != nil {
+		return nil, false, errors.Wrap(appErr, "unable to create new bot post")
+	}
+
+	p.API.LogInfo("Wrangler reply move complete",
+		"user_id", extra.UserId,
+		"original_root_post_id", originalWpl.RootPost().Id,
+		"moved_post_count", fmt.Sprintf("%d", wpl.NumPosts()),
+	)
+
+	return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("%d message(s) have been moved: %s\n", wpl.NumPosts(), newPostLink)), false, nil
+}
+
+// moveRepliesToThread merges the selected replies into an existing thread and
+// returns a link to that thread. The merge is rolled back if it fails.
+func (p *Plugin) moveRepliesToThread(wpl *WranglerPostList, targetPostID string, originalChannel *model.Channel, flags []string, extra *model.CommandArgs, op *operation) (string, *model.CommandResponse, bool, error) {
+	if wpl.RootPost().ChannelId != extra.ChannelId {
+		return "", getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: this command must be run from the channel containing the post"), true, nil
+	}
+
+	targetPostListResponse, appErr := p.API.GetPostThread(targetPostID)
+	if appErr != nil {
+		return "", getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: unable to get post with ID %s; ensure this is correct", targetPostID)), true, nil
+	}
+	targetRootPost := getRootPostFromPostList(targetPostListResponse)
+	if targetRootPost == nil {
+		return "", nil, false, errors.Errorf("unable to find root post of thread with ID %s", targetPostID)
+	}
+	if targetRootPost.Id == wpl.RootPost().RootId {
+		return "", getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: the replies are already in the target thread"), true, nil
+	}
+
+	targetChannel, appErr := p.API.GetChannel(targetRootPost.ChannelId)
+	if appErr != nil {
+		return "", nil, false, errors.Errorf("unable to get channel with ID %s", targetRootPost.ChannelId)
+	}
+
+	response, userErr, err := p.validateMerge(wpl, targetRootPost, originalChannel, targetChannel, extra, mergeModeInterleave)
+	if response != nil || err != nil {
+		return "", response, userErr, err
+	}
+
+	targetTeam, appErr := p.API.GetTeam(targetChannel.TeamId)
+	if appErr != nil {
+		return "", nil, false, errors.Errorf("unable to get team with ID %s", targetChannel.TeamId)
+	}
+
+	response, err = p.lockThreads(op, wpl.RootPost().RootId, targetRootPost.Id)
+	if response != nil || err != nil {
+		return "", response, response != nil, err
+	}
+	op.startAudit([]*model.Channel{originalChannel}, targetChannel, wpl.Posts, targetRootPost.Id, flags)
+
+	p.API.LogInfo("Wrangler is moving replies to a thread",
+		"user_id", extra.UserId,
+		"original_root_post_id", wpl.RootPost().RootId,
+		"target_root_post_id", targetRootPost.Id,
+		"move_message_count", fmt.Sprintf("%d", wpl.NumPosts()),
+	)
+
+	err = p.mergeWranglerPostlist(wpl, targetRootPost, mergeModeInterleave, op)
+	if err != nil {
+		response, userErr, err = p.rollbackResponse(op, err)
+		return "", response, userErr, err
+	}
+
+	return makePostLink(*p.API.GetConfig().ServiceSettings.SiteURL, targetTeam.Name, targetRootPost.Id), nil, false, nil
+}
+
+// moveRepliesToChannel copies the selected replies into a new thread in a
+// channel and returns a link to the new thread. The copy is rolled back if it
+// fails.
+func (p *Plugin) moveRepliesToChannel(wpl *WranglerPostList, channelID string, originalChannel *model.Channel, flags []string, extra *model.CommandArgs, op *operation) (string, *model.CommandResponse, bool, error) {
+	_, appErr := p.API.GetChannelMember(channelID, extra.UserId)
+	if appErr != nil {
+		return "", getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: channel with ID %s doesn't exist or you are not a member", channelID)), true, nil
+	}
+	targetChannel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		return "", nil, false, errors.Errorf("unable to get channel with ID %s", channelID)
+	}
+
+	response, userErr, err := p.validateMoveOrCopy(wpl, originalChannel, targetChannel, extra)
+	if response != nil || err != nil {
+		return "", response, userErr, err
+	}
+
+	targetTeam, appErr := p.API.GetTeam(targetChannel.TeamId)
+	if appErr != nil {
+		return "", nil, false, errors.Errorf("unable to get team with ID %s", targetChannel.TeamId)
+	}
+
+	response, err = p.lockThreads(op, wpl.RootPost().RootId)
+	if response != nil || err != nil {
+		return "", response, response != nil, err
+	}
+	op.startAudit([]*model.Channel{originalChannel}, targetChannel, wpl.Posts, "", flags)
+
+	p.API.LogInfo("Wrangler is moving replies to a channel",
+		"user_id", extra.UserId,
+		"original_root_post_id", wpl.RootPost().RootId,
+		"target_channel_id", targetChannel.Id,
+		"move_message_count", fmt.Sprintf("%d", wpl.NumPosts()),
+	)
+
+	newRootPost, err := p.copyWranglerPostlist(wpl, targetChannel, op)
+	if err != nil {
+		response, userErr, err = p.rollbackResponse(op, err)
+		return "", response, userErr, err
+	}
+	op.setAuditNewRootID(newRootPost.Id)
+
+	botPost, appErr := p.API.CreatePost(&model.Post{
+		UserId:    p.BotUserID,
+		RootId:    newRootPost.Id,
+		ParentId:  newRootPost.Id,
+		ChannelId: targetChannel.Id,
+		Message:   "These messages were moved from another thread",
+	})
+	if appErr != nil {
+		response, userErr, err = p.rollbackResponse(op, errors.Wrap(appErr, "unable to create new bot post"))
+		return "", response, userErr, err
+	}
+	op.recordPost(nil, botPost)
+
+	return makePostLink(*p.API.GetConfig().ServiceSettings.SiteURL, targetTeam.Name, newRootPost.Id), nil, false, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMoveRepliesCommand(t *testing.T) {
+	team1 := &model.Team{
+		Id:   model.NewId(),
+		Name: "team-1",
+	}
+	originalChannel := &model.Channel{
+		Id:     model.NewId(),
+		TeamId: team1.Id,
+		Name:   "original-channel",
+		Type:   model.CHANNEL_OPEN,
+	}
+	targetChannel := &model.Channel{
+		Id:     model.NewId(),
+		TeamId: team1.Id,
+		Name:   "target-channel",
+		Type:   model.CHANNEL_OPEN,
+	}
+
+	config := &model.Config{
+		ServiceSettings: model.ServiceSettings{
+			SiteURL: NewString("test.sampledomain.com"),
+		},
+	}
+
+	generatedPosts := mockGenerateThread(5, originalChannel.Id)
+	wpl := buildWranglerPostList(generatedPosts)
+	rootPostID := wpl.RootPost().Id
+	replyIDs := []string{wpl.Posts[1].Id, wpl.Posts[3].Id}
+
+	generatedTargetPosts := mockGenerateThread(2, targetChannel.Id)
+	for _, post := range generatedTargetPosts.Posts {
+		post.CreateAt = 10
+	}
+	targetRootPostID := buildWranglerPostList(generatedTargetPosts).RootPost().Id
+
+	api := &plugintest.API{}
+	api.On("GetChannel", originalChannel.Id).Return(originalChannel, nil)
+	api.On("GetChannel", targetChannel.Id).Return(targetChannel, nil)
+	api.On("GetPostThread", rootPostID).Return(generatedPosts, nil)
+	api.On("GetPostThread", replyIDs[0]).Return(generatedPosts, nil)
+	api.On("GetPostThread", targetRootPostID).Return(generatedTargetPosts, nil)
+	api.On("GetPost", mock.AnythingOfType("string")).Return(mockGeneratePost(), nil)
+	api.On("GetTeam", mock.AnythingOfType("string")).Return(team1, nil)
+	api.On("CreatePost", mock.Anything).Return(mockGeneratePost(), nil)
+
+	plugin, _ := setupCommandTestPlugin(api, config)
+
+	t.Run("no args", func(t *testing.T) {
+		resp, isUserError, err := plugin.runMoveRepliesCommand([]string{}, &model.CommandArgs{ChannelId: originalChannel.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: missing arguments")
+	})
+
+	t.Run("no target", func(t *testing.T) {
+		_, isUserError, err := plugin.runMoveRepliesCommand([]string{rootPostID, replyIDs[0]}, &model.CommandArgs{ChannelId: originalChannel.Id})
+		require.Error(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, err.Error(), "one of --to-thread or --to-channel must be provided")
+	})
+
+	t.Run("both targets", func(t *testing.T) {
+		_, isUserError, err := plugin.runMoveRepliesCommand([]string{rootPostID, replyIDs[0], "--to-thread", targetRootPostID, "--to-channel", targetChannel.Id}, &model.CommandArgs{ChannelId: originalChannel.Id})
+		require.Error(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, err.Error(), "only one of --to-thread or --to-channel can be provided")
+	})
+
+	t.Run("root ID is not a root message", func(t *testing.T) {
+		resp, isUserError, err := plugin.runMoveRepliesCommand([]string{replyIDs[0], replyIDs[1], "--to-channel", targetChannel.Id}, &model.CommandArgs{ChannelId: originalChannel.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "is not the root message of its thread")
+	})
+
+	t.Run("root message selected", func(t *testing.T) {
+		resp, isUserError, err := plugin.runMoveRepliesCommand([]string{rootPostID, rootPostID, "--to-channel", targetChannel.Id}, &model.CommandArgs{ChannelId: originalChannel.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: the root message cannot be moved as a reply")
+	})
+
+	t.Run("reply not in thread", func(t *testing.T) {
+		resp, isUserError, err := plugin.runMoveRepliesCommand([]string{rootPostID, model.NewId(), "--to-channel", targetChannel.Id}, &model.CommandArgs{ChannelId: originalChannel.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "is not in the post list in the thread with root message ID")
+	})
+
+	t.Run("to same thread", func(t *testing.T) {
+		resp, isUserError, err := plugin.runMoveRepliesCommand([]string{rootPostID, replyIDs[1], "--to-thread", replyIDs[0]}, &model.CommandArgs{ChannelId: originalChannel.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: the replies are already in the target thread")
+	})
+
+	t.Run("to channel from inside the thread", func(t *testing.T) {
+		resp, isUserError, err := plugin.runMoveRepliesCommand([]string{rootPostID, replyIDs[1], "--to-channel", targetChannel.Id}, &model.CommandArgs{ChannelId: originalChannel.Id, RootId: rootPostID})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: this command cannot be run from inside the thread")
+	})
+
+	t.Run("to thread from another channel", func(t *testing.T) {
+		resp, isUserError, err := plugin.runMoveRepliesCommand([]string{rootPostID, replyIDs[1], "--to-thread", targetRootPostID}, &model.CommandArgs{ChannelId: targetChannel.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: this command must be run from the channel containing the post")
+	})
+
+	t.Run("to channel successfully", func(t *testing.T) {
+		args := append([]string{rootPostID}, replyIDs...)
+		resp, isUserError, err := plugin.runMoveRepliesCommand(append(args, "--to-channel", targetChannel.Id), &model.CommandArgs{ChannelId: originalChannel.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "2 message(s) have been moved")
+		api.AssertNotCalled(t, "DeletePost", rootPostID)
+		api.AssertCalled(t, "DeletePost", replyIDs[0])
+		api.AssertCalled(t, "DeletePost", replyIDs[1])
+	})
+
+	t.Run("to thread successfully", func(t *testing.T) {
+		args := append([]string{rootPostID}, replyIDs...)
+		resp, isUserError, err := plugin.runMoveRepliesCommand(append(args, "--to-thread", targetRootPostID), &model.CommandArgs{ChannelId: originalChannel.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "2 message(s) have been moved")
+	})
+}
@@ -20,25 +20,35 @@ const (
 	flagMoveThreadSilent             = "silent"
 )
 
+type moveThreadOptions struct {
+	showRootMessageInSummary bool
+	silent                   bool
+	dryRun                   bool
+}
+
 func getMoveThreadFlagSet() *pflag.FlagSet {
 	flagSet := pflag.NewFlagSet("move thread", pflag.ContinueOnError)
 	flagSet.Bool(flagMoveThreadShowMessageSummary, true, "Show the root message in the post-move summary")
 	flagSet.Bool(flagMoveThreadSilent, false, "Silence all Wrangler summary messages and user DMs when moving the thread")
+	flagSet.Bool(flagDryRun, false, "Show what would be moved without moving anything")
 
 	return flagSet
 }
 
-func parseMoveThreadFlagArgs(args []string) (bool, bool, error) {
+func parseMoveThreadFlagArgs(args []string) (moveThreadOptions, error) {
+	var options moveThreadOptions
+
 	flagSet := getMoveThreadFlagSet()
 	err := flagSet.Parse(args)
 	if err != nil {
-		return false, false, errors.Wrap(err, "unable to parse move thread flag args")
+		return options, errors.Wrap(err, "unable to parse move thread flag args")
 	}
 
-	showMessageSummary, _ := flagSet.GetBool(flagMoveThreadShowMessageSummary)
-	silent, _ := flagSet.GetBool(flagMoveThreadSilent)
+	options.showRootMessageInSummary, _ = flagSet.GetBool(flagMoveThreadShowMessageSummary)
+	options.silent, _ = flagSet.GetBool(flagMoveThreadSilent)
+	options.dryRun, _ = flagSet.GetBool(flagDryRun)
 
-	return showMessageSummary, silent, nil
+	return options, nil
 }
 
 func getMoveThreadUsage() string {
@@ -53,13 +63,21 @@ func (p *Plugin) runMoveThreadCommand(args []string, extra *model.CommandArgs) (
 	if len(args) < 2 {
 		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, getMoveThreadMessage()), true, nil
 	}
-	showRootMessageInSummary, silent, err := parseMoveThreadFlagArgs(args)
+	options, err := parseMoveThreadFlagArgs(args)
 	if err != nil {
 		return nil, false, err
 	}
 	postID := args[0]
 	channelID := args[1]
 
+	if options.dryRun {
+		preview, response, err := p.previewMoveOrCopy("move thread", postID, channelID, extra)
+		if response != nil || err != nil {
+			return response, response != nil, err
+		}
+		return previewResponse(preview)
+	}
+
 	postListResponse, appErr := p.API.GetPostThread(postID)
 	if appErr != nil {
 		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: unable to get post with ID %s; ensure this is correct", postID)), true, nil
@@ -89,6 +107,21 @@ func (p *Plugin) runMoveThreadCommand(args []string, extra *model.CommandArgs) (
 		return nil, false, fmt.Errorf("unable to get team with ID %s", targetChannel.TeamId)
 	}
 
+	op := p.startOperation(operationTypeMove, extra.UserId)
+	response, err = p.lockThreads(op, wpl.RootPost().Id)
+	if response != nil || err != nil {
+		return response, response != nil, err
+	}
+	op.startAudit([]*model.Channel{originalChannel}, targetChannel, wpl.Posts, "", getSetFlags(getMoveThreadFlagSet(), args))
+
+	return p.runOperation(op, wpl.NumPosts(), extra, func() (*model.CommandResponse, bool, error) {
+		return p.moveThread(wpl, originalChannel, targetChannel, targetTeam, options, op, extra)
+	})
+}
+
+// moveThread moves a thread to the target channel once the move has been
+// validated.
+func (p *Plugin) moveThread(wpl *WranglerPostList, originalChannel, targetChannel *model.Channel, targetTeam *model.Team, options moveThreadOptions, op *operation, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
 	// Begin creating the new thread.
 	p.API.LogInfo("Wrangler is moving a thread",
 		"user_id", extra.UserId,
@@ -96,48 +129,75 @@ func (p *Plugin) runMoveThreadCommand(args []string, extra *model.CommandArgs) (
 		"original_channel_id", originalChannel.Id,
 	)
 
+	// Copying the thread replaces the file IDs of its posts with the IDs of
+	// the re-uploaded files, so the original thread is kept aside to be
+	// quarantined.
+	originalWpl := wpl.Clone()
+
 	// To simulate the move, we first copy the original messages(s) to the
 	// new channel and later delete the original messages(s).
-	newRootPost, err := p.copyWranglerPostlist(wpl, targetChannel)
+	newRootPost, err := p.copyWranglerPostlist(wpl, targetChannel, op)
 	if err != nil {
-		return nil, false, err
+		return p.rollbackResponse(op, err)
 	}
+	op.setAuditNewRootID(newRootPost.Id)
 
-	if !silent {
-		_, appErr = p.API.CreatePost(&model.Post{
+	if !options.silent {
+		botPost, appErr := p.API.CreatePost(&model.Post{
 			UserId:    p.BotUserID,
 			RootId:    newRootPost.Id,
 			ParentId:  newRootPost.Id,
-			ChannelId: channelID,
+			ChannelId: targetChannel.Id,
 			Message:   "This thread was moved from another channel",
 		})
 		if appErr != nil {
-			return nil, false, errors.Wrap(appErr, "unable to create new bot post")
+			return p.rollbackResponse(op, errors.Wrap(appErr, "unable to create new bot post"))
 		}
+		op.recordPost(nil, botPost)
+	}
+
+	verification, err := p.verifyCopiedPosts(wpl.Posts, newRootPost.Id, op)
+	if err != nil {
+		return p.rollbackResponse(op, err)
+	}
+	if !verification.ok() {
+		return p.rollbackResponse(op, verification.error())
+	}
+
+	// In soft-move mode the original thread is kept in the quarantine channel
+	// before it is deleted.
+	quarantine, err := p.quarantineThreads(op, originalWpl)
+	if err != nil {
+		return p.rollbackResponse(op, err)
 	}
 
 	// Cleanup is handled by simply deleting the root post. Any comments/replies
 	// are automatically marked as deleted for us.
-	appErr = p.API.DeletePost(wpl.RootPost().Id)
+	op.beginDeletes(wpl.RootPost().Id)
+	appErr := p.API.DeletePost(wpl.RootPost().Id)
 	if appErr != nil {
-		return nil, false, errors.Wrap(appErr, "unable to delete post")
+		p.releaseQuarantine(quarantine)
+		return p.rollbackResponse(op, errors.Wrap(appErr, "unable to delete post"))
 	}
 
+	p.finishOperation(op)
+
 	p.API.LogInfo("Wrangler thread move complete",
 		"user_id", extra.UserId,
 		"new_post_id", newRootPost.Id,
-		"new_channel_id", channelID,
+		"new_channel_id", targetChannel.Id,
+		"operation_id", op.ID,
 	)
 
 	newPostLink := makePostLink(*p.API.GetConfig().ServiceSettings.SiteURL, targetTeam.Name, newRootPost.Id)
 
-	if silent {
-		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("A thread with %d message(s) has been silently moved: %s\n", wpl.NumPosts(), newPostLink)), false, nil
+	if options.silent {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("A thread with %d message(s) has been silently moved: %s\n%s%s\n", wpl.NumPosts(), newPostLink, verification.summary(), quarantine.summary())), false, nil
 	}
 
 	executor, execError := p.API.GetUser(extra.UserId)
 	if execError != nil {
-		return nil, false, errors.Wrap(appErr, "unable to find executor")
+		return nil, false, errors.Wrap(execError, "unable to find executor")
 	}
 
 	if extra.UserId != wpl.RootPost().UserId {
@@ -156,7 +216,8 @@ func (p *Plugin) runMoveThreadCommand(args []string, extra *model.CommandArgs) (
 	if wpl.NumPosts() == 1 {
 		msg = fmt.Sprintf("A message has been moved: %s\n", newPostLink)
 	}
-	if showRootMessageInSummary {
+	msg += verification.summary() + quarantine.summary() + "\n"
+	if options.showRootMessageInSummary {
 		msg += fmt.Sprintf("Original Thread Root Message:\n%s\n",
 			quoteBlock(cleanAndTrimMessage(
 				wpl.RootPost().Message, 500),
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -74,34 +75,27 @@ func TestMoveThreadCommand(t *testing.T) {
 	generatedPosts := mockGeneratePostList(3, originalChannel.Id, false)
 	originalPostID := generatedPosts.ToSlice()[0].Id
 
+	posts := newMockPostStore()
+	posts.addThread("id1", generatedPosts)
+	posts.addThread(originalPostID, generatedPosts)
+	posts.addThread(directChannel.Id, generatedPosts)
+
 	api := &plugintest.API{}
 	api.On("GetChannel", originalChannel.Id).Return(originalChannel, nil)
 	api.On("GetChannel", privateChannel.Id).Return(privateChannel, nil)
 	api.On("GetChannel", directChannel.Id).Return(directChannel, nil)
 	api.On("GetChannel", groupChannel.Id).Return(groupChannel, nil)
 	api.On("GetChannel", mock.AnythingOfType("string")).Return(targetChannel, nil)
-	api.On("GetPostThread", mock.AnythingOfType("string")).Return(generatedPosts, nil)
-	api.On("GetChannelMember", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(mockGenerateChannelMember(), nil)
+	api.On("GetPostThread", mock.AnythingOfType("string")).Return(posts.getPostThread, nil)
+	api.On("GetPost", mock.AnythingOfType("string")).Return(mockGeneratePost(), nil)
 	api.On("GetDirectChannel", mock.AnythingOfType("string"), mock.Anything).Return(directChannel, nil)
 	api.On("GetTeam", mock.AnythingOfType("string")).Return(targetTeam, nil)
 	api.On("GetUser", mock.Anything).Return(executor, nil)
-	api.On("CreatePost", mock.Anything, mock.Anything).Return(mockGeneratePost(), nil)
-	api.On("DeletePost", mock.AnythingOfType("string")).Return(nil)
+	api.On("CreatePost", mock.Anything, mock.Anything).Return(posts.createPost, nil)
+	api.On("UpdatePost", mock.Anything).Return(posts.updatePost, nil)
 	api.On("GetReactions", mock.AnythingOfType("string")).Return(reactions, nil)
-	api.On("AddReaction", mock.Anything).Return(nil, nil)
-	api.On("GetConfig").Return(config)
-	api.On("LogInfo",
-		mock.AnythingOfTypeArgument("string"),
-		mock.AnythingOfTypeArgument("string"),
-		mock.AnythingOfTypeArgument("string"),
-		mock.AnythingOfTypeArgument("string"),
-		mock.AnythingOfTypeArgument("string"),
-		mock.AnythingOfTypeArgument("string"),
-		mock.AnythingOfTypeArgument("string"),
-	).Return(nil)
 
-	var plugin Plugin
-	plugin.SetAPI(api)
+	plugin, _ := setupCommandTestPlugin(api, config)
 
 	t.Run("no args", func(t *testing.T) {
 		resp, isUserError, err := plugin.runMoveThreadCommand([]string{}, &model.CommandArgs{ChannelId: originalChannel.Id})
@@ -270,6 +264,7 @@ func TestMoveThreadCommand(t *testing.T) {
 		assert.False(t, isUserError)
 		assert.Contains(t, resp.Text, fmt.Sprintf("A thread with 3 messages has been moved: %s", makePostLink(*config.ServiceSettings.SiteURL, targetTeam.Name, "")))
 		assert.Contains(t, resp.Text, quoteBlock("This is message 1"))
+		assert.Contains(t, resp.Text, "Verified 3 message(s), 0 file(s) and 3 reaction(s) before removing the originals.")
 	})
 
 	t.Run("move thread successfully, but don't show root message", func(t *testing.T) {
@@ -292,6 +287,74 @@ func TestMoveThreadCommand(t *testing.T) {
 		assert.NotContains(t, resp.Text, "This is message 1")
 	})
 
+	t.Run("silenced move is reported in the audit channel", func(t *testing.T) {
+		previousConfig := plugin.getConfiguration()
+		auditConfig := previousConfig.Clone()
+		auditConfig.AuditChannelID = model.NewId()
+		plugin.setConfiguration(auditConfig)
+		defer plugin.setConfiguration(previousConfig)
+		require.NoError(t, plugin.configuration.IsValid())
+
+		resp, isUserError, err := plugin.runMoveThreadCommand([]string{"id1", "id2", "--silent"}, &model.CommandArgs{ChannelId: originalChannel.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "has been silently moved")
+
+		var notices []*model.Post
+		for _, post := range posts.created {
+			if post.ChannelId == auditConfig.AuditChannelID {
+				notices = append(notices, post)
+			}
+		}
+		require.Len(t, notices, 1)
+		assert.Contains(t, notices[0].Message, "#### Wrangler move succeeded")
+		assert.Contains(t, notices[0].Message, "moved 3 message(s) and 0 file(s)")
+		assert.Contains(t, notices[0].Message, "- **Flags:** `--silent=true`")
+	})
+
+	t.Run("move thread successfully in soft-move mode", func(t *testing.T) {
+		previousConfig := plugin.getConfiguration()
+		softMoveConfig := previousConfig.Clone()
+		softMoveConfig.QuarantineChannelID = targetChannel.Id
+		plugin.setConfiguration(softMoveConfig)
+		defer plugin.setConfiguration(previousConfig)
+		require.NoError(t, plugin.configuration.IsValid())
+
+		resp, isUserError, err := plugin.runMoveThreadCommand([]string{"id1", "id2"}, &model.CommandArgs{ChannelId: originalChannel.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, fmt.Sprintf("A thread with 3 messages has been moved: %s", makePostLink(*config.ServiceSettings.SiteURL, targetTeam.Name, "")))
+		assert.Contains(t, resp.Text, "The original thread(s) were quarantined in ~target-channel until")
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		t.Run("allowed", func(t *testing.T) {
+			require.NoError(t, plugin.configuration.IsValid())
+
+			callCount := len(api.Calls)
+			resp, isUserError, err := plugin.runMoveThreadCommand([]string{"id1", "id2", "--dry-run"}, &model.CommandArgs{ChannelId: originalChannel.Id})
+			require.NoError(t, err)
+			assert.False(t, isUserError)
+			assert.Contains(t, resp.Text, "Dry run: move thread")
+			assert.Contains(t, resp.Text, "- Messages: 3")
+			assert.Contains(t, resp.Text, "in team `target-team`")
+			assert.Contains(t, resp.Text, "This operation would be allowed.")
+			for _, call := range api.Calls[callCount:] {
+				assert.NotContains(t, []string{"CreatePost", "DeletePost", "KVSet"}, call.Method)
+			}
+		})
+
+		t.Run("blocked", func(t *testing.T) {
+			plugin.setConfiguration(&configuration{MoveThreadToAnotherTeamEnable: false})
+			require.NoError(t, plugin.configuration.IsValid())
+
+			resp, isUserError, err := plugin.runMoveThreadCommand([]string{"id1", "id2", "--dry-run"}, &model.CommandArgs{ChannelId: originalChannel.Id})
+			require.NoError(t, err)
+			assert.False(t, isUserError)
+			assert.Contains(t, resp.Text, "This operation would be blocked: Wrangler is currently configured to not allow moving messages to different teams")
+		})
+	})
+
 	t.Run("thread is above configuration move-maximum", func(t *testing.T) {
 		plugin.setConfiguration(&configuration{MoveThreadMaxCount: "1"})
 		require.NoError(t, plugin.configuration.IsValid())
@@ -302,6 +365,186 @@ func TestMoveThreadCommand(t *testing.T) {
 	})
 }
 
+func TestMoveThreadCommandRollback(t *testing.T) {
+	team := &model.Team{
+		Id:   model.NewId(),
+		Name: "team-1",
+	}
+	originalChannel := &model.Channel{
+		Id:     model.NewId(),
+		TeamId: team.Id,
+		Name:   "original-channel",
+		Type:   model.CHANNEL_OPEN,
+	}
+	targetChannel := &model.Channel{
+		Id:     model.NewId(),
+		TeamId: team.Id,
+		Name:   "target-channel",
+		Type:   model.CHANNEL_OPEN,
+	}
+
+	generatedPosts := mockGeneratePostList(3, originalChannel.Id, false)
+	originalPostID := generatedPosts.ToSlice()[0].Id
+
+	var createAttempts int
+	var createdPostIDs []string
+	api := &plugintest.API{}
+	api.On("GetChannel", originalChannel.Id).Return(originalChannel, nil)
+	api.On("GetChannel", targetChannel.Id).Return(targetChannel, nil)
+	api.On("GetPostThread", originalPostID).Return(generatedPosts, nil)
+	api.On("GetPost", mock.AnythingOfType("string")).Return(mockGeneratePost(), nil)
+	api.On("GetTeam", team.Id).Return(team, nil)
+	// The third message of the thread can never be created.
+	api.On("CreatePost", mock.Anything).Return(
+		func(post *model.Post) *model.Post {
+			createAttempts++
+			if createAttempts > 2 {
+				return nil
+			}
+			created := post.Clone()
+			created.Id = model.NewId()
+			createdPostIDs = append(createdPostIDs, created.Id)
+			return created
+		},
+		func(post *model.Post) *model.AppError {
+			if createAttempts > 2 {
+				return &model.AppError{Message: "failed"}
+			}
+			return nil
+		},
+	)
+	api.On("LogWarn", mock.AnythingOfTypeArgument("string"), mock.AnythingOfTypeArgument("string"), mock.Anything).Return(nil)
+	api.On("LogInfo",
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+	).Return(nil)
+	api.On("LogError",
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+	).Return(nil)
+
+	plugin, _ := setupCommandTestPlugin(api, nil)
+
+	resp, isUserError, err := plugin.runMoveThreadCommand([]string{originalPostID, targetChannel.Id}, &model.CommandArgs{ChannelId: originalChannel.Id})
+	require.NoError(t, err)
+	assert.False(t, isUserError)
+	assert.Contains(t, resp.Text, "Error: the operation failed partway through")
+	assert.Contains(t, resp.Text, "failed to create post after 4 attempts")
+	assert.Contains(t, resp.Text, "and has been rolled back; 2 created message(s) were removed")
+
+	var deleted []string
+	for _, call := range api.Calls {
+		if call.Method == "DeletePost" {
+			deleted = append(deleted, call.Arguments.String(0))
+		}
+	}
+	require.Len(t, createdPostIDs, 2)
+	assert.Equal(t, []string{createdPostIDs[1], createdPostIDs[0]}, deleted)
+
+	// The operation is not journaled and its checkpoint is removed.
+	var checkpointKeys, deletedKeys []string
+	for _, call := range api.Calls {
+		switch call.Method {
+		case "KVSet":
+			assert.False(t, strings.HasPrefix(call.Arguments.String(0), operationKeyPrefix))
+			if strings.HasPrefix(call.Arguments.String(0), checkpointKeyPrefix) {
+				checkpointKeys = append(checkpointKeys, call.Arguments.String(0))
+			}
+		case "KVDelete":
+			deletedKeys = append(deletedKeys, call.Arguments.String(0))
+		}
+	}
+	require.NotEmpty(t, checkpointKeys)
+	for _, key := range checkpointKeys {
+		assert.Contains(t, deletedKeys, key)
+	}
+}
+
+func TestMoveThreadCommandVerificationFailure(t *testing.T) {
+	team := &model.Team{
+		Id:   model.NewId(),
+		Name: "team-1",
+	}
+	originalChannel := &model.Channel{
+		Id:     model.NewId(),
+		TeamId: team.Id,
+		Name:   "original-channel",
+		Type:   model.CHANNEL_OPEN,
+	}
+	targetChannel := &model.Channel{
+		Id:     model.NewId(),
+		TeamId: team.Id,
+		Name:   "target-channel",
+		Type:   model.CHANNEL_OPEN,
+	}
+
+	generatedPosts := mockGeneratePostList(3, originalChannel.Id, false)
+	originalPostID := generatedPosts.ToSlice()[0].Id
+
+	posts := newMockPostStore()
+	posts.addThread(originalPostID, generatedPosts)
+
+	api := &plugintest.API{}
+	api.On("GetChannel", originalChannel.Id).Return(originalChannel, nil)
+	api.On("GetChannel", targetChannel.Id).Return(targetChannel, nil)
+	api.On("GetPostThread", originalPostID).Return(generatedPosts, nil)
+	// A reply silently goes missing from the new thread.
+	api.On("GetPostThread", mock.AnythingOfType("string")).Return(func(rootID string) *model.PostList {
+		postList := posts.getPostThread(rootID)
+		delete(postList.Posts, postList.Order[len(postList.Order)-1])
+		return postList
+	}, nil)
+	api.On("GetPost", mock.AnythingOfType("string")).Return(mockGeneratePost(), nil)
+	api.On("GetTeam", team.Id).Return(team, nil)
+	api.On("CreatePost", mock.Anything).Return(posts.createPost, nil)
+	api.On("LogInfo",
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+	).Return(nil)
+	api.On("LogError",
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+	).Return(nil)
+	api.On("LogError",
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+	).Return(nil)
+
+	plugin, _ := setupCommandTestPlugin(api, nil)
+
+	resp, isUserError, err := plugin.runMoveThreadCommand([]string{originalPostID, targetChannel.Id, "--silent"}, &model.CommandArgs{ChannelId: originalChannel.Id})
+	require.NoError(t, err)
+	assert.False(t, isUserError)
+	assert.Contains(t, resp.Text, "Error: verification of the new messages failed")
+	assert.Contains(t, resp.Text, "is missing from the new thread")
+	assert.Contains(t, resp.Text, "has been rolled back; 3 created message(s) were removed and the original messages are unchanged")
+
+	for _, call := range api.Calls {
+		if call.Method == "DeletePost" {
+			assert.NotContains(t, generatedPosts.Posts, call.Arguments.String(0))
+		}
+	}
+}
+
 func TestSortedPostsFromPostList(t *testing.T) {
 	tests := []struct {
 		count int
@@ -360,3 +603,29 @@ func mockGeneratePost() *model.Post {
 		Id: model.NewId(),
 	}
 }
+
+// setupCommandTestPlugin registers the mocks shared by the thread command
+// tests and returns a plugin using the API along with its KV store. Mocks a
+// test needs to behave differently must be registered before calling it,
+// since the first matching mock is used.
+func setupCommandTestPlugin(api *plugintest.API, config *model.Config) (*Plugin, *mockKVStore) {
+	kv := newMockKVStore(api)
+	api.On("GetChannelMember", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(mockGenerateChannelMember(), nil)
+	api.On("DeletePost", mock.AnythingOfType("string")).Return(nil)
+	api.On("GetReactions", mock.AnythingOfType("string")).Return([]*model.Reaction{}, nil)
+	api.On("AddReaction", mock.Anything).Return(nil, nil)
+	api.On("GetConfig").Return(config)
+	for _, argCount := range []int{7, 9} {
+		logArgs := make([]interface{}, argCount)
+		for i := range logArgs {
+			logArgs[i] = mock.AnythingOfTypeArgument("string")
+		}
+		api.On("LogInfo", logArgs...).Return(nil)
+	}
+
+	plugin := &Plugin{}
+	plugin.SetAPI(api)
+	plugin.setConfiguration(&configuration{})
+
+	return plugin, kv
+}
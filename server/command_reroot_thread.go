@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const rerootThreadUsage = `/wrangler reroot thread [REPLY_MESSAGE_ID]
+  Rebuild a thread with a given reply as the new root message
+    - The original root message becomes the first reply and the order of the other replies is kept
+    - Obtain the message ID by running '/wrangler list messages' or via the 'Permalink' message dropdown option (it's the last part of the URL)`
+
+func getRerootThreadMessage() string {
+	return codeBlock(fmt.Sprintf("`Error: missing arguments\n\n%s", rerootThreadUsage))
+}
+
+func (p *Plugin) runRerootThreadCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	if len(args) < 1 {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, getRerootThreadMessage()), true, nil
+	}
+	postID := args[0]
+
+	postListResponse, appErr := p.API.GetPostThread(postID)
+	if appErr != nil {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: unable to get post with ID %s; ensure this is correct", postID)), true, nil
+	}
+	originalWpl := buildWranglerPostList(postListResponse)
+	if originalWpl.NumPosts() == 0 {
+		return nil, false, errors.New("The wrangler post list contains no posts")
+	}
+	if originalWpl.RootPost().Id == postID {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: the message is already the root of its thread"), true, nil
+	}
+	if extra.RootId == originalWpl.RootPost().Id || extra.ParentId == originalWpl.RootPost().Id {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: this command cannot be run from inside the thread; please run directly in the channel containing the thread"), true, nil
+	}
+
+	wpl, err := originalWpl.Reroot(postID)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "unable to reroot thread")
+	}
+
+	channel, appErr := p.API.GetChannel(extra.ChannelId)
+	if appErr != nil {
+		return nil, false, fmt.Errorf("unable to get channel with ID %s", extra.ChannelId)
+	}
+
+	// The thread stays in the same channel, so the channel is both the
+	// original and the target of the operation.
+	response, userErr, err := p.validateMoveOrCopy(wpl, channel, channel, extra)
+	if response != nil || err != nil {
+		return response, userErr, err
+	}
+
+	// Direct and group messages don't belong to a team, so they are linked
+	// to from the team the command was run in.
+	teamID := channel.TeamId
+	if len(teamID) == 0 {
+		teamID = extra.TeamId
+	}
+	team, appErr := p.API.GetTeam(teamID)
+	if appErr != nil {
+		return nil, false, fmt.Errorf("unable to get team with ID %s", teamID)
+	}
+
+	p.API.LogInfo("Wrangler is rerooting a thread",
+		"user_id", extra.UserId,
+		"original_root_post_id", originalWpl.RootPost().Id,
+		"new_root_post_id", postID,
+	)
+
+	// To simulate the reroot, the reordered thread is first copied into the
+	// same channel and then the original thread is deleted.
+	op := p.startOperation(operationTypeReroot, extra.UserId)
+	response, err = p.lockThreads(op, originalWpl.RootPost().Id)
+	if response != nil || err != nil {
+		return response, response != nil, err
+	}
+	defer op.unlock()
+	op.startAudit([]*model.Channel{channel}, channel, wpl.Posts, "", nil)
+
+	newRootPost, err := p.copyWranglerPostlist(wpl, channel, op)
+	if err != nil {
+		return p.rollbackResponse(op, err)
+	}
+	op.setAuditNewRootID(newRootPost.Id)
+
+	// Cleanup is handled by simply deleting the original root post. Any
+	// comments/replies are automatically marked as deleted for us.
+	op.beginDeletes(originalWpl.RootPost().Id)
+	appErr = p.API.DeletePost(originalWpl.RootPost().Id)
+	if appErr != nil {
+		return p.rollbackResponse(op, errors.Wrap(appErr, "unable to delete post"))
+	}
+	p.finishOperation(op)
+
+	p.API.LogInfo("Wrangler thread reroot complete",
+		"user_id", extra.UserId,
+		"new_post_id", newRootPost.Id,
+		"channel_id", channel.Id,
+	)
+
+	newPostLink := makePostLink(*p.API.GetConfig().ServiceSettings.SiteURL, team.Name, newRootPost.Id)
+
+	return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("A thread with %d message(s) has been rerooted: %s\n", wpl.NumPosts(), newPostLink)), false, nil
+}
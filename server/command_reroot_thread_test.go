@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRerootThreadCommand(t *testing.T) {
+	team1 := &model.Team{
+		Id:   model.NewId(),
+		Name: "team-1",
+	}
+	channel1 := &model.Channel{
+		Id:     model.NewId(),
+		TeamId: team1.Id,
+		Name:   "channel1",
+		Type:   model.CHANNEL_OPEN,
+	}
+
+	config := &model.Config{
+		ServiceSettings: model.ServiceSettings{
+			SiteURL: NewString("test.sampledomain.com"),
+		},
+	}
+
+	generatedPosts := mockGenerateThread(4, channel1.Id)
+	wpl := buildWranglerPostList(generatedPosts)
+	rootPostID := wpl.RootPost().Id
+	replyPostID := wpl.Posts[1].Id
+
+	api := &plugintest.API{}
+	api.On("GetChannel", channel1.Id).Return(channel1, nil)
+	api.On("GetPostThread", mock.AnythingOfType("string")).Return(generatedPosts, nil)
+	api.On("GetPost", mock.AnythingOfType("string")).Return(mockGeneratePost(), nil)
+	api.On("GetTeam", mock.AnythingOfType("string")).Return(team1, nil)
+	api.On("CreatePost", mock.Anything).Return(mockGeneratePost(), nil)
+
+	plugin, _ := setupCommandTestPlugin(api, config)
+
+	t.Run("no args", func(t *testing.T) {
+		resp, isUserError, err := plugin.runRerootThreadCommand([]string{}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: missing arguments")
+	})
+
+	t.Run("already root", func(t *testing.T) {
+		resp, isUserError, err := plugin.runRerootThreadCommand([]string{rootPostID}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: the message is already the root of its thread")
+	})
+
+	t.Run("inside thread", func(t *testing.T) {
+		resp, isUserError, err := plugin.runRerootThreadCommand([]string{replyPostID}, &model.CommandArgs{ChannelId: channel1.Id, RootId: rootPostID})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: this command cannot be run from inside the thread")
+	})
+
+	t.Run("not in thread channel", func(t *testing.T) {
+		otherChannelID := model.NewId()
+		api.On("GetChannel", otherChannelID).Return(&model.Channel{Id: otherChannelID, TeamId: team1.Id}, nil)
+
+		resp, isUserError, err := plugin.runRerootThreadCommand([]string{replyPostID}, &model.CommandArgs{ChannelId: otherChannelID})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: this command must be run from the channel containing the post")
+	})
+
+	t.Run("reroot thread successfully", func(t *testing.T) {
+		resp, isUserError, err := plugin.runRerootThreadCommand([]string{replyPostID}, &model.CommandArgs{ChannelId: channel1.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "A thread with 4 message(s) has been rerooted")
+		api.AssertCalled(t, "DeletePost", rootPostID)
+	})
+}
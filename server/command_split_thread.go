@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const splitThreadUsage = `/wrangler split thread [REPLY_MESSAGE_ID] [CHANNEL_ID]
+  Split a thread into a new thread starting at a given reply
+    - The given reply and all replies after it are moved into a new thread with the given reply as the new root message
+    - The new thread can be created in the same channel or in any channel in any team that you have joined
+    - Use the '/wrangler list' commands to get message and channel IDs`
+
+func getSplitThreadMessage() string {
+	return codeBlock(fmt.Sprintf("`Error: missing arguments\n\n%s", splitThreadUsage))
+}
+
+func (p *Plugin) runSplitThreadCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	if len(args) < 2 {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, getSplitThreadMessage()), true, nil
+	}
+	postID := args[0]
+	channelID := args[1]
+
+	postListResponse, appErr := p.API.GetPostThread(postID)
+	if appErr != nil {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: unable to get post with ID %s; ensure this is correct", postID)), true, nil
+	}
+	originalWpl := buildWranglerPostList(postListResponse)
+	if originalWpl.NumPosts() == 0 {
+		return nil, false, errors.New("The wrangler post list contains no posts")
+	}
+	if originalWpl.RootPost().Id == postID {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: the message is the root of its thread; use '/wrangler move thread' to move the whole thread"), true, nil
+	}
+
+	wpl, err := originalWpl.SplitAt(postID)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "unable to split thread")
+	}
+
+	originalChannel, appErr := p.API.GetChannel(extra.ChannelId)
+	if appErr != nil {
+		return nil, false, fmt.Errorf("unable to get channel with ID %s", extra.ChannelId)
+	}
+	_, appErr = p.API.GetChannelMember(channelID, extra.UserId)
+	if appErr != nil {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: channel with ID %s doesn't exist or you are not a member", channelID)), true, nil
+	}
+	targetChannel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		return nil, false, fmt.Errorf("unable to get channel with ID %s", channelID)
+	}
+
+	response, userErr, err := p.validateMoveOrCopy(originalWpl, originalChannel, targetChannel, extra)
+	if response != nil || err != nil {
+		return response, userErr, err
+	}
+
+	targetTeam, appErr := p.API.GetTeam(targetChannel.TeamId)
+	if appErr != nil {
+		return nil, false, fmt.Errorf("unable to get team with ID %s", targetChannel.TeamId)
+	}
+
+	op := p.startOperation(operationTypeSplit, extra.UserId)
+	response, err = p.lockThreads(op, originalWpl.RootPost().Id)
+	if response != nil || err != nil {
+		return response, response != nil, err
+	}
+	op.startAudit([]*model.Channel{originalChannel}, targetChannel, wpl.Posts, "", nil)
+
+	return p.runOperation(op, wpl.NumPosts(), extra, func() (*model.CommandResponse, bool, error) {
+		return p.splitThread(originalWpl, wpl, originalChannel, targetChannel, targetTeam, op, extra)
+	})
+}
+
+// splitThread moves the split messages into a new thread once the split has
+// been validated.
+func (p *Plugin) splitThread(originalWpl, wpl *WranglerPostList, originalChannel, targetChannel *model.Channel, targetTeam *model.Team, op *operation, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	p.API.LogInfo("Wrangler is splitting a thread",
+		"user_id", extra.UserId,
+		"original_root_post_id", originalWpl.RootPost().Id,
+		"split_post_id", wpl.RootPost().Id,
+		"original_channel_id", originalChannel.Id,
+	)
+
+	// As with moving a thread, the split messages are first copied to the new
+	// thread and then the originals are deleted.
+	newRootPost, err := p.copyWranglerPostlist(wpl, targetChannel, op)
+	if err != nil {
+		return p.rollbackResponse(op, err)
+	}
+	op.setAuditNewRootID(newRootPost.Id)
+
+	botPost, appErr := p.API.CreatePost(&model.Post{
+		UserId:    p.BotUserID,
+		RootId:    newRootPost.Id,
+		ParentId:  newRootPost.Id,
+		ChannelId: targetChannel.Id,
+		Message:   "This thread was split from another thread",
+	})
+	if appErr != nil {
+		return p.rollbackResponse(op, errors.Wrap(appErr, "unable to create new bot post"))
+	}
+	op.recordPost(nil, botPost)
+
+	verification, err := p.verifyCopiedPosts(wpl.Posts, newRootPost.Id, op)
+	if err != nil {
+		return p.rollbackResponse(op, err)
+	}
+	if !verification.ok() {
+		return p.rollbackResponse(op, verification.error())
+	}
+
+	// Only the split replies are removed; the rest of the original thread is
+	// left as it was.
+	op.beginDeletes(getPostIDs(wpl.Posts)...)
+	for i, post := range wpl.Posts {
+		appErr := p.API.DeletePost(post.Id)
+		if appErr != nil {
+			err = errors.Wrap(appErr, "unable to delete post")
+			if i == 0 {
+				return p.rollbackResponse(op, err)
+			}
+			return p.partialDeleteResponse(op, err)
+		}
+	}
+	p.finishOperation(op)
+
+	newPostLink := makePostLink(*p.API.GetConfig().ServiceSettings.SiteURL, targetTeam.Name, newRootPost.Id)
+	_, appErr = p.API.CreatePost(&model.Post{
+		UserId:    p.BotUserID,
+		RootId:    originalWpl.RootPost().Id,
+		ParentId:  originalWpl.RootPost().Id,
+		ChannelId: originalChannel.Id,
+		Message:   fmt.Sprintf("Part of this thread has been split into a new thread: %s", newPostLink),
+	})
+	if appErr != nil {
+		return nil, false, errors.Wrap(appErr, "unable to create new bot post")
+	}
+
+	p.API.LogInfo("Wrangler thread split complete",
+		"user_id", extra.UserId,
+		"new_post_id", newRootPost.Id,
+		"new_channel_id", targetChannel.Id,
+	)
+
+	msg := fmt.Sprintf("%d message(s) have been split into a new thread: %s\n%s\n", wpl.NumPosts(), newPostLink, verification.summary())
+
+	return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, msg), false, nil
+}
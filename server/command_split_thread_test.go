@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitThreadCommand(t *testing.T) {
+	team1 := &model.Team{
+		Id:   model.NewId(),
+		Name: "team-1",
+	}
+	originalChannel := &model.Channel{
+		Id:     model.NewId(),
+		TeamId: team1.Id,
+		Name:   "original-channel",
+		Type:   model.CHANNEL_OPEN,
+	}
+	targetChannel := &model.Channel{
+		Id:     model.NewId(),
+		TeamId: team1.Id,
+		Name:   "target-channel",
+		Type:   model.CHANNEL_OPEN,
+	}
+
+	config := &model.Config{
+		ServiceSettings: model.ServiceSettings{
+			SiteURL: NewString("test.sampledomain.com"),
+		},
+	}
+
+	generatedPosts := mockGenerateThread(5, originalChannel.Id)
+	threadPosts := buildWranglerPostList(generatedPosts)
+	rootPostID := threadPosts.RootPost().Id
+	splitPostID := threadPosts.Posts[2].Id
+
+	posts := newMockPostStore()
+	for _, postID := range generatedPosts.Order {
+		posts.addThread(postID, generatedPosts)
+	}
+
+	api := &plugintest.API{}
+	api.On("GetChannel", originalChannel.Id).Return(originalChannel, nil)
+	api.On("GetChannel", targetChannel.Id).Return(targetChannel, nil)
+	api.On("GetPostThread", mock.AnythingOfType("string")).Return(posts.getPostThread, nil)
+	api.On("GetPost", mock.AnythingOfType("string")).Return(mockGeneratePost(), nil)
+	api.On("GetTeam", mock.AnythingOfType("string")).Return(team1, nil)
+	api.On("CreatePost", mock.Anything).Return(posts.createPost, nil)
+
+	plugin, _ := setupCommandTestPlugin(api, config)
+
+	t.Run("no args", func(t *testing.T) {
+		resp, isUserError, err := plugin.runSplitThreadCommand([]string{}, &model.CommandArgs{ChannelId: originalChannel.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: missing arguments")
+	})
+
+	t.Run("one arg", func(t *testing.T) {
+		resp, isUserError, err := plugin.runSplitThreadCommand([]string{splitPostID}, &model.CommandArgs{ChannelId: originalChannel.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: missing arguments")
+	})
+
+	t.Run("split at root post", func(t *testing.T) {
+		resp, isUserError, err := plugin.runSplitThreadCommand([]string{rootPostID, targetChannel.Id}, &model.CommandArgs{ChannelId: originalChannel.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: the message is the root of its thread")
+	})
+
+	t.Run("not in thread channel", func(t *testing.T) {
+		resp, isUserError, err := plugin.runSplitThreadCommand([]string{splitPostID, targetChannel.Id}, &model.CommandArgs{ChannelId: targetChannel.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: this command must be run from the channel containing the post")
+	})
+
+	t.Run("inside thread", func(t *testing.T) {
+		resp, isUserError, err := plugin.runSplitThreadCommand([]string{splitPostID, targetChannel.Id}, &model.CommandArgs{ChannelId: originalChannel.Id, RootId: rootPostID})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: this command cannot be run from inside the thread")
+	})
+
+	t.Run("split thread successfully", func(t *testing.T) {
+		resp, isUserError, err := plugin.runSplitThreadCommand([]string{splitPostID, targetChannel.Id}, &model.CommandArgs{ChannelId: originalChannel.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, fmt.Sprintf("3 message(s) have been split into a new thread: %s", makePostLink(*config.ServiceSettings.SiteURL, team1.Name, "")))
+		assert.Contains(t, resp.Text, "Verified 3 message(s), 0 file(s) and 0 reaction(s) before removing the originals.")
+		api.AssertNotCalled(t, "DeletePost", rootPostID)
+		api.AssertCalled(t, "DeletePost", splitPostID)
+	})
+}
+
+// mockGenerateThread returns a post list containing a root post and replies
+// with increasing creation timestamps.
+func mockGenerateThread(total int, channelID string) *model.PostList {
+	postList := model.NewPostList()
+	var rootID string
+	for i := 0; i < total; i++ {
+		post := &model.Post{
+			Id:        model.NewId(),
+			UserId:    model.NewId(),
+			ChannelId: channelID,
+			RootId:    rootID,
+			ParentId:  rootID,
+			Message:   fmt.Sprintf("This is message %d", i+1),
+			CreateAt:  int64(1000 + i),
+		}
+		if i == 0 {
+			rootID = post.Id
+		}
+		postList.AddPost(post)
+		postList.AddOrder(post.Id)
+	}
+
+	return postList
+}
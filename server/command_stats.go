@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+const (
+	statsUsage = `/wrangler stats [flags]
+  Summarize Wrangler operations
+    - Statistics for the whole server are only available to system administrators
+	Flags:
+%s`
+
+	flagStatsSince = "since"
+	flagStatsTeam  = "team"
+	flagStatsJSON  = "json"
+
+	defaultStatsSince = "30d"
+
+	// statsTopCount is how many channels and executors are listed in each
+	// ranking.
+	statsTopCount = 5
+)
+
+type statsOptions struct {
+	since      int64
+	team       bool
+	jsonOutput bool
+}
+
+// wranglerStats summarizes the audited operations of a time period.
+type wranglerStats struct {
+	Since             int64                 `json:"since"`
+	TeamID            string                `json:"team_id,omitempty"`
+	Operations        int                   `json:"operations"`
+	Failed            int                   `json:"failed"`
+	FailureRate       float64               `json:"failure_rate"`
+	AverageThreadSize float64               `json:"average_thread_size"`
+	Types             []*operationTypeStats `json:"types"`
+	TopSourceChannels []*statsRanking       `json:"top_source_channels"`
+	TopTargetChannels []*statsRanking       `json:"top_target_channels"`
+	TopExecutors      []*statsRanking       `json:"top_executors"`
+}
+
+// operationTypeStats summarizes the audited operations of one type.
+type operationTypeStats struct {
+	Type              string  `json:"type"`
+	Operations        int     `json:"operations"`
+	Failed            int     `json:"failed"`
+	FailureRate       float64 `json:"failure_rate"`
+	AverageThreadSize float64 `json:"average_thread_size"`
+
+	succeeded     int
+	postsWrangled int
+}
+
+// statsRanking is a channel or user along with how many operations it was
+// part of.
+type statsRanking struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Operations int    `json:"operations"`
+}
+
+func getStatsFlagSet() *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet("stats", pflag.ContinueOnError)
+	flagSet.String(flagStatsSince, defaultStatsSince, "Only include operations since this time. Accepts a duration such as 12h or 7d or an RFC3339 timestamp")
+	flagSet.Bool(flagStatsTeam, false, "Only include operations from or to channels of the current team")
+	flagSet.Bool(flagStatsJSON, false, "Show the statistics as JSON")
+
+	return flagSet
+}
+
+func getStatsUsage() string {
+	return fmt.Sprintf(statsUsage, getStatsFlagSet().FlagUsages())
+}
+
+func parseStatsArgs(args []string, now time.Time) (statsOptions, error) {
+	var options statsOptions
+
+	flagSet := getStatsFlagSet()
+	err := flagSet.Parse(args)
+	if err != nil {
+		return options, errors.Wrap(err, "unable to parse stats flag args")
+	}
+	if len(flagSet.Args()) != 0 {
+		return options, errors.Errorf("unexpected arguments: %s", strings.Join(flagSet.Args(), " "))
+	}
+
+	since, _ := flagSet.GetString(flagStatsSince)
+	options.since, err = parseTimeFlag(since, now)
+	if err != nil {
+		return options, errors.Wrapf(err, "invalid --%s value", flagStatsSince)
+	}
+	options.team, _ = flagSet.GetBool(flagStatsTeam)
+	options.jsonOutput, _ = flagSet.GetBool(flagStatsJSON)
+
+	return options, nil
+}
+
+func (p *Plugin) runStatsCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	user, appErr := p.API.GetUser(extra.UserId)
+	if appErr != nil {
+		return nil, false, errors.Wrap(appErr, "unable to find user")
+	}
+
+	options, err := parseStatsArgs(args, time.Now())
+	if err != nil {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, codeBlock(fmt.Sprintf("Error: %s\n\n%s", err.Error(), getStatsUsage()))), true, nil
+	}
+	if !options.team && !user.IsSystemAdmin() {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: only system administrators can view statistics for the whole server; use --%s to view statistics for this team", flagStatsTeam)), true, nil
+	}
+
+	filter := auditFilter{since: options.since}
+	if options.team {
+		filter.teamID = extra.TeamId
+	}
+	entries, err := p.getAuditEntries(filter)
+	if err != nil {
+		return nil, false, err
+	}
+
+	stats := computeStats(entries, statsTopCount)
+	stats.Since = options.since
+	stats.TeamID = filter.teamID
+	p.nameStatsRankings(stats, user)
+
+	if options.jsonOutput {
+		data, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			return nil, false, errors.Wrap(err, "unable to marshal stats")
+		}
+
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, codeBlock(string(data))), false, nil
+	}
+
+	return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, codeBlock(p.formatStats(stats))), false, nil
+}
+
+// computeStats summarizes the given audit entries. Rankings are limited to the
+// top entries, ordered by the number of operations and then by ID. Only
+// operations that succeeded count towards the average thread size, since
+// failed operations didn't wrangle their messages.
+func computeStats(entries []*auditEntry, top int) *wranglerStats {
+	stats := &wranglerStats{}
+	types := make(map[string]*operationTypeStats)
+	sourceChannels := make(map[string]int)
+	targetChannels := make(map[string]int)
+	executors := make(map[string]int)
+	var succeeded, postsWrangled int
+
+	for _, entry := range entries {
+		typeStats, ok := types[entry.Type]
+		if !ok {
+			typeStats = &operationTypeStats{Type: entry.Type}
+			types[entry.Type] = typeStats
+			stats.Types = append(stats.Types, typeStats)
+		}
+
+		stats.Operations++
+		typeStats.Operations++
+		if entry.Outcome == auditOutcomeSucceeded {
+			succeeded++
+			postsWrangled += entry.PostCount
+			typeStats.succeeded++
+			typeStats.postsWrangled += entry.PostCount
+		} else {
+			stats.Failed++
+			typeStats.Failed++
+		}
+
+		for _, channelID := range entry.SourceChannelIDs {
+			sourceChannels[channelID]++
+		}
+		targetChannels[entry.TargetChannelID]++
+		executors[entry.UserID]++
+	}
+
+	stats.FailureRate = ratio(stats.Failed, stats.Operations)
+	stats.AverageThreadSize = ratio(postsWrangled, succeeded)
+	for _, typeStats := range stats.Types {
+		typeStats.FailureRate = ratio(typeStats.Failed, typeStats.Operations)
+		typeStats.AverageThreadSize = ratio(typeStats.postsWrangled, typeStats.succeeded)
+	}
+	sort.Slice(stats.Types, func(i, j int) bool {
+		return stats.Types[i].Type < stats.Types[j].Type
+	})
+
+	stats.TopSourceChannels = rankStats(sourceChannels, top)
+	stats.TopTargetChannels = rankStats(targetChannels, top)
+	stats.TopExecutors = rankStats(executors, top)
+
+	return stats
+}
+
+func rankStats(counts map[string]int, top int) []*statsRanking {
+	rankings := make([]*statsRanking, 0, len(counts))
+	for id, count := range counts {
+		rankings = append(rankings, &statsRanking{ID: id, Operations: count})
+	}
+	sort.Slice(rankings, func(i, j int) bool {
+		if rankings[i].Operations != rankings[j].Operations {
+			return rankings[i].Operations > rankings[j].Operations
+		}
+		return rankings[i].ID < rankings[j].ID
+	})
+	if len(rankings) > top {
+		rankings = rankings[:top]
+	}
+
+	return rankings
+}
+
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+
+	return float64(a) / float64(b)
+}
+
+// nameStatsRankings sets the names of the ranked channels and executors. The
+// names of private channels, direct messages and group messages are only shown
+// to system admins and members of those channels.
+func (p *Plugin) nameStatsRankings(stats *wranglerStats, requester *model.User) {
+	for _, rankings := range [][]*statsRanking{stats.TopSourceChannels, stats.TopTargetChannels} {
+		for _, ranking := range rankings {
+			ranking.Name = p.getStatsChannelName(ranking.ID, requester)
+		}
+	}
+	for _, ranking := range stats.TopExecutors {
+		ranking.Name = ranking.ID
+		if user, appErr := p.API.GetUser(ranking.ID); appErr == nil {
+			ranking.Name = "@" + user.Username
+		}
+	}
+}
+
+func (p *Plugin) getStatsChannelName(channelID string, requester *model.User) string {
+	channel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		return channelID
+	}
+
+	if channel.Type != model.CHANNEL_OPEN && !requester.IsSystemAdmin() {
+		_, appErr = p.API.GetChannelMember(channelID, requester.Id)
+		if appErr != nil {
+			return "(private channel)"
+		}
+	}
+
+	if channel.Type == model.CHANNEL_DIRECT || channel.Type == model.CHANNEL_GROUP {
+		return channel.DisplayName
+	}
+
+	return "~" + channel.Name
+}
+
+// formatStats returns the statistics as plain text tables.
+func (p *Plugin) formatStats(stats *wranglerStats) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Wrangler statistics since %s", time.Unix(0, stats.Since*int64(time.Millisecond)).UTC().Format(time.RFC822))
+	if len(stats.TeamID) != 0 {
+		teamName := stats.TeamID
+		if team, appErr := p.API.GetTeam(stats.TeamID); appErr == nil {
+			teamName = team.Name
+		}
+		fmt.Fprintf(&b, " in team %s", teamName)
+	}
+	b.WriteString("\n\n")
+
+	if stats.Operations == 0 {
+		b.WriteString("No operations were found")
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "Operations: %d\n", stats.Operations)
+	fmt.Fprintf(&b, "Failed: %d (%.1f%%)\n", stats.Failed, stats.FailureRate*100)
+	fmt.Fprintf(&b, "Average thread size: %.1f message(s)\n\n", stats.AverageThreadSize)
+
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Type\tOperations\tFailed\tFailure rate\tAverage thread size")
+	for _, typeStats := range stats.Types {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f%%\t%.1f\n", typeStats.Type, typeStats.Operations, typeStats.Failed, typeStats.FailureRate*100, typeStats.AverageThreadSize)
+	}
+	w.Flush()
+
+	writeRankings := func(title string, rankings []*statsRanking) {
+		fmt.Fprintf(&b, "\n%s\n", title)
+		w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		for _, ranking := range rankings {
+			fmt.Fprintf(w, "  %s\t%d\n", ranking.Name, ranking.Operations)
+		}
+		w.Flush()
+	}
+	writeRankings("Most active source channels", stats.TopSourceChannels)
+	writeRankings("Most active destination channels", stats.TopTargetChannels)
+	writeRankings("Top executors", stats.TopExecutors)
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStatsArgs(t *testing.T) {
+	now := time.Now()
+
+	t.Run("no flags", func(t *testing.T) {
+		options, err := parseStatsArgs([]string{}, now)
+		require.NoError(t, err)
+		assert.Equal(t, model.GetMillisForTime(now.AddDate(0, 0, -30)), options.since)
+		assert.False(t, options.team)
+		assert.False(t, options.jsonOutput)
+	})
+
+	t.Run("all flags", func(t *testing.T) {
+		options, err := parseStatsArgs([]string{"--since", "7d", "--team", "--json"}, now)
+		require.NoError(t, err)
+		assert.Equal(t, model.GetMillisForTime(now.AddDate(0, 0, -7)), options.since)
+		assert.True(t, options.team)
+		assert.True(t, options.jsonOutput)
+	})
+
+	t.Run("invalid since", func(t *testing.T) {
+		_, err := parseStatsArgs([]string{"--since", "last week"}, now)
+		require.Error(t, err)
+	})
+
+	t.Run("unexpected arguments", func(t *testing.T) {
+		_, err := parseStatsArgs([]string{"extra"}, now)
+		require.Error(t, err)
+	})
+}
+
+func TestComputeStats(t *testing.T) {
+	t.Run("no entries", func(t *testing.T) {
+		stats := computeStats(nil, statsTopCount)
+		assert.Zero(t, stats.Operations)
+		assert.Zero(t, stats.FailureRate)
+		assert.Zero(t, stats.AverageThreadSize)
+		assert.Empty(t, stats.Types)
+		assert.Empty(t, stats.TopSourceChannels)
+	})
+
+	entries := []*auditEntry{
+		{Type: operationTypeMove, UserID: "user1", SourceChannelIDs: []string{"channel1"}, TargetChannelID: "channel2", PostCount: 4, Outcome: auditOutcomeSucceeded},
+		{Type: operationTypeMove, UserID: "user1", SourceChannelIDs: []string{"channel1"}, TargetChannelID: "channel3", PostCount: 2, Outcome: auditOutcomeSucceeded},
+		{Type: operationTypeMove, UserID: "user2", SourceChannelIDs: []string{"channel1"}, TargetChannelID: "channel2", PostCount: 100, Outcome: auditOutcomeRolledBack},
+		{Type: operationTypeMerge, UserID: "user2", SourceChannelIDs: []string{"channel3", "channel4"}, TargetChannelID: "channel2", PostCount: 3, Outcome: auditOutcomeSucceeded},
+	}
+
+	stats := computeStats(entries, 2)
+	assert.Equal(t, 4, stats.Operations)
+	assert.Equal(t, 1, stats.Failed)
+	assert.Equal(t, 0.25, stats.FailureRate)
+	assert.Equal(t, 3.0, stats.AverageThreadSize)
+
+	require.Len(t, stats.Types, 2)
+	assert.Equal(t, operationTypeMerge, stats.Types[0].Type)
+	assert.Equal(t, 1, stats.Types[0].Operations)
+	assert.Zero(t, stats.Types[0].FailureRate)
+	assert.Equal(t, operationTypeMove, stats.Types[1].Type)
+	assert.Equal(t, 3, stats.Types[1].Operations)
+	assert.Equal(t, 1, stats.Types[1].Failed)
+	assert.InDelta(t, 1.0/3, stats.Types[1].FailureRate, 0.0001)
+	assert.Equal(t, 3.0, stats.Types[1].AverageThreadSize)
+
+	assert.Equal(t, []*statsRanking{{ID: "channel1", Operations: 3}, {ID: "channel3", Operations: 1}}, stats.TopSourceChannels)
+	assert.Equal(t, []*statsRanking{{ID: "channel2", Operations: 3}, {ID: "channel3", Operations: 1}}, stats.TopTargetChannels)
+	assert.Equal(t, []*statsRanking{{ID: "user1", Operations: 2}, {ID: "user2", Operations: 2}}, stats.TopExecutors)
+}
+
+func TestStatsCommand(t *testing.T) {
+	admin := &model.User{Id: model.NewId(), Username: "admin", Roles: model.SYSTEM_ADMIN_ROLE_ID}
+	user := &model.User{Id: model.NewId(), Username: "user", Roles: model.SYSTEM_USER_ROLE_ID}
+
+	team := &model.Team{Id: model.NewId(), Name: "team-1"}
+	publicChannel := &model.Channel{Id: model.NewId(), TeamId: team.Id, Name: "town-square", Type: model.CHANNEL_OPEN}
+	privateChannel := &model.Channel{Id: model.NewId(), TeamId: team.Id, Name: "secret", Type: model.CHANNEL_PRIVATE}
+	otherTeamChannel := &model.Channel{Id: model.NewId(), TeamId: model.NewId(), Name: "elsewhere", Type: model.CHANNEL_OPEN}
+
+	api := &plugintest.API{}
+	newMockKVStore(api)
+	api.On("GetUser", admin.Id).Return(admin, nil)
+	api.On("GetUser", user.Id).Return(user, nil)
+	api.On("GetTeam", team.Id).Return(team, nil)
+	api.On("GetChannel", publicChannel.Id).Return(publicChannel, nil)
+	api.On("GetChannel", privateChannel.Id).Return(privateChannel, nil)
+	api.On("GetChannel", otherTeamChannel.Id).Return(otherTeamChannel, nil)
+	api.On("GetChannelMember", privateChannel.Id, user.Id).Return(nil, &model.AppError{Message: "not found"})
+
+	var plugin Plugin
+	plugin.SetAPI(api)
+
+	record := func(opType, userID string, source, target *model.Channel, outcome string) {
+		op := newOperation(opType, userID)
+		op.startAudit([]*model.Channel{source}, target, []*model.Post{{Id: model.NewId()}, {Id: model.NewId()}}, "", nil)
+		plugin.recordAudit(op, outcome, nil)
+	}
+	record(operationTypeMove, user.Id, publicChannel, privateChannel, auditOutcomeSucceeded)
+	record(operationTypeMove, user.Id, publicChannel, privateChannel, auditOutcomeSucceeded)
+	record(operationTypeCopy, admin.Id, publicChannel, publicChannel, auditOutcomeRolledBack)
+	record(operationTypeMove, admin.Id, otherTeamChannel, otherTeamChannel, auditOutcomeSucceeded)
+
+	t.Run("not an admin", func(t *testing.T) {
+		resp, isUserError, err := plugin.runStatsCommand([]string{}, &model.CommandArgs{UserId: user.Id, TeamId: team.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: only system administrators can view statistics for the whole server")
+	})
+
+	t.Run("whole server", func(t *testing.T) {
+		resp, isUserError, err := plugin.runStatsCommand([]string{}, &model.CommandArgs{UserId: admin.Id, TeamId: team.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.True(t, strings.HasPrefix(resp.Text, "```\nWrangler statistics since "))
+		assert.Contains(t, resp.Text, "Operations: 4\n")
+		assert.Contains(t, resp.Text, "Failed: 1 (25.0%)\n")
+		assert.Contains(t, resp.Text, "Average thread size: 2.0 message(s)\n")
+		assert.Contains(t, resp.Text, "~elsewhere")
+		assert.Contains(t, resp.Text, "~secret")
+		assert.Contains(t, resp.Text, "@admin")
+	})
+
+	t.Run("team as a member", func(t *testing.T) {
+		resp, isUserError, err := plugin.runStatsCommand([]string{"--team"}, &model.CommandArgs{UserId: user.Id, TeamId: team.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, " in team team-1\n")
+		assert.Contains(t, resp.Text, "Operations: 3\n")
+		assert.Contains(t, resp.Text, "Most active source channels\n  ~town-square  3\n")
+		assert.Contains(t, resp.Text, "(private channel)")
+		assert.NotContains(t, resp.Text, "~secret")
+		assert.NotContains(t, resp.Text, "~elsewhere")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		resp, isUserError, err := plugin.runStatsCommand([]string{"--team", "--json"}, &model.CommandArgs{UserId: admin.Id, TeamId: team.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		require.True(t, strings.HasPrefix(resp.Text, "```\n"))
+
+		var stats wranglerStats
+		require.NoError(t, json.Unmarshal([]byte(strings.Trim(resp.Text, "`\n")), &stats))
+		assert.Equal(t, team.Id, stats.TeamID)
+		assert.Equal(t, 3, stats.Operations)
+		assert.Equal(t, 1, stats.Failed)
+		require.Len(t, stats.Types, 2)
+		assert.Equal(t, operationTypeCopy, stats.Types[0].Type)
+		require.NotEmpty(t, stats.TopTargetChannels)
+		assert.Equal(t, privateChannel.Id, stats.TopTargetChannels[0].ID)
+		assert.Equal(t, "~secret", stats.TopTargetChannels[0].Name)
+	})
+
+	t.Run("no operations", func(t *testing.T) {
+		inAnHour := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		resp, isUserError, err := plugin.runStatsCommand([]string{"--since", inAnHour}, &model.CommandArgs{UserId: admin.Id})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "No operations were found")
+	})
+
+	t.Run("invalid flags", func(t *testing.T) {
+		resp, isUserError, err := plugin.runStatsCommand([]string{"--since", "soon"}, &model.CommandArgs{UserId: admin.Id})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "invalid --since value")
+	})
+
+	api.AssertNotCalled(t, "GetChannelMember", privateChannel.Id, admin.Id)
+}
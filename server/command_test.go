@@ -90,6 +90,54 @@ func TestCommand(t *testing.T) {
 			})
 		})
 
+		t.Run("split command", func(t *testing.T) {
+			t.Run("missing extra args", func(t *testing.T) {
+				args := &model.CommandArgs{UserId: user.Id, Command: "wrangler split"}
+				resp, appErr := plugin.ExecuteCommand(context, args)
+				require.Nil(t, appErr)
+				require.Equal(t, plugin.getHelp(), resp.Text)
+			})
+
+			t.Run("invalid extra args", func(t *testing.T) {
+				args := &model.CommandArgs{UserId: user.Id, Command: "wrangler split invalid"}
+				resp, appErr := plugin.ExecuteCommand(context, args)
+				require.Nil(t, appErr)
+				require.Equal(t, plugin.getHelp(), resp.Text)
+			})
+		})
+
+		t.Run("flatten command", func(t *testing.T) {
+			t.Run("missing extra args", func(t *testing.T) {
+				args := &model.CommandArgs{UserId: user.Id, Command: "wrangler flatten"}
+				resp, appErr := plugin.ExecuteCommand(context, args)
+				require.Nil(t, appErr)
+				require.Equal(t, plugin.getHelp(), resp.Text)
+			})
+
+			t.Run("invalid extra args", func(t *testing.T) {
+				args := &model.CommandArgs{UserId: user.Id, Command: "wrangler flatten invalid"}
+				resp, appErr := plugin.ExecuteCommand(context, args)
+				require.Nil(t, appErr)
+				require.Equal(t, plugin.getHelp(), resp.Text)
+			})
+		})
+
+		t.Run("reroot command", func(t *testing.T) {
+			t.Run("missing extra args", func(t *testing.T) {
+				args := &model.CommandArgs{UserId: user.Id, Command: "wrangler reroot"}
+				resp, appErr := plugin.ExecuteCommand(context, args)
+				require.Nil(t, appErr)
+				require.Equal(t, plugin.getHelp(), resp.Text)
+			})
+
+			t.Run("invalid extra args", func(t *testing.T) {
+				args := &model.CommandArgs{UserId: user.Id, Command: "wrangler reroot invalid"}
+				resp, appErr := plugin.ExecuteCommand(context, args)
+				require.Nil(t, appErr)
+				require.Equal(t, plugin.getHelp(), resp.Text)
+			})
+		})
+
 		t.Run("attach command", func(t *testing.T) {
 			t.Run("missing extra args", func(t *testing.T) {
 				args := &model.CommandArgs{UserId: user.Id, Command: "wrangler attach"}
@@ -106,6 +154,31 @@ func TestCommand(t *testing.T) {
 			})
 		})
 
+		t.Run("detach command", func(t *testing.T) {
+			t.Run("missing extra args", func(t *testing.T) {
+				args := &model.CommandArgs{UserId: user.Id, Command: "wrangler detach"}
+				resp, appErr := plugin.ExecuteCommand(context, args)
+				require.Nil(t, appErr)
+				require.Equal(t, plugin.getHelp(), resp.Text)
+			})
+
+			t.Run("invalid extra args", func(t *testing.T) {
+				args := &model.CommandArgs{UserId: user.Id, Command: "wrangler detach invalid"}
+				resp, appErr := plugin.ExecuteCommand(context, args)
+				require.Nil(t, appErr)
+				require.Equal(t, plugin.getHelp(), resp.Text)
+			})
+		})
+
+		t.Run("gather command", func(t *testing.T) {
+			t.Run("missing extra args", func(t *testing.T) {
+				args := &model.CommandArgs{UserId: user.Id, Command: "wrangler gather"}
+				resp, appErr := plugin.ExecuteCommand(context, args)
+				require.Nil(t, appErr)
+				assert.Contains(t, resp.Text, "Error: missing arguments")
+			})
+		})
+
 		t.Run("merge command", func(t *testing.T) {
 			t.Run("missing extra args", func(t *testing.T) {
 				args := &model.CommandArgs{UserId: user.Id, Command: "wrangler merge"}
@@ -149,6 +222,20 @@ func TestCommand(t *testing.T) {
 		assert.Equal(t, infoResp, resp)
 	})
 
+	t.Run("commands are counted in the metrics", func(t *testing.T) {
+		plugin.metrics = newMetrics()
+		defer func() { plugin.metrics = nil }()
+
+		for _, command := range []string{"wrangler info", "wrangler info", "wrangler move thread", "wrangler merge thread", "wrangler merge threads"} {
+			_, appErr := plugin.ExecuteCommand(context, &model.CommandArgs{UserId: user.Id, Command: command})
+			require.Nil(t, appErr)
+		}
+
+		assert.Equal(t, uint64(2), plugin.metrics.commands[[2]string{"info", commandOutcomeSuccess}])
+		assert.Equal(t, uint64(1), plugin.metrics.commands[[2]string{"move thread", commandOutcomeUserError}])
+		assert.Equal(t, uint64(2), plugin.metrics.commands[[2]string{"merge thread", commandOutcomeUserError}])
+	})
+
 	t.Run("permissions", func(t *testing.T) {
 		t.Run("empty permission configuration", func(t *testing.T) {
 			plugin.setConfiguration(&configuration{
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const undoUsage = `/wrangler undo [OPERATION_ID]
+  Undo a move, copy, merge or attach operation
+    - Moved, merged and attached messages are restored to where they were and the messages created by the operation are removed
+    - Copied messages are removed
+    - Restored messages keep their reactions and file attachments, but have new message IDs
+    - When no operation ID is provided, your most recent operation is undone`
+
+func (p *Plugin) runUndoCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	var operationID string
+	if len(args) > 0 {
+		operationID = args[0]
+	} else {
+		var err error
+		operationID, err = p.getLastOperationID(extra.UserId)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(operationID) == 0 {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: you have no operations to undo"), true, nil
+		}
+	}
+
+	op, err := p.getOperation(operationID)
+	if err != nil {
+		return nil, false, err
+	}
+	if op == nil {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: unable to find operation with ID %s; ensure this is correct", operationID)), true, nil
+	}
+	if op.UserID != extra.UserId {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: only the user who ran an operation can undo it"), true, nil
+	}
+	if op.Undone {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: operation %s has already been undone", op.ID)), true, nil
+	}
+
+	// Every post created by the operation must still exist, otherwise the
+	// messages it was created from can't be fully restored.
+	newPosts := make(map[string]*model.Post)
+	for _, entry := range op.Posts {
+		newPost, appErr := p.API.GetPost(entry.NewID)
+		if appErr != nil || newPost.DeleteAt != 0 {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: message with ID %s created by operation %s no longer exists, so the operation can't be undone", entry.NewID, op.ID)), true, nil
+		}
+		newPosts[entry.NewID] = newPost
+	}
+
+	p.API.LogInfo("Wrangler is undoing an operation",
+		"user_id", extra.UserId,
+		"operation_id", op.ID,
+		"operation_type", op.Type,
+	)
+
+	var restoredRootPost *model.Post
+	restoreOp := p.startOperation(operationTypeUndo, extra.UserId)
+	restoreOp.UndoneOperationID = op.ID
+
+	// The threads created by the operation are locked so that they can't be
+	// wrangled again while they are being undone.
+	var rootIDs []string
+	for _, newPost := range newPosts {
+		rootIDs = append(rootIDs, getPostRootID(newPost))
+	}
+	response, err := p.lockThreads(restoreOp, rootIDs...)
+	if response != nil || err != nil {
+		return response, response != nil, err
+	}
+	defer restoreOp.unlock()
+
+	if op.Audit != nil && len(op.Posts) != 0 {
+		// Copied messages are only removed, while the others are restored to
+		// the channel they came from.
+		auditChannelID := newPosts[op.Posts[0].NewID].ChannelId
+		if op.Type != operationTypeCopy && len(op.Posts[0].OriginalChannelID) != 0 {
+			auditChannelID = op.Posts[0].OriginalChannelID
+		}
+		auditChannel, appErr := p.API.GetChannel(auditChannelID)
+		if appErr != nil {
+			return nil, false, errors.Wrapf(appErr, "unable to get channel with ID %s", auditChannelID)
+		}
+		restoreOp.startUndoAudit(op, auditChannel)
+	}
+
+	if op.Type != operationTypeCopy {
+		restoredRootPost, err = p.restoreOperationPosts(op, newPosts, restoreOp)
+		if err != nil {
+			return p.rollbackResponse(restoreOp, err)
+		}
+		if restoredRootPost != nil {
+			restoreOp.setAuditNewRootID(restoredRootPost.Id)
+		}
+	}
+
+	// Posts are deleted newest first so that replies are removed before the
+	// root post they belong to.
+	var postIDs []string
+	for i := len(op.Posts) - 1; i >= 0; i-- {
+		postIDs = append(postIDs, op.Posts[i].NewID)
+	}
+	restoreOp.beginDeletes(postIDs...)
+	for i := len(op.Posts) - 1; i >= 0; i-- {
+		appErr := p.API.DeletePost(op.Posts[i].NewID)
+		if appErr != nil {
+			err = errors.Wrap(appErr, "unable to delete post")
+			if i == len(op.Posts)-1 {
+				return p.rollbackResponse(restoreOp, err)
+			}
+			return p.partialDeleteResponse(restoreOp, err)
+		}
+	}
+
+	op.Undone = true
+	err = p.saveOperation(op)
+	if err != nil {
+		return nil, false, err
+	}
+	p.finishOperation(restoreOp)
+
+	p.API.LogInfo("Wrangler operation undo complete",
+		"user_id", extra.UserId,
+		"operation_id", op.ID,
+		"operation_type", op.Type,
+	)
+
+	if restoredRootPost == nil {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Operation %s has been undone; %d copied message(s) have been removed", op.ID, op.originalPostCount())), false, nil
+	}
+
+	channel, appErr := p.API.GetChannel(restoredRootPost.ChannelId)
+	if appErr != nil {
+		return nil, false, errors.Wrapf(appErr, "unable to get channel with ID %s", restoredRootPost.ChannelId)
+	}
+	team, appErr := p.API.GetTeam(channel.TeamId)
+	if appErr != nil {
+		return nil, false, errors.Wrapf(appErr, "unable to get team with ID %s", channel.TeamId)
+	}
+	restoredPostLink := makePostLink(*p.API.GetConfig().ServiceSettings.SiteURL, team.Name, restoredRootPost.Id)
+
+	return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Operation %s has been undone; %d message(s) have been restored: %s", op.ID, op.originalPostCount(), restoredPostLink)), false, nil
+}
+
+// restoreOperationPosts recreates the original posts of an operation from the
+// posts the operation created. Posts are restored in the order they were
+// journaled, so thread roots are restored before their replies. The first
+// restored post is returned. Restored posts and re-uploaded files are recorded
+// in the restore operation.
+func (p *Plugin) restoreOperationPosts(op *operation, newPosts map[string]*model.Post, restoreOp *operation) (*model.Post, error) {
+	var firstRestoredPost *model.Post
+	restoredIDs := make(map[string]string)
+
+	for _, entry := range op.Posts {
+		if len(entry.OriginalID) == 0 {
+			// Posts created by Wrangler itself have nothing to restore.
+			continue
+		}
+		newPost := newPosts[entry.NewID]
+
+		restoredPost := newPost.Clone()
+		cleanPostID(restoredPost)
+		if entry.OriginalCreateAt != 0 {
+			// Operations journaled before creation times were recorded are
+			// restored with the time of the operation instead.
+			restoredPost.CreateAt = entry.OriginalCreateAt
+		}
+		restoredPost.ChannelId = entry.OriginalChannelID
+		restoredPost.RootId = entry.OriginalRootID
+		if restoredRootID, ok := restoredIDs[entry.OriginalRootID]; ok {
+			restoredPost.RootId = restoredRootID
+		}
+		restoredPost.ParentId = restoredPost.RootId
+
+		if len(newPost.FileIds) != 0 {
+			newFileIDs, err := p.reuploadFileAttachments(newPost.FileIds, entry.OriginalChannelID)
+			restoreOp.recordUploadedFiles(newFileIDs)
+			if err != nil {
+				return nil, err
+			}
+			restoredPost.FileIds = newFileIDs
+		}
+
+		reactions, appErr := p.API.GetReactions(newPost.Id)
+		if appErr != nil {
+			// Reaction-based errors are logged, but do not cause the plugin to
+			// abort the undo process.
+			p.API.LogError("Failed to get reactions on post to be restored", "err", appErr)
+		}
+
+		restoredPost, err := p.createPostWithRetries(restoredPost, retryBaseDelay, retryMaxRetries)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to restore message %s", entry.OriginalID)
+		}
+		restoreOp.recordPost(newPost, restoredPost)
+
+		p.reapplyReactions(reactions, restoredPost.Id)
+
+		restoredIDs[entry.OriginalID] = restoredPost.Id
+		if firstRestoredPost == nil {
+			firstRestoredPost = restoredPost
+		}
+	}
+
+	return firstRestoredPost, nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUndoCommand(t *testing.T) {
+	team1 := &model.Team{
+		Id:   model.NewId(),
+		Name: "team-1",
+	}
+	originalChannel := &model.Channel{
+		Id:     model.NewId(),
+		TeamId: team1.Id,
+		Name:   "original-channel",
+		Type:   model.CHANNEL_OPEN,
+	}
+	targetChannel := &model.Channel{
+		Id:     model.NewId(),
+		TeamId: team1.Id,
+		Name:   "target-channel",
+		Type:   model.CHANNEL_OPEN,
+	}
+	userID := model.NewId()
+
+	originalRoot := &model.Post{
+		Id:        model.NewId(),
+		ChannelId: originalChannel.Id,
+		CreateAt:  500,
+	}
+	originalReply := &model.Post{
+		Id:        model.NewId(),
+		ChannelId: originalChannel.Id,
+		RootId:    originalRoot.Id,
+		ParentId:  originalRoot.Id,
+		CreateAt:  501,
+	}
+	newRoot := &model.Post{
+		Id:        model.NewId(),
+		ChannelId: targetChannel.Id,
+		Message:   "root",
+		CreateAt:  1000,
+	}
+	newReply := &model.Post{
+		Id:        model.NewId(),
+		ChannelId: targetChannel.Id,
+		RootId:    newRoot.Id,
+		ParentId:  newRoot.Id,
+		Message:   "reply",
+		CreateAt:  1001,
+	}
+	botPost := &model.Post{
+		Id:        model.NewId(),
+		ChannelId: targetChannel.Id,
+		RootId:    newRoot.Id,
+		ParentId:  newRoot.Id,
+	}
+	deletedPost := &model.Post{
+		Id:       model.NewId(),
+		DeleteAt: 1,
+	}
+
+	moveOp := newOperation(operationTypeMove, userID)
+	moveOp.startAudit([]*model.Channel{originalChannel}, targetChannel, []*model.Post{originalRoot, originalReply}, newRoot.Id, nil)
+	moveOp.recordPost(originalRoot, newRoot)
+	moveOp.recordPost(originalReply, newReply)
+	moveOp.recordPost(nil, botPost)
+
+	copyOp := newOperation(operationTypeCopy, userID)
+	copyOp.recordPost(originalRoot, newRoot)
+	copyOp.recordPost(originalReply, newReply)
+	copyOp.recordPost(nil, botPost)
+
+	undoneOp := newOperation(operationTypeMove, userID)
+	undoneOp.recordPost(originalRoot, newRoot)
+	undoneOp.Undone = true
+
+	otherUserOp := newOperation(operationTypeMove, model.NewId())
+	otherUserOp.recordPost(originalRoot, newRoot)
+
+	missingPostOp := newOperation(operationTypeMove, userID)
+	missingPostOp.recordPost(originalRoot, deletedPost)
+
+	config := &model.Config{
+		ServiceSettings: model.ServiceSettings{
+			SiteURL: NewString("test.sampledomain.com"),
+		},
+	}
+
+	api := &plugintest.API{}
+	for _, op := range []*operation{moveOp, copyOp, undoneOp, otherUserOp, missingPostOp} {
+		data, err := json.Marshal(op)
+		require.NoError(t, err)
+		api.On("KVGet", operationKey(op.ID)).Return(data, nil)
+	}
+	api.On("KVGet", lastOperationKey(userID)).Return([]byte(moveOp.ID), nil)
+	api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+	api.On("KVSet", mock.AnythingOfType("string"), mock.Anything).Return(nil)
+	api.On("KVDelete", mock.AnythingOfType("string")).Return(nil)
+	api.On("KVSetWithOptions", mock.AnythingOfType("string"), mock.Anything, mock.AnythingOfType("model.PluginKVSetOptions")).Return(true, nil)
+	api.On("KVCompareAndDelete", mock.AnythingOfType("string"), mock.Anything).Return(true, nil)
+	api.On("GetPost", newRoot.Id).Return(newRoot, nil)
+	api.On("GetPost", newReply.Id).Return(newReply, nil)
+	api.On("GetPost", botPost.Id).Return(botPost, nil)
+	api.On("GetPost", deletedPost.Id).Return(deletedPost, nil)
+	api.On("GetChannel", originalChannel.Id).Return(originalChannel, nil)
+	api.On("GetTeam", team1.Id).Return(team1, nil)
+	api.On("GetReactions", mock.AnythingOfType("string")).Return([]*model.Reaction{}, nil)
+	api.On("CreatePost", mock.Anything).Return(func(post *model.Post) *model.Post {
+		created := post.Clone()
+		created.Id = model.NewId()
+		return created
+	}, nil)
+	api.On("DeletePost", mock.AnythingOfType("string")).Return(nil)
+	api.On("GetConfig").Return(config)
+	api.On("LogInfo",
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+	).Return(nil)
+
+	var plugin Plugin
+	plugin.SetAPI(api)
+
+	t.Run("no operations to undo", func(t *testing.T) {
+		resp, isUserError, err := plugin.runUndoCommand([]string{}, &model.CommandArgs{UserId: model.NewId()})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: you have no operations to undo")
+	})
+
+	t.Run("unknown operation", func(t *testing.T) {
+		resp, isUserError, err := plugin.runUndoCommand([]string{model.NewId()}, &model.CommandArgs{UserId: userID})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: unable to find operation with ID")
+	})
+
+	t.Run("operation run by another user", func(t *testing.T) {
+		resp, isUserError, err := plugin.runUndoCommand([]string{otherUserOp.ID}, &model.CommandArgs{UserId: userID})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "Error: only the user who ran an operation can undo it")
+	})
+
+	t.Run("operation already undone", func(t *testing.T) {
+		resp, isUserError, err := plugin.runUndoCommand([]string{undoneOp.ID}, &model.CommandArgs{UserId: userID})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "has already been undone")
+	})
+
+	t.Run("created post no longer exists", func(t *testing.T) {
+		resp, isUserError, err := plugin.runUndoCommand([]string{missingPostOp.ID}, &model.CommandArgs{UserId: userID})
+		require.NoError(t, err)
+		assert.True(t, isUserError)
+		assert.Contains(t, resp.Text, "no longer exists, so the operation can't be undone")
+	})
+
+	t.Run("undo copy", func(t *testing.T) {
+		callCount := len(api.Calls)
+		resp, isUserError, err := plugin.runUndoCommand([]string{copyOp.ID}, &model.CommandArgs{UserId: userID})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "2 copied message(s) have been removed")
+
+		var deleted []string
+		for _, call := range api.Calls[callCount:] {
+			assert.NotEqual(t, "CreatePost", call.Method)
+			if call.Method == "DeletePost" {
+				deleted = append(deleted, call.Arguments.String(0))
+			}
+		}
+		assert.Equal(t, []string{botPost.Id, newReply.Id, newRoot.Id}, deleted)
+	})
+
+	t.Run("undo most recent move", func(t *testing.T) {
+		callCount := len(api.Calls)
+		resp, isUserError, err := plugin.runUndoCommand([]string{}, &model.CommandArgs{UserId: userID})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "2 message(s) have been restored")
+
+		var created []*model.Post
+		var deleted []string
+		for _, call := range api.Calls[callCount:] {
+			switch call.Method {
+			case "CreatePost":
+				created = append(created, call.Arguments.Get(0).(*model.Post))
+			case "DeletePost":
+				deleted = append(deleted, call.Arguments.String(0))
+			}
+		}
+		require.Len(t, created, 2)
+		assert.Equal(t, originalChannel.Id, created[0].ChannelId)
+		assert.Empty(t, created[0].RootId)
+		assert.Equal(t, originalRoot.CreateAt, created[0].CreateAt)
+		assert.Equal(t, originalChannel.Id, created[1].ChannelId)
+		assert.Equal(t, originalReply.CreateAt, created[1].CreateAt)
+		assert.NotEmpty(t, created[1].RootId)
+		assert.NotEqual(t, originalRoot.Id, created[1].RootId)
+		assert.Equal(t, newReply.Message, created[1].Message)
+		assert.Equal(t, []string{botPost.Id, newReply.Id, newRoot.Id}, deleted)
+
+		var audited *auditEntry
+		for _, call := range api.Calls[callCount:] {
+			if call.Method == "KVSet" && strings.HasPrefix(call.Arguments.String(0), auditKeyPrefix) {
+				audited = &auditEntry{}
+				require.NoError(t, json.Unmarshal(call.Arguments.Get(1).([]byte), audited))
+			}
+		}
+		require.NotNil(t, audited)
+		assert.Equal(t, operationTypeUndo, audited.Type)
+		assert.Equal(t, moveOp.ID, audited.UndoneID)
+		assert.Equal(t, auditOutcomeSucceeded, audited.Outcome)
+		assert.Equal(t, []string{targetChannel.Id}, audited.SourceChannelIDs)
+		assert.Equal(t, originalChannel.Id, audited.TargetChannelID)
+		assert.Equal(t, 2, audited.PostCount)
+		assert.NotEmpty(t, audited.NewRootID)
+	})
+}
@@ -41,6 +41,12 @@ type configuration struct {
 	MoveThreadFromGroupMessageChannelEnable  bool
 	MergeThreadEnable                        bool
 
+	QuarantineChannelID     string
+	QuarantineRetentionDays string
+
+	AuditChannelID string
+	MetricsToken   string
+
 	ThreadAttachMessage string
 	MoveThreadMessage   string
 	CopyThreadMessage   string
@@ -74,6 +80,11 @@ func (c *configuration) IsValid() error {
 		return errors.Wrap(err, "invalid MoveThreadMaxSize")
 	}
 
+	_, err = parseAndValidateQuarantineRetentionDays(c.QuarantineRetentionDays)
+	if err != nil {
+		return errors.Wrap(err, "invalid QuarantineRetentionDays")
+	}
+
 	return nil
 }
 
@@ -104,6 +115,39 @@ func parseAndValidateMaxThreadCountMoveSize(s string) (int, error) {
 	return max, nil
 }
 
+// SoftMoveEnabled returns whether original threads are quarantined instead of
+// deleted when they are moved or merged.
+func (c *configuration) SoftMoveEnabled() bool {
+	return len(c.QuarantineChannelID) != 0
+}
+
+func (c *configuration) QuarantineRetentionDaysInt() int {
+	// Use the parseAndValidate function, but ignore the error.
+	i, _ := parseAndValidateQuarantineRetentionDays(c.QuarantineRetentionDays)
+
+	return i
+}
+
+// parseAndValidateQuarantineRetentionDays parses the quarantine retention
+// config value and returns an error if the value is invalid or cannot be
+// parsed. If QuarantineRetentionDays is not configured, the default retention
+// is used.
+func parseAndValidateQuarantineRetentionDays(s string) (int, error) {
+	if len(s) == 0 {
+		return defaultQuarantineRetentionDays, nil
+	}
+
+	days, err := strconv.Atoi(s)
+	if err != nil {
+		return defaultQuarantineRetentionDays, errors.Wrapf(err, "QuarantineRetentionDays value %s is not a valid integer", s)
+	}
+	if days < 1 {
+		return defaultQuarantineRetentionDays, fmt.Errorf("QuarantineRetentionDays (%d) must be greater than 0", days)
+	}
+
+	return days, nil
+}
+
 // getConfiguration retrieves the active configuration under lock, making it safe to use
 // concurrently. The active configuration may change underneath the client of this method, but
 // the struct returned by this API call is considered immutable.
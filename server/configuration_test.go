@@ -60,4 +60,30 @@ func TestConfigurationIsValid(t *testing.T) {
 			require.NoError(t, config.IsValid())
 		})
 	})
+
+	t.Run("QuarantineRetentionDays", func(t *testing.T) {
+		config := baseConfiguration
+
+		t.Run("invalid integer", func(t *testing.T) {
+			config.QuarantineRetentionDays = "thirty"
+			require.Error(t, config.IsValid())
+		})
+
+		t.Run("zero", func(t *testing.T) {
+			config.QuarantineRetentionDays = "0"
+			require.Error(t, config.IsValid())
+		})
+
+		t.Run("unset value", func(t *testing.T) {
+			config.QuarantineRetentionDays = ""
+			require.NoError(t, config.IsValid())
+			require.Equal(t, defaultQuarantineRetentionDays, config.QuarantineRetentionDaysInt())
+		})
+
+		t.Run("valid value", func(t *testing.T) {
+			config.QuarantineRetentionDays = "90"
+			require.NoError(t, config.IsValid())
+			require.Equal(t, 90, config.QuarantineRetentionDaysInt())
+		})
+	})
 }
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	idempotencyKeyPrefix = "idempotency_"
+	flagIdempotencyKey   = "--idempotency-key"
+
+	maxIdempotencyKeyLength = 128
+
+	// idempotencyWindow is how long the result of an operation is returned
+	// for repeated requests with the same idempotency key.
+	idempotencyWindow = time.Hour
+
+	// idempotencyPendingTTL is how long a request that has not finished
+	// holds its idempotency key, so that a key isn't held forever by a
+	// request that was interrupted.
+	idempotencyPendingTTL = 5 * time.Minute
+
+	idempotencyStatusPending  = "pending"
+	idempotencyStatusFinished = "finished"
+)
+
+// idempotencyRecord is the stored state of a request made with an idempotency
+// key.
+type idempotencyRecord struct {
+	ID        string                 `json:"id"`
+	Status    string                 `json:"status"`
+	Response  *model.CommandResponse `json:"response,omitempty"`
+	UserError bool                   `json:"user_error,omitempty"`
+	CreateAt  int64                  `json:"create_at"`
+}
+
+// idempotencyStoreKey returns the KV key for an idempotency key. Keys are
+// hashed since they are chosen by clients and KV keys are limited in length.
+// The command is part of the hash so that a key reused for another command
+// doesn't return the result of the earlier one.
+func idempotencyStoreKey(userID, command, key string) string {
+	hash := sha256.Sum256([]byte(userID + ":" + command + ":" + key))
+	return idempotencyKeyPrefix + base64.RawURLEncoding.EncodeToString(hash[:24])
+}
+
+// extractIdempotencyKey removes the idempotency key flag from command
+// arguments and returns the remaining arguments along with the key. The key
+// is empty if no flag was provided.
+func extractIdempotencyKey(args []string) ([]string, string, error) {
+	var remaining []string
+	var key string
+	var found bool
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == flagIdempotencyKey:
+			found = true
+			if i+1 < len(args) {
+				key = args[i+1]
+				i++
+			}
+		case strings.HasPrefix(arg, flagIdempotencyKey+"="):
+			found = true
+			key = strings.TrimPrefix(arg, flagIdempotencyKey+"=")
+		default:
+			remaining = append(remaining, arg)
+		}
+	}
+
+	if found {
+		err := validateIdempotencyKey(key)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	return remaining, key, nil
+}
+
+func validateIdempotencyKey(key string) error {
+	if len(key) == 0 {
+		return errors.New("the idempotency key must not be empty")
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return errors.Errorf("the idempotency key must be at most %d characters", maxIdempotencyKeyLength)
+	}
+
+	return nil
+}
+
+// runIdempotent runs a request made with an idempotency key. The first request
+// with a given key runs and its result is stored. Repeated requests for the
+// same command with the same key from the same user return the stored result
+// instead of running again. Requests without a key always run.
+func (p *Plugin) runIdempotent(userID, command, key string, run func() (*model.CommandResponse, bool, error)) (*model.CommandResponse, bool, error) {
+	if len(key) == 0 {
+		return run()
+	}
+
+	storeKey := idempotencyStoreKey(userID, command, key)
+	pending, err := json.Marshal(idempotencyRecord{
+		ID:       model.NewId(),
+		Status:   idempotencyStatusPending,
+		CreateAt: model.GetMillis(),
+	})
+	if err != nil {
+		return nil, false, errors.Wrap(err, "unable to marshal idempotency record")
+	}
+
+	claimed, appErr := p.API.KVSetWithOptions(storeKey, pending, model.PluginKVSetOptions{
+		Atomic:          true,
+		OldValue:        nil,
+		ExpireInSeconds: int64(idempotencyPendingTTL / time.Second),
+	})
+	if appErr != nil {
+		return nil, false, errors.Wrap(appErr, "unable to store idempotency key")
+	}
+	if !claimed {
+		return p.getIdempotentResult(storeKey)
+	}
+
+	resp, userError, err := run()
+	if err != nil {
+		// Failed requests release the key so that they can be retried.
+		_, appErr = p.API.KVCompareAndDelete(storeKey, pending)
+		if appErr != nil {
+			p.API.LogWarn("Unable to release Wrangler idempotency key", "error", appErr.Error())
+		}
+		return resp, userError, err
+	}
+
+	finished, err := json.Marshal(idempotencyRecord{
+		ID:        model.NewId(),
+		Status:    idempotencyStatusFinished,
+		Response:  resp,
+		UserError: userError,
+		CreateAt:  model.GetMillis(),
+	})
+	if err != nil {
+		p.API.LogWarn("Unable to marshal Wrangler idempotency record", "error", err.Error())
+		return resp, userError, nil
+	}
+	_, appErr = p.API.KVSetWithOptions(storeKey, finished, model.PluginKVSetOptions{
+		Atomic:          true,
+		OldValue:        pending,
+		ExpireInSeconds: int64(idempotencyWindow / time.Second),
+	})
+	if appErr != nil {
+		p.API.LogWarn("Unable to store Wrangler idempotency result", "error", appErr.Error())
+	}
+
+	return resp, userError, nil
+}
+
+// getIdempotentResult returns the stored result of a request that was already
+// made with the same idempotency key.
+func (p *Plugin) getIdempotentResult(storeKey string) (*model.CommandResponse, bool, error) {
+	data, appErr := p.API.KVGet(storeKey)
+	if appErr != nil {
+		return nil, false, errors.Wrap(appErr, "unable to get idempotency record")
+	}
+	if data == nil {
+		// The earlier request finished with an error and released the key
+		// in the meantime.
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: an earlier request with the same idempotency key has just failed; try again"), true, nil
+	}
+
+	var record idempotencyRecord
+	err := json.Unmarshal(data, &record)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "unable to unmarshal idempotency record")
+	}
+
+	if record.Status != idempotencyStatusFinished || record.Response == nil {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "This request is still running from an earlier attempt. Check its status message or run `/wrangler jobs` to see the result."), false, nil
+	}
+
+	return record.Response, record.UserError, nil
+}
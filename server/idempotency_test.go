@@ -0,0 +1,128 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractIdempotencyKey(t *testing.T) {
+	t.Run("no key", func(t *testing.T) {
+		args, key, err := extractIdempotencyKey([]string{"/wrangler", "copy", "thread", "post1", "channel1"})
+		require.NoError(t, err)
+		assert.Empty(t, key)
+		assert.Equal(t, []string{"/wrangler", "copy", "thread", "post1", "channel1"}, args)
+	})
+
+	t.Run("key with equals", func(t *testing.T) {
+		args, key, err := extractIdempotencyKey([]string{"/wrangler", "copy", "thread", "--idempotency-key=key1", "post1", "channel1"})
+		require.NoError(t, err)
+		assert.Equal(t, "key1", key)
+		assert.Equal(t, []string{"/wrangler", "copy", "thread", "post1", "channel1"}, args)
+	})
+
+	t.Run("key as next argument", func(t *testing.T) {
+		args, key, err := extractIdempotencyKey([]string{"/wrangler", "copy", "thread", "post1", "channel1", "--idempotency-key", "key1"})
+		require.NoError(t, err)
+		assert.Equal(t, "key1", key)
+		assert.Equal(t, []string{"/wrangler", "copy", "thread", "post1", "channel1"}, args)
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		_, _, err := extractIdempotencyKey([]string{"/wrangler", "copy", "thread", "post1", "channel1", "--idempotency-key"})
+		require.Error(t, err)
+	})
+
+	t.Run("key too long", func(t *testing.T) {
+		_, _, err := extractIdempotencyKey([]string{"/wrangler", "--idempotency-key=" + string(make([]byte, maxIdempotencyKeyLength+1))})
+		require.Error(t, err)
+	})
+}
+
+func TestRunIdempotent(t *testing.T) {
+	api := &plugintest.API{}
+	kv := newMockKVStore(api)
+	api.On("LogWarn", mock.AnythingOfTypeArgument("string"), mock.AnythingOfTypeArgument("string"), mock.AnythingOfTypeArgument("string")).Return(nil)
+
+	var plugin Plugin
+	plugin.SetAPI(api)
+
+	userID := model.NewId()
+	var runs int
+	run := func() (*model.CommandResponse, bool, error) {
+		runs++
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "copied"), false, nil
+	}
+
+	t.Run("without a key", func(t *testing.T) {
+		runs = 0
+		for i := 0; i < 2; i++ {
+			resp, userError, err := plugin.runIdempotent(userID, "copy thread", "", run)
+			require.NoError(t, err)
+			assert.False(t, userError)
+			assert.Equal(t, "copied", resp.Text)
+		}
+		assert.Equal(t, 2, runs)
+		assert.Empty(t, kv.keys())
+	})
+
+	t.Run("repeated key", func(t *testing.T) {
+		runs = 0
+		for i := 0; i < 2; i++ {
+			resp, userError, err := plugin.runIdempotent(userID, "copy thread", "key1", run)
+			require.NoError(t, err)
+			assert.False(t, userError)
+			assert.Equal(t, "copied", resp.Text)
+		}
+		assert.Equal(t, 1, runs)
+	})
+
+	t.Run("same key from another user", func(t *testing.T) {
+		runs = 0
+		_, _, err := plugin.runIdempotent(model.NewId(), "copy thread", "key1", run)
+		require.NoError(t, err)
+		assert.Equal(t, 1, runs)
+	})
+
+	t.Run("same key for another command", func(t *testing.T) {
+		runs = 0
+		resp, _, err := plugin.runIdempotent(userID, "move thread", "key1", func() (*model.CommandResponse, bool, error) {
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "moved"), false, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "moved", resp.Text)
+	})
+
+	t.Run("request still running", func(t *testing.T) {
+		runs = 0
+		var nestedResp *model.CommandResponse
+		_, _, err := plugin.runIdempotent(userID, "copy thread", "key2", func() (*model.CommandResponse, bool, error) {
+			var err error
+			nestedResp, _, err = plugin.runIdempotent(userID, "copy thread", "key2", run)
+			require.NoError(t, err)
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "done"), false, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 0, runs)
+		require.NotNil(t, nestedResp)
+		assert.Contains(t, nestedResp.Text, "still running from an earlier attempt")
+	})
+
+	t.Run("failed requests can be retried", func(t *testing.T) {
+		runs = 0
+		_, _, err := plugin.runIdempotent(userID, "copy thread", "key3", func() (*model.CommandResponse, bool, error) {
+			return nil, false, errors.New("failed")
+		})
+		require.Error(t, err)
+
+		resp, _, err := plugin.runIdempotent(userID, "copy thread", "key3", run)
+		require.NoError(t, err)
+		assert.Equal(t, "copied", resp.Text)
+		assert.Equal(t, 1, runs)
+	})
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	jobKeyPrefix      = "job_"
+	userJobsKeyPrefix = "user_jobs_"
+
+	// backgroundJobMinPostCount is the number of messages at which a move,
+	// copy or merge is run as a background job instead of inside the command
+	// request.
+	backgroundJobMinPostCount = 100
+	jobStatusUpdateInterval   = 2 * time.Second
+	jobShutdownTimeout        = 30 * time.Second
+	maxRecentUserJobs         = 10
+
+	jobStatusRunning   = "running"
+	jobStatusSucceeded = "succeeded"
+	jobStatusFailed    = "failed"
+	jobStatusCanceled  = "canceled"
+)
+
+var errJobCanceled = errors.New("the job was canceled")
+
+// job is the stored state of a background job that runs a Wrangler operation.
+type job struct {
+	ID           string `json:"id"`
+	OperationID  string `json:"operation_id"`
+	Type         string `json:"type"`
+	UserID       string `json:"user_id"`
+	Status       string `json:"status"`
+	Total        int    `json:"total"`
+	Done         int    `json:"done"`
+	StatusPostID string `json:"status_post_id"`
+	Result       string `json:"result,omitempty"`
+	CreateAt     int64  `json:"create_at"`
+	UpdateAt     int64  `json:"update_at"`
+}
+
+// runningJob tracks a job while its operation is running.
+type runningJob struct {
+	plugin *Plugin
+
+	// lock synchronizes access to the job, which is updated by the job
+	// goroutine and read when listing jobs.
+	lock sync.Mutex
+	job  *job
+
+	cancelOnce   sync.Once
+	cancelCh     chan struct{}
+	cancelReason string
+
+	lastUpdate time.Time
+}
+
+// snapshot returns a copy of the current job state.
+func (rj *runningJob) snapshot() job {
+	rj.lock.Lock()
+	defer rj.lock.Unlock()
+
+	return *rj.job
+}
+
+// cancel asks the job to stop. The operation is rolled back the next time it
+// reports progress.
+func (rj *runningJob) cancel(reason string) {
+	rj.cancelOnce.Do(func() {
+		rj.lock.Lock()
+		rj.cancelReason = reason
+		rj.lock.Unlock()
+		close(rj.cancelCh)
+	})
+}
+
+func (rj *runningJob) isCanceled() bool {
+	select {
+	case <-rj.cancelCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// progress records that another message was created. The status post is
+// updated at most once per update interval. An error is returned if the job
+// has been canceled.
+func (rj *runningJob) progress() {
+	rj.lock.Lock()
+	rj.job.Done++
+	rj.job.UpdateAt = model.GetMillis()
+	update := time.Since(rj.lastUpdate) >= jobStatusUpdateInterval
+	if update {
+		rj.lastUpdate = time.Now()
+	}
+	rj.lock.Unlock()
+
+	if update {
+		j := rj.snapshot()
+		rj.plugin.updateJobStatusPost(&j)
+	}
+}
+
+// reportProgress records that another message was created by the operation.
+// An error is returned if the background job running the operation has been
+// canceled or a lock on the threads of the operation was lost, unless the
+// operation has begun deleting the original messages and can no longer be
+// rolled back.
+func (o *operation) reportProgress() error {
+	if o == nil {
+		return nil
+	}
+	if len(o.deletePostIDs) == 0 {
+		if o.lock.isLost() {
+			return errThreadLockLost
+		}
+		if o.job != nil && o.job.isCanceled() {
+			return errJobCanceled
+		}
+	}
+
+	if o.job != nil {
+		o.job.progress()
+	}
+
+	return nil
+}
+
+// runOperation runs an operation that creates the given number of messages.
+// Operations large enough to risk timing out the command request are run in
+// the background as a job. Any thread locks held by the operation are
+// released once it has finished.
+func (p *Plugin) runOperation(op *operation, total int, extra *model.CommandArgs, run func() (*model.CommandResponse, bool, error)) (*model.CommandResponse, bool, error) {
+	if total < backgroundJobMinPostCount {
+		defer op.unlock()
+		return run()
+	}
+
+	response, userErr, err := p.startJob(op, total, extra, run)
+	if err != nil {
+		op.unlock()
+	}
+
+	return response, userErr, err
+}
+
+// startJob runs an operation in the background and returns a command response
+// explaining how to follow and cancel it. The run function performs the
+// operation and reports progress through the given operation.
+func (p *Plugin) startJob(op *operation, total int, extra *model.CommandArgs, run func() (*model.CommandResponse, bool, error)) (*model.CommandResponse, bool, error) {
+	j := &job{
+		ID:          model.NewId(),
+		OperationID: op.ID,
+		Type:        op.Type,
+		UserID:      extra.UserId,
+		Status:      jobStatusRunning,
+		Total:       total,
+		CreateAt:    model.GetMillis(),
+	}
+	j.UpdateAt = j.CreateAt
+
+	statusPost, err := p.createJobStatusPost(j)
+	if err != nil {
+		return nil, false, err
+	}
+	j.StatusPostID = statusPost.Id
+
+	err = p.saveJob(j)
+	if err != nil {
+		return nil, false, err
+	}
+	err = p.addUserJob(j.UserID, j.ID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	rj := &runningJob{
+		plugin:     p,
+		job:        j,
+		cancelCh:   make(chan struct{}),
+		lastUpdate: time.Now(),
+	}
+	op.job = rj
+
+	p.jobsLock.Lock()
+	if p.runningJobs == nil {
+		p.runningJobs = make(map[string]*runningJob)
+	}
+	p.runningJobs[j.ID] = rj
+	p.jobsWaitGroup.Add(1)
+	p.jobsLock.Unlock()
+
+	p.API.LogInfo("Wrangler started a background job",
+		"user_id", j.UserID,
+		"job_id", j.ID,
+		"operation_id", op.ID,
+	)
+
+	go p.runJob(rj, op, extra, run)
+
+	return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("This operation covers %d messages, so it is running in the background as job %s. Progress is posted in a direct message from @wrangler. Run `/wrangler jobs cancel %s` to stop it.", total, inlineCode(j.ID), j.ID)), false, nil
+}
+
+// runJob runs the operation of a job and stores the outcome.
+func (p *Plugin) runJob(rj *runningJob, op *operation, extra *model.CommandArgs, run func() (*model.CommandResponse, bool, error)) {
+	defer p.jobsWaitGroup.Done()
+	defer op.unlock()
+
+	response, _, err := run()
+
+	rj.lock.Lock()
+	j := rj.job
+	switch {
+	case op.finished:
+		// The job is marked from the outcome of its operation, even when
+		// reporting on the finished operation failed afterwards. A job
+		// canceled once the original messages were being deleted also
+		// finishes its operation, so it has succeeded.
+		j.Status = jobStatusSucceeded
+		j.Result = "The operation has finished."
+		if response != nil {
+			j.Result = response.Text
+		}
+		if err != nil {
+			p.API.LogError("Wrangler background job finished, but its result could not be reported",
+				"error", err.Error(),
+				"job_id", j.ID,
+			)
+		}
+	case err != nil:
+		p.API.LogError("Wrangler background job failed",
+			"error", err.Error(),
+			"job_id", j.ID,
+		)
+		j.Status = jobStatusFailed
+		j.Result = "An unknown error occurred. Please talk to your administrator for help."
+	case op.rolledBack && rj.isCanceled():
+		j.Status = jobStatusCanceled
+		j.Result = response.Text
+		if len(rj.cancelReason) != 0 {
+			j.Result = fmt.Sprintf("%s\n\n%s", rj.cancelReason, response.Text)
+		}
+	case op.rolledBack, len(op.checkpointError) != 0:
+		j.Status = jobStatusFailed
+		j.Result = response.Text
+	default:
+		j.Status = jobStatusSucceeded
+		j.Result = response.Text
+	}
+	j.UpdateAt = model.GetMillis()
+	final := *j
+	rj.lock.Unlock()
+
+	if final.Status == jobStatusSucceeded && response != nil && response.ResponseType == model.COMMAND_RESPONSE_TYPE_IN_CHANNEL {
+		// The summary would have been posted in the channel had the command
+		// run in the foreground, so it is posted there by the bot instead.
+		err = p.PostToChannelByIDAsBot(extra.ChannelId, response.Text)
+		if err != nil {
+			p.API.LogError("Unable to post background job summary",
+				"error", err.Error(),
+				"job_id", final.ID,
+			)
+		}
+	}
+
+	err = p.saveJob(&final)
+	if err != nil {
+		p.API.LogError("Unable to save background job",
+			"error", err.Error(),
+			"job_id", final.ID,
+		)
+	}
+	p.updateJobStatusPost(&final)
+
+	p.jobsLock.Lock()
+	delete(p.runningJobs, final.ID)
+	p.jobsLock.Unlock()
+
+	p.API.LogInfo("Wrangler background job finished",
+		"job_id", final.ID,
+		"status", final.Status,
+	)
+}
+
+// getRunningJob returns the running job with the given ID or nil if no such
+// job is running.
+func (p *Plugin) getRunningJob(jobID string) *runningJob {
+	p.jobsLock.Lock()
+	defer p.jobsLock.Unlock()
+
+	return p.runningJobs[jobID]
+}
+
+// stopRunningJobs cancels every running job and waits for them to roll back
+// their operations, giving up after the shutdown timeout.
+func (p *Plugin) stopRunningJobs() {
+	p.jobsLock.Lock()
+	for _, rj := range p.runningJobs {
+		rj.cancel("The job was canceled because the Wrangler plugin was deactivated.")
+	}
+	p.jobsLock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.jobsWaitGroup.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(jobShutdownTimeout):
+		p.API.LogWarn("Timed out waiting for Wrangler background jobs to stop")
+	}
+}
+
+func (p *Plugin) createJobStatusPost(j *job) (*model.Post, error) {
+	channel, appErr := p.API.GetDirectChannel(j.UserID, p.BotUserID)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "unable to get direct channel")
+	}
+
+	post, appErr := p.API.CreatePost(&model.Post{
+		UserId:    p.BotUserID,
+		ChannelId: channel.Id,
+		Message:   j.statusMessage(),
+	})
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "unable to create job status post")
+	}
+
+	return post, nil
+}
+
+// updateJobStatusPost updates the status post of a job. Failures are logged,
+// but do not affect the job.
+func (p *Plugin) updateJobStatusPost(j *job) {
+	post, appErr := p.API.GetPost(j.StatusPostID)
+	if appErr != nil {
+		p.API.LogError("Unable to get job status post", "err", appErr)
+		return
+	}
+
+	post.Message = j.statusMessage()
+	_, appErr = p.API.UpdatePost(post)
+	if appErr != nil {
+		p.API.LogError("Unable to update job status post", "err", appErr)
+	}
+}
+
+func (j *job) statusMessage() string {
+	msg := fmt.Sprintf("#### Wrangler job %s\n", inlineCode(j.ID))
+	msg += fmt.Sprintf("%s operation %s: %s", j.Type, inlineCode(j.OperationID), j.progressText())
+	if len(j.Result) != 0 {
+		msg += fmt.Sprintf("\n\n%s", j.Result)
+	}
+
+	return msg
+}
+
+func (j *job) progressText() string {
+	if j.Status == jobStatusRunning {
+		return fmt.Sprintf("%s, %d of %d messages", j.Status, j.Done, j.Total)
+	}
+
+	return fmt.Sprintf("%s after %d of %d messages", j.Status, j.Done, j.Total)
+}
+
+func jobKey(jobID string) string {
+	return jobKeyPrefix + jobID
+}
+
+func userJobsKey(userID string) string {
+	return userJobsKeyPrefix + userID
+}
+
+func (p *Plugin) saveJob(j *job) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal job")
+	}
+
+	appErr := p.API.KVSet(jobKey(j.ID), data)
+	if appErr != nil {
+		return errors.Wrap(appErr, "unable to save job")
+	}
+
+	return nil
+}
+
+// getJob returns the job with the given ID or nil if it does not exist.
+func (p *Plugin) getJob(jobID string) (*job, error) {
+	data, appErr := p.API.KVGet(jobKey(jobID))
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "unable to get job")
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	var j job
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to unmarshal job")
+	}
+
+	return &j, nil
+}
+
+// getUserJobIDs returns the IDs of the most recent jobs of a user, newest
+// first.
+func (p *Plugin) getUserJobIDs(userID string) ([]string, error) {
+	data, appErr := p.API.KVGet(userJobsKey(userID))
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "unable to get user jobs")
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	var jobIDs []string
+	err := json.Unmarshal(data, &jobIDs)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to unmarshal user jobs")
+	}
+
+	return jobIDs, nil
+}
+
+// addUserJob adds a job to the list of recent jobs of a user. Only the most
+// recent jobs are kept.
+func (p *Plugin) addUserJob(userID, jobID string) error {
+	jobIDs, err := p.getUserJobIDs(userID)
+	if err != nil {
+		return err
+	}
+
+	jobIDs = append([]string{jobID}, jobIDs...)
+	if len(jobIDs) > maxRecentUserJobs {
+		jobIDs = jobIDs[:maxRecentUserJobs]
+	}
+
+	data, err := json.Marshal(jobIDs)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal user jobs")
+	}
+	appErr := p.API.KVSet(userJobsKey(userID), data)
+	if appErr != nil {
+		return errors.Wrap(appErr, "unable to save user jobs")
+	}
+
+	return nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartJob(t *testing.T) {
+	userID := model.NewId()
+	dmChannel := &model.Channel{Id: model.NewId()}
+	statusPost := &model.Post{Id: model.NewId(), ChannelId: dmChannel.Id}
+
+	api := &plugintest.API{}
+	newMockKVStore(api)
+	api.On("GetDirectChannel", userID, mock.AnythingOfType("string")).Return(dmChannel, nil)
+	api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(statusPost, nil)
+	api.On("GetPost", statusPost.Id).Return(func(string) *model.Post { return statusPost.Clone() }, nil)
+	api.On("UpdatePost", mock.AnythingOfType("*model.Post")).Return(statusPost, nil)
+	api.On("LogInfo",
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+	).Return(nil)
+	api.On("LogInfo",
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+	).Return(nil)
+	api.On("LogError",
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+	).Return(nil)
+	api.On("LogError",
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+	).Return(nil)
+
+	var plugin Plugin
+	plugin.SetAPI(api)
+
+	extra := &model.CommandArgs{UserId: userID, ChannelId: model.NewId()}
+
+	getStoredJob := func(t *testing.T) *job {
+		jobIDs, err := plugin.getUserJobIDs(userID)
+		require.NoError(t, err)
+		require.NotEmpty(t, jobIDs)
+
+		j, err := plugin.getJob(jobIDs[0])
+		require.NoError(t, err)
+		require.NotNil(t, j)
+
+		return j
+	}
+
+	t.Run("succeeded", func(t *testing.T) {
+		op := newOperation(operationTypeCopy, userID)
+		resp, isUserError, err := plugin.startJob(op, 150, extra, func() (*model.CommandResponse, bool, error) {
+			for i := 0; i < 150; i++ {
+				require.NoError(t, op.reportProgress())
+			}
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Thread copy complete"), false, nil
+		})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "running in the background as job")
+
+		plugin.jobsWaitGroup.Wait()
+
+		j := getStoredJob(t)
+		assert.Equal(t, jobStatusSucceeded, j.Status)
+		assert.Equal(t, op.ID, j.OperationID)
+		assert.Equal(t, 150, j.Done)
+		assert.Equal(t, "Thread copy complete", j.Result)
+		assert.Nil(t, plugin.getRunningJob(j.ID))
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		started := make(chan struct{})
+		op := newOperation(operationTypeMove, userID)
+		_, _, err := plugin.startJob(op, 150, extra, func() (*model.CommandResponse, bool, error) {
+			close(started)
+			for {
+				err := op.reportProgress()
+				if err != nil {
+					return plugin.rollbackResponse(op, err)
+				}
+			}
+		})
+		require.NoError(t, err)
+
+		<-started
+		j := getStoredJob(t)
+		rj := plugin.getRunningJob(j.ID)
+		require.NotNil(t, rj)
+		rj.cancel("")
+
+		plugin.jobsWaitGroup.Wait()
+
+		j = getStoredJob(t)
+		assert.Equal(t, jobStatusCanceled, j.Status)
+		assert.Contains(t, j.Result, "The operation was canceled and has been rolled back")
+	})
+
+	t.Run("canceled while deleting", func(t *testing.T) {
+		op := newOperation(operationTypeMove, userID)
+		_, _, err := plugin.startJob(op, 150, extra, func() (*model.CommandResponse, bool, error) {
+			op.beginDeletes(model.NewId())
+			rj := plugin.getRunningJob(getStoredJob(t).ID)
+			require.NotNil(t, rj)
+			rj.cancel("")
+
+			for i := 0; i < 150; i++ {
+				require.NoError(t, op.reportProgress())
+			}
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_IN_CHANNEL, "Thread moved by @user"), false, nil
+		})
+		require.NoError(t, err)
+
+		plugin.jobsWaitGroup.Wait()
+
+		j := getStoredJob(t)
+		assert.Equal(t, jobStatusSucceeded, j.Status)
+		assert.Equal(t, "Thread moved by @user", j.Result)
+		api.AssertCalled(t, "CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+			return post.ChannelId == extra.ChannelId && post.Message == "Thread moved by @user"
+		}))
+	})
+
+	t.Run("error after the operation finished", func(t *testing.T) {
+		op := plugin.startOperation(operationTypeMove, userID)
+		_, _, err := plugin.startJob(op, 150, extra, func() (*model.CommandResponse, bool, error) {
+			op.beginDeletes(model.NewId())
+			plugin.finishOperation(op)
+			return nil, false, errors.New("unable to find executor")
+		})
+		require.NoError(t, err)
+
+		plugin.jobsWaitGroup.Wait()
+
+		j := getStoredJob(t)
+		assert.Equal(t, jobStatusSucceeded, j.Status)
+		assert.Equal(t, "The operation has finished.", j.Result)
+		api.AssertCalled(t, "LogError", "Wrangler background job finished, but its result could not be reported", "error", "unable to find executor", "job_id", j.ID)
+	})
+
+	t.Run("stopped on deactivate", func(t *testing.T) {
+		started := make(chan struct{})
+		op := newOperation(operationTypeMerge, userID)
+		_, _, err := plugin.startJob(op, 150, extra, func() (*model.CommandResponse, bool, error) {
+			close(started)
+			for {
+				err := op.reportProgress()
+				if err != nil {
+					return plugin.rollbackResponse(op, err)
+				}
+			}
+		})
+		require.NoError(t, err)
+
+		<-started
+		require.NoError(t, plugin.OnDeactivate())
+
+		j := getStoredJob(t)
+		assert.Equal(t, jobStatusCanceled, j.Status)
+		assert.Contains(t, j.Result, "the Wrangler plugin was deactivated")
+	})
+
+	t.Run("recent jobs are capped", func(t *testing.T) {
+		jobIDs, err := plugin.getUserJobIDs(userID)
+		require.NoError(t, err)
+		assert.Len(t, jobIDs, 5)
+
+		for i := 0; i < maxRecentUserJobs; i++ {
+			require.NoError(t, plugin.addUserJob(userID, model.NewId()))
+		}
+
+		data, appErr := api.KVGet(userJobsKey(userID))
+		require.Nil(t, appErr)
+		require.NoError(t, json.Unmarshal(data, &jobIDs))
+		assert.Len(t, jobIDs, maxRecentUserJobs)
+	})
+}
+
+func TestRunOperation(t *testing.T) {
+	var plugin Plugin
+	var ran bool
+
+	resp, _, err := plugin.runOperation(newOperation(operationTypeCopy, model.NewId()), backgroundJobMinPostCount-1, &model.CommandArgs{}, func() (*model.CommandResponse, bool, error) {
+		ran = true
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Thread copy complete"), false, nil
+	})
+	require.NoError(t, err)
+	assert.True(t, ran)
+	assert.Equal(t, "Thread copy complete", resp.Text)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+// kvListUpdateAttempts is how many times a list stored in the KV store is
+// reread when another server changes it while it is being updated.
+const kvListUpdateAttempts = 10
+
+// getKVList returns the list of values stored under the given key.
+func (p *Plugin) getKVList(key string) ([]string, error) {
+	data, appErr := p.API.KVGet(key)
+	if appErr != nil {
+		return nil, errors.Wrapf(appErr, "unable to get list %s", key)
+	}
+
+	return unmarshalKVList(key, data)
+}
+
+// addToKVList adds a value to the list stored under the given key, unless the
+// list already contains it.
+func (p *Plugin) addToKVList(key, value string) error {
+	return p.updateKVList(key, func(values []string) []string {
+		for _, v := range values {
+			if v == value {
+				return values
+			}
+		}
+
+		return append(values, value)
+	})
+}
+
+// removeFromKVList removes values from the list stored under the given key.
+// The key is deleted once the list is empty.
+func (p *Plugin) removeFromKVList(key string, values ...string) error {
+	return p.updateKVList(key, func(stored []string) []string {
+		var kept []string
+		for _, v := range stored {
+			if !containsString(values, v) {
+				kept = append(kept, v)
+			}
+		}
+
+		return kept
+	})
+}
+
+// updateKVList replaces the list stored under the given key with the result of
+// update. The list is written atomically, so an update made by another server
+// in the meantime is reread and update is applied again.
+func (p *Plugin) updateKVList(key string, update func([]string) []string) error {
+	for attempt := 0; attempt < kvListUpdateAttempts; attempt++ {
+		data, appErr := p.API.KVGet(key)
+		if appErr != nil {
+			return errors.Wrapf(appErr, "unable to get list %s", key)
+		}
+		values, err := unmarshalKVList(key, data)
+		if err != nil {
+			return err
+		}
+
+		var newData []byte
+		if values = update(values); len(values) != 0 {
+			newData, err = json.Marshal(values)
+			if err != nil {
+				return errors.Wrapf(err, "unable to marshal list %s", key)
+			}
+		}
+
+		saved, appErr := p.API.KVSetWithOptions(key, newData, model.PluginKVSetOptions{
+			Atomic:   true,
+			OldValue: data,
+		})
+		if appErr != nil {
+			return errors.Wrapf(appErr, "unable to save list %s", key)
+		}
+		if saved {
+			return nil
+		}
+	}
+
+	return errors.Errorf("unable to save list %s; it kept being changed by another server", key)
+}
+
+func unmarshalKVList(key string, data []byte) ([]string, error) {
+	if data == nil {
+		return nil, nil
+	}
+
+	var values []string
+	err := json.Unmarshal(data, &values)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to unmarshal list %s", key)
+	}
+
+	return values, nil
+}
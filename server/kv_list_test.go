@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKVList(t *testing.T) {
+	api := &plugintest.API{}
+	kv := newMockKVStore(api)
+
+	var plugin Plugin
+	plugin.SetAPI(api)
+
+	key := "list"
+
+	t.Run("empty", func(t *testing.T) {
+		values, err := plugin.getKVList(key)
+		require.NoError(t, err)
+		assert.Empty(t, values)
+	})
+
+	t.Run("add", func(t *testing.T) {
+		require.NoError(t, plugin.addToKVList(key, "a"))
+		require.NoError(t, plugin.addToKVList(key, "b"))
+		require.NoError(t, plugin.addToKVList(key, "a"))
+
+		values, err := plugin.getKVList(key)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, values)
+	})
+
+	t.Run("changed by another server", func(t *testing.T) {
+		var attempts int
+		err := plugin.updateKVList(key, func(values []string) []string {
+			attempts++
+			if attempts == 1 {
+				kv.data[key] = []byte(`["a","b","c"]`)
+			}
+			return append(values, "d")
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, attempts)
+
+		values, err := plugin.getKVList(key)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b", "c", "d"}, values)
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		require.NoError(t, plugin.removeFromKVList(key, "a", "c"))
+		values, err := plugin.getKVList(key)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b", "d"}, values)
+
+		require.NoError(t, plugin.removeFromKVList(key, "b", "d"))
+		assert.NotContains(t, kv.keys(), key)
+	})
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	threadLockKeyPrefix = "thread_lock_"
+
+	// threadLockTTL is how long a thread lock lasts without being refreshed,
+	// so that locks held by a plugin instance that stopped are released.
+	threadLockTTL = 5 * time.Minute
+
+	threadLockRefreshInterval = time.Minute
+)
+
+var errThreadLockLost = errors.New("the lock on the thread was lost")
+
+// threadLockValue is the stored value of a thread lock. The lock ID makes
+// every value unique so that only the holder can refresh or release it.
+type threadLockValue struct {
+	ID            string `json:"id"`
+	UserID        string `json:"user_id"`
+	OperationType string `json:"operation_type"`
+	CreateAt      int64  `json:"create_at"`
+}
+
+// threadLock is a held lock on one or more threads. The locks are stored in
+// the KV store so that they apply across every server in a cluster.
+type threadLock struct {
+	plugin   *Plugin
+	keys     []string
+	value    []byte
+	stopOnce sync.Once
+	stop     chan struct{}
+
+	lostLock sync.Mutex
+	lost     bool
+}
+
+func threadLockKey(rootID string) string {
+	return threadLockKeyPrefix + rootID
+}
+
+// getPostRootID returns the ID of the root post of the thread a post belongs
+// to.
+func getPostRootID(post *model.Post) string {
+	if len(post.RootId) != 0 {
+		return post.RootId
+	}
+
+	return post.Id
+}
+
+// lockThreads locks the threads with the given root IDs for an operation. If
+// any of the threads is already locked, no locks are held and a command
+// response naming the user wrangling that thread is returned instead.
+func (p *Plugin) lockThreads(op *operation, rootIDs ...string) (*model.CommandResponse, error) {
+	value, err := newLockValue(op.UserID, op.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	// Locks are always taken in the same order to avoid two operations each
+	// holding a lock the other one needs.
+	uniqueRootIDs := make(map[string]bool)
+	for _, rootID := range rootIDs {
+		uniqueRootIDs[rootID] = true
+	}
+	var sortedRootIDs []string
+	for rootID := range uniqueRootIDs {
+		sortedRootIDs = append(sortedRootIDs, rootID)
+	}
+	sort.Strings(sortedRootIDs)
+
+	var keys []string
+	for _, rootID := range sortedRootIDs {
+		keys = append(keys, threadLockKey(rootID))
+	}
+	lock, heldKey, err := p.acquireLocks(keys, value)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to lock thread")
+	}
+	if len(heldKey) != 0 {
+		return p.threadLockedResponse(strings.TrimPrefix(heldKey, threadLockKeyPrefix)), nil
+	}
+
+	// The threads may have been wrangled by another operation that finished
+	// after they were looked up, so they are checked again now that no other
+	// operation can change them.
+	for _, rootID := range sortedRootIDs {
+		rootPost, appErr := p.API.GetPost(rootID)
+		if appErr != nil || rootPost.DeleteAt != 0 {
+			lock.release()
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: the thread with root message ID %s no longer exists; it may have just been wrangled by someone else", rootID)), nil
+		}
+	}
+
+	go lock.refresh()
+	op.lock = lock
+
+	return nil, nil
+}
+
+// newLockValue returns a new unique lock value for an operation run by the
+// given user.
+func newLockValue(userID, operationType string) ([]byte, error) {
+	value, err := json.Marshal(threadLockValue{
+		ID:            model.NewId(),
+		UserID:        userID,
+		OperationType: operationType,
+		CreateAt:      model.GetMillis(),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to marshal lock")
+	}
+
+	return value, nil
+}
+
+// acquireLocks takes the given lock keys in order. If one of them is already
+// held, the locks taken so far are released and the held key is returned
+// instead of a lock. The returned lock isn't refreshed until refresh is
+// started.
+func (p *Plugin) acquireLocks(keys []string, value []byte) (*threadLock, string, error) {
+	lock := &threadLock{
+		plugin: p,
+		value:  value,
+		stop:   make(chan struct{}),
+	}
+	for _, key := range keys {
+		locked, appErr := p.API.KVSetWithOptions(key, value, model.PluginKVSetOptions{
+			Atomic:          true,
+			OldValue:        nil,
+			ExpireInSeconds: int64(threadLockTTL / time.Second),
+		})
+		if appErr != nil {
+			lock.release()
+			return nil, "", errors.Wrapf(appErr, "unable to take lock %s", key)
+		}
+		if !locked {
+			lock.release()
+			return nil, key, nil
+		}
+		lock.keys = append(lock.keys, key)
+	}
+
+	return lock, "", nil
+}
+
+// threadLockedResponse returns a command response explaining who is wrangling
+// a locked thread.
+func (p *Plugin) threadLockedResponse(rootID string) *model.CommandResponse {
+	wrangler := "another user"
+
+	data, appErr := p.API.KVGet(threadLockKey(rootID))
+	if appErr == nil && data != nil {
+		var holder threadLockValue
+		if json.Unmarshal(data, &holder) == nil {
+			user, appErr := p.API.GetUser(holder.UserID)
+			if appErr == nil {
+				wrangler = "@" + user.Username
+			}
+		}
+	}
+
+	return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: the thread with root message ID %s is being wrangled by %s; try again once that operation has finished", rootID, wrangler))
+}
+
+// refresh extends the locks until they are released.
+func (l *threadLock) refresh() {
+	ticker := time.NewTicker(threadLockRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			l.extend()
+		}
+	}
+}
+
+// extend resets the expiry of every lock. A lock that is no longer held,
+// because it expired and may have been taken by another operation, is marked
+// as lost.
+func (l *threadLock) extend() {
+	for _, key := range l.keys {
+		refreshed, appErr := l.plugin.API.KVSetWithOptions(key, l.value, model.PluginKVSetOptions{
+			Atomic:          true,
+			OldValue:        l.value,
+			ExpireInSeconds: int64(threadLockTTL / time.Second),
+		})
+		if appErr != nil {
+			l.plugin.API.LogWarn("Unable to refresh Wrangler thread lock",
+				"error", appErr.Error(),
+				"key", key,
+			)
+			continue
+		}
+		if !refreshed {
+			l.plugin.API.LogError("Wrangler thread lock was lost",
+				"key", key,
+			)
+			l.lostLock.Lock()
+			l.lost = true
+			l.lostLock.Unlock()
+		}
+	}
+}
+
+// isLost returns whether any of the locks was lost while it was held.
+func (l *threadLock) isLost() bool {
+	if l == nil {
+		return false
+	}
+	l.lostLock.Lock()
+	defer l.lostLock.Unlock()
+
+	return l.lost
+}
+
+// release removes the locks. Locks that have since been taken by another
+// operation are left alone.
+func (l *threadLock) release() {
+	if l == nil {
+		return
+	}
+
+	l.stopOnce.Do(func() {
+		close(l.stop)
+		for _, key := range l.keys {
+			_, appErr := l.plugin.API.KVCompareAndDelete(key, l.value)
+			if appErr != nil {
+				l.plugin.API.LogWarn("Unable to release Wrangler thread lock",
+					"error", appErr.Error(),
+					"key", key,
+				)
+			}
+		}
+	})
+}
+
+// unlock releases the thread locks held by the operation, if any.
+func (o *operation) unlock() {
+	if o == nil {
+		return
+	}
+
+	o.lock.release()
+}
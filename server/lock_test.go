@@ -0,0 +1,129 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockThreads(t *testing.T) {
+	user1 := &model.User{Id: model.NewId(), Username: "user1"}
+	user2 := &model.User{Id: model.NewId(), Username: "user2"}
+	root1 := mockGeneratePost()
+	root2 := mockGeneratePost()
+	root3 := mockGeneratePost()
+	deletedRoot := &model.Post{Id: model.NewId(), DeleteAt: 1}
+
+	api := &plugintest.API{}
+	kv := newMockKVStore(api)
+	api.On("GetUser", user1.Id).Return(user1, nil)
+	api.On("GetUser", user2.Id).Return(user2, nil)
+	api.On("GetPost", deletedRoot.Id).Return(deletedRoot, nil)
+	api.On("GetPost", mock.AnythingOfType("string")).Return(mockGeneratePost(), nil)
+
+	var plugin Plugin
+	plugin.SetAPI(api)
+
+	lockKeys := func() []string {
+		var keys []string
+		for _, key := range kv.keys() {
+			if strings.HasPrefix(key, threadLockKeyPrefix) {
+				keys = append(keys, key)
+			}
+		}
+		return keys
+	}
+
+	op1 := newOperation(operationTypeMove, user1.Id)
+	resp, err := plugin.lockThreads(op1, root1.Id, root2.Id)
+	require.NoError(t, err)
+	require.Nil(t, resp)
+	assert.ElementsMatch(t, []string{threadLockKey(root1.Id), threadLockKey(root2.Id)}, lockKeys())
+
+	t.Run("conflicting operation", func(t *testing.T) {
+		op2 := newOperation(operationTypeMerge, user2.Id)
+		resp, err := plugin.lockThreads(op2, root3.Id, root2.Id)
+		require.NoError(t, err)
+		require.NotNil(t, resp)
+		assert.Equal(t, "Error: the thread with root message ID "+root2.Id+" is being wrangled by @user1; try again once that operation has finished", resp.Text)
+		assert.Nil(t, op2.lock)
+
+		// The lock taken on the other thread before the conflict is released.
+		assert.ElementsMatch(t, []string{threadLockKey(root1.Id), threadLockKey(root2.Id)}, lockKeys())
+	})
+
+	t.Run("deleted thread", func(t *testing.T) {
+		op2 := newOperation(operationTypeMove, user2.Id)
+		resp, err := plugin.lockThreads(op2, deletedRoot.Id)
+		require.NoError(t, err)
+		require.NotNil(t, resp)
+		assert.Contains(t, resp.Text, "no longer exists")
+		assert.NotContains(t, lockKeys(), threadLockKey(deletedRoot.Id))
+	})
+
+	t.Run("unlocked", func(t *testing.T) {
+		op1.unlock()
+		assert.Empty(t, lockKeys())
+
+		// Unlocking again does nothing.
+		op1.unlock()
+
+		op2 := newOperation(operationTypeMerge, user2.Id)
+		resp, err := plugin.lockThreads(op2, root3.Id, root2.Id)
+		require.NoError(t, err)
+		require.Nil(t, resp)
+		op2.unlock()
+	})
+
+	t.Run("released after running", func(t *testing.T) {
+		op := newOperation(operationTypeCopy, user1.Id)
+		resp, err := plugin.lockThreads(op, root1.Id)
+		require.NoError(t, err)
+		require.Nil(t, resp)
+
+		_, _, err = plugin.runOperation(op, 1, &model.CommandArgs{UserId: user1.Id}, func() (*model.CommandResponse, bool, error) {
+			assert.Equal(t, []string{threadLockKey(root1.Id)}, lockKeys())
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Thread copy complete"), false, nil
+		})
+		require.NoError(t, err)
+		assert.Empty(t, lockKeys())
+	})
+
+	t.Run("lost", func(t *testing.T) {
+		api.On("LogError", "Wrangler thread lock was lost", "key", threadLockKey(root3.Id)).Return(nil)
+
+		op := newOperation(operationTypeMove, user1.Id)
+		resp, err := plugin.lockThreads(op, root3.Id)
+		require.NoError(t, err)
+		require.Nil(t, resp)
+		defer op.unlock()
+
+		op.lock.extend()
+		assert.False(t, op.lock.isLost())
+		require.NoError(t, op.reportProgress())
+
+		// The lock expired and was taken by another operation.
+		kv.lock.Lock()
+		kv.data[threadLockKey(root3.Id)] = []byte("other")
+		kv.lock.Unlock()
+
+		op.lock.extend()
+		assert.True(t, op.lock.isLost())
+		assert.Equal(t, errThreadLockLost, op.reportProgress())
+
+		// The lock no longer matters once the original messages are being
+		// deleted.
+		op.beginDeletes(root3.Id)
+		require.NoError(t, op.reportProgress())
+	})
+}
+
+func TestGetPostRootID(t *testing.T) {
+	assert.Equal(t, "post1", getPostRootID(&model.Post{Id: "post1"}))
+	assert.Equal(t, "root1", getPostRootID(&model.Post{Id: "post1", RootId: "root1"}))
+}
@@ -124,10 +124,42 @@ const manifestStr = `
         "key": "MergeThreadEnable",
         "display_name": "Enable Merging Threads [BETA]",
         "type": "bool",
-        "help_text": "Control whether Wrangler is permitted to merge message threads. Depending on other plugin settings these threads can be merged across channels and teams. Note that message timestamps are preserved when threads are merged which could result in unexpected or confusing message ordering.",
+        "help_text": "Control whether Wrangler is permitted to merge message threads. Depending on other plugin settings these threads can be merged across channels and teams. By default message timestamps are preserved when threads are merged, interleaving the merged messages with existing replies. Use the --mode flag to append merged messages instead or to rebuild the threads together in chronological order.",
         "placeholder": "",
         "default": false
       },
+      {
+        "key": "QuarantineChannelID",
+        "display_name": "Quarantine Channel ID",
+        "type": "text",
+        "help_text": "(Optional) When set, Wrangler runs in soft-move mode: the original threads of moved and merged threads are relocated to this channel instead of being deleted, so that their original context is preserved. Restrict access to this channel as needed.",
+        "placeholder": "",
+        "default": null
+      },
+      {
+        "key": "QuarantineRetentionDays",
+        "display_name": "Quarantine Retention Days",
+        "type": "text",
+        "help_text": "The number of days quarantined threads are kept in the quarantine channel before they are purged. Leave empty for 30 days.",
+        "placeholder": "30",
+        "default": null
+      },
+      {
+        "key": "AuditChannelID",
+        "display_name": "Audit Channel ID",
+        "type": "text",
+        "help_text": "(Optional) When set, Wrangler posts a notice to this channel for every Wrangler operation, including silent moves, so that moderators can follow wrangling activity.",
+        "placeholder": "",
+        "default": null
+      },
+      {
+        "key": "MetricsToken",
+        "display_name": "Metrics Token",
+        "type": "text",
+        "help_text": "(Optional) A token that monitoring systems can send as a bearer token to read the Wrangler metrics at /plugins/com.mattermost.wrangler/metrics. System admins can always read the metrics. Leave empty to restrict the metrics to system admins.",
+        "placeholder": "",
+        "default": null
+      },
       {
         "key": "ThreadAttachMessage",
         "display_name": "Info-Message: Attached a Message",
@@ -8,6 +8,14 @@ import (
 	"github.com/pkg/errors"
 )
 
+const (
+	channelPostsPerPage = 200
+
+	// silentPostPlaceholder is the message posts created without
+	// notifications have until their real message is set.
+	silentPostPlaceholder = "Wrangler is copying this message."
+)
+
 // validateMoveOrCopy performs validation on a provided post list to determine
 // if all permissions are in place to allow the for the posts to be moved or
 // copied.
@@ -16,30 +24,12 @@ func (p *Plugin) validateMoveOrCopy(wpl *WranglerPostList, originalChannel *mode
 		return nil, false, errors.New("The wrangler post list contains no posts")
 	}
 
-	config := p.getConfiguration()
-
-	switch originalChannel.Type {
-	case model.CHANNEL_PRIVATE:
-		if !config.MoveThreadFromPrivateChannelEnable {
-			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Wrangler is currently configured to not allow moving posts from private channels"), false, nil
-		}
-	case model.CHANNEL_DIRECT:
-		if !config.MoveThreadFromDirectMessageChannelEnable {
-			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Wrangler is currently configured to not allow moving posts from direct message channels"), false, nil
-		}
-	case model.CHANNEL_GROUP:
-		if !config.MoveThreadFromGroupMessageChannelEnable {
-			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Wrangler is currently configured to not allow moving posts from group message channels"), false, nil
-		}
+	response := p.validateChannelTypeAndTeam(originalChannel, targetChannel)
+	if response != nil {
+		return response, false, nil
 	}
 
-	if !originalChannel.IsGroupOrDirect() {
-		// DM and GM channels are "teamless" so it doesn't make sense to check
-		// the MoveThreadToAnotherTeamEnable config when dealing with those.
-		if !config.MoveThreadToAnotherTeamEnable && targetChannel.TeamId != originalChannel.TeamId {
-			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Wrangler is currently configured to not allow moving messages to different teams"), false, nil
-		}
-	}
+	config := p.getConfiguration()
 
 	if config.MaxThreadCountMoveSizeInt() != 0 && config.MaxThreadCountMoveSizeInt() < wpl.NumPosts() {
 		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: the thread is %d posts long, but this command is configured to only move threads of up to %d posts", wpl.NumPosts(), config.MaxThreadCountMoveSizeInt())), true, nil
@@ -54,46 +44,34 @@ func (p *Plugin) validateMoveOrCopy(wpl *WranglerPostList, originalChannel *mode
 		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: channel with ID %s doesn't exist or you are not a member", targetChannel.Id)), true, nil
 	}
 
-	if extra.RootId == wpl.RootPost().Id || extra.ParentId == wpl.RootPost().Id {
+	// The post list may hold replies selected from a thread, in which case the
+	// command must not be run from inside their original thread.
+	rootID := getPostRootID(wpl.RootPost())
+	if extra.RootId == rootID || extra.ParentId == rootID {
 		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: this command cannot be run from inside the thread; please run directly in the channel containing the thread"), true, nil
 	}
 
 	return nil, false, nil
 }
 
-// validateMerge performs validation on a provided post list to determine if all
-// permissions are in place to allow the for the posts to be merged into another
-// thread.
-func (p *Plugin) validateMerge(wpl *WranglerPostList, targetRootPost *model.Post, originalChannel *model.Channel, targetChannel *model.Channel, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
-	if wpl.NumPosts() == 0 {
-		return nil, false, errors.New("The wrangler post list contains no posts")
-	}
-	if targetRootPost == nil {
-		return nil, false, errors.New("The target root post is nil")
-	}
-	if wpl.RootPost().Id == targetRootPost.Id {
-		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: Original and target threads are the same"), true, nil
-	}
-
-	err := p.ensureOriginalAndTargetChannelMember(originalChannel.Id, targetChannel.Id, extra.UserId)
-	if err != nil {
-		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, err.Error()), true, nil
-	}
-
+// validateChannelTypeAndTeam checks that the plugin configuration allows
+// messages to be moved out of the original channel and into the team of the
+// target channel.
+func (p *Plugin) validateChannelTypeAndTeam(originalChannel *model.Channel, targetChannel *model.Channel) *model.CommandResponse {
 	config := p.getConfiguration()
 
 	switch originalChannel.Type {
 	case model.CHANNEL_PRIVATE:
 		if !config.MoveThreadFromPrivateChannelEnable {
-			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Wrangler is currently configured to not allow moving posts from private channels"), false, nil
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Wrangler is currently configured to not allow moving posts from private channels")
 		}
 	case model.CHANNEL_DIRECT:
 		if !config.MoveThreadFromDirectMessageChannelEnable {
-			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Wrangler is currently configured to not allow moving posts from direct message channels"), false, nil
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Wrangler is currently configured to not allow moving posts from direct message channels")
 		}
 	case model.CHANNEL_GROUP:
 		if !config.MoveThreadFromGroupMessageChannelEnable {
-			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Wrangler is currently configured to not allow moving posts from group message channels"), false, nil
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Wrangler is currently configured to not allow moving posts from group message channels")
 		}
 	}
 
@@ -101,19 +79,50 @@ func (p *Plugin) validateMerge(wpl *WranglerPostList, targetRootPost *model.Post
 		// DM and GM channels are "teamless" so it doesn't make sense to check
 		// the MoveThreadToAnotherTeamEnable config when dealing with those.
 		if !config.MoveThreadToAnotherTeamEnable && targetChannel.TeamId != originalChannel.TeamId {
-			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Wrangler is currently configured to not allow moving messages to different teams"), false, nil
+			return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Wrangler is currently configured to not allow moving messages to different teams")
 		}
 	}
 
+	return nil
+}
+
+// validateMerge performs validation on a provided post list to determine if all
+// permissions are in place to allow the for the posts to be merged into another
+// thread. Older threads can only be merged into newer threads with the rebuild
+// merge mode.
+func (p *Plugin) validateMerge(wpl *WranglerPostList, targetRootPost *model.Post, originalChannel *model.Channel, targetChannel *model.Channel, extra *model.CommandArgs, mode string) (*model.CommandResponse, bool, error) {
+	if wpl.NumPosts() == 0 {
+		return nil, false, errors.New("The wrangler post list contains no posts")
+	}
+	if targetRootPost == nil {
+		return nil, false, errors.New("The target root post is nil")
+	}
+	if wpl.RootPost().Id == targetRootPost.Id {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: Original and target threads are the same"), true, nil
+	}
+
+	err := p.ensureOriginalAndTargetChannelMember(originalChannel.Id, targetChannel.Id, extra.UserId)
+	if err != nil {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, err.Error()), true, nil
+	}
+
+	response := p.validateChannelTypeAndTeam(originalChannel, targetChannel)
+	if response != nil {
+		return response, false, nil
+	}
+
+	config := p.getConfiguration()
+
 	if config.MaxThreadCountMoveSizeInt() != 0 && config.MaxThreadCountMoveSizeInt() < wpl.NumPosts() {
 		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: the thread is %d posts long, but this command is configured to only move threads of up to %d posts", wpl.NumPosts(), config.MaxThreadCountMoveSizeInt())), true, nil
 	}
 
-	if wpl.RootPost().CreateAt < targetRootPost.CreateAt {
-		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: Cannot merge older threads into newer threads. The destination thread must be older than the thread being moved."), true, nil
+	if mode != mergeModeRebuild && wpl.RootPost().CreateAt < targetRootPost.CreateAt {
+		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: Cannot merge older threads into newer threads. The destination thread must be older than the thread being moved. Use '--%s %s' to rebuild both threads together instead.", flagMergeThreadMode, mergeModeRebuild)), true, nil
 	}
 
-	if extra.RootId == wpl.RootPost().Id || extra.ParentId == wpl.RootPost().Id {
+	rootID := getPostRootID(wpl.RootPost())
+	if extra.RootId == rootID || extra.ParentId == rootID {
 		return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: this command cannot be run from inside the thread; please run directly in the channel containing the thread"), true, nil
 	}
 
@@ -142,7 +151,10 @@ func (p *Plugin) ensureChannelMember(channelID, userID string) error {
 	return nil
 }
 
-func (p *Plugin) copyWranglerPostlist(wpl *WranglerPostList, targetChannel *model.Channel) (*model.Post, error) {
+// copyWranglerPostlist recreates the posts of a post list as a new thread in
+// the target channel. Created posts and re-uploaded files are recorded in the
+// operation when one is provided.
+func (p *Plugin) copyWranglerPostlist(wpl *WranglerPostList, targetChannel *model.Channel, op *operation) (*model.Post, error) {
 	var err error
 	var appErr *model.AppError
 	var newRootPost *model.Post
@@ -157,30 +169,21 @@ func (p *Plugin) copyWranglerPostlist(wpl *WranglerPostList, targetChannel *mode
 		)
 
 		for _, post := range wpl.Posts {
-			var newFileIDs []string
-			var fileBytes []byte
-			var oldFileInfo, newFileInfo *model.FileInfo
-			for _, fileID := range post.FileIds {
-				oldFileInfo, appErr = p.API.GetFileInfo(fileID)
-				if appErr != nil {
-					return nil, errors.Wrap(appErr, "unable to lookup file info to re-upload")
-				}
-				fileBytes, appErr = p.API.GetFile(fileID)
-				if appErr != nil {
-					return nil, errors.Wrap(appErr, "unable to get file bytes to re-upload")
-				}
-				newFileInfo, appErr = p.API.UploadFile(fileBytes, targetChannel.Id, oldFileInfo.Name)
-				if appErr != nil {
-					return nil, errors.Wrap(appErr, "unable to re-upload file")
-				}
-
-				newFileIDs = append(newFileIDs, newFileInfo.Id)
+			newFileIDs, err := p.reuploadFileAttachments(post.FileIds, targetChannel.Id)
+			op.recordUploadedFiles(newFileIDs)
+			if err != nil {
+				return nil, errors.Wrapf(err, "unable to re-upload files of message %s", post.Id)
 			}
 
 			post.FileIds = newFileIDs
 		}
 	}
 
+	createPost := p.createPostWithRetries
+	if op != nil && op.silent {
+		createPost = p.createPostWithoutNotifications
+	}
+
 	for i, post := range wpl.Posts {
 		var reactions []*model.Reaction
 
@@ -197,50 +200,170 @@ func (p *Plugin) copyWranglerPostlist(wpl *WranglerPostList, targetChannel *mode
 		newPost.ChannelId = targetChannel.Id
 
 		if i == 0 {
-			newPost, err = p.createPostWithRetries(newPost, 200*time.Millisecond, 3)
+			// The first post may have been a reply in its original thread, such
+			// as when splitting a thread, so ensure it becomes a root post.
+			newPost.RootId = ""
+			newPost.ParentId = ""
+			newPost, err = createPost(newPost, retryBaseDelay, retryMaxRetries)
 			if err != nil {
-				return nil, errors.Wrap(err, "unable to create new root post")
+				return nil, errors.Wrapf(err, "unable to create new root post for message %s", post.Id)
 			}
 			newRootPost = newPost.Clone()
 		} else {
 			newPost.RootId = newRootPost.Id
 			newPost.ParentId = newRootPost.Id
-			newPost, err = p.createPostWithRetries(newPost, 200*time.Millisecond, 3)
+			newPost, err = createPost(newPost, retryBaseDelay, retryMaxRetries)
 			if err != nil {
-				return nil, errors.Wrap(err, "unable to create new post")
+				return nil, errors.Wrapf(err, "unable to create new post for message %s", post.Id)
 			}
 		}
+		op.recordPost(post, newPost)
 
-		for _, reaction := range reactions {
-			reaction.PostId = newPost.Id
-			_, appErr = p.API.AddReaction(reaction)
-			if appErr != nil {
-				// Reaction-based errors are logged, but do not cause the plugin to
-				// abort the move thread process.
-				p.API.LogError("Failed to reapply reactions to post", "err", appErr)
-			}
+		p.reapplyReactions(reactions, newPost.Id)
+
+		err = op.reportProgress()
+		if err != nil {
+			return nil, err
 		}
 	}
 
 	return newRootPost, nil
 }
 
+// reuploadFileAttachments re-uploads the files with the given IDs to a channel
+// and returns the IDs of the new files in the same order. If an upload fails,
+// the IDs of the files that were uploaded before the failure are returned
+// along with the error.
+func (p *Plugin) reuploadFileAttachments(fileIDs []string, channelID string) ([]string, error) {
+	var newFileIDs []string
+	for _, fileID := range fileIDs {
+		oldFileInfo, appErr := p.API.GetFileInfo(fileID)
+		if appErr != nil {
+			return newFileIDs, errors.Wrapf(appErr, "unable to lookup file info of file %s to re-upload", fileID)
+		}
+
+		var fileBytes []byte
+		err := p.withRetries("get file", retryBaseDelay, retryMaxRetries, func() *model.AppError {
+			fileBytes, appErr = p.API.GetFile(fileID)
+			return appErr
+		})
+		if err != nil {
+			return newFileIDs, errors.Wrapf(err, "unable to get bytes of file %s to re-upload", fileID)
+		}
+
+		var newFileInfo *model.FileInfo
+		err = p.withRetries("upload file", retryBaseDelay, retryMaxRetries, func() *model.AppError {
+			newFileInfo, appErr = p.API.UploadFile(fileBytes, channelID, oldFileInfo.Name)
+			return appErr
+		})
+		if err != nil {
+			return newFileIDs, errors.Wrapf(err, "unable to re-upload file %s", fileID)
+		}
+		p.metrics.observeFileReuploaded(len(fileBytes))
+
+		newFileIDs = append(newFileIDs, newFileInfo.Id)
+	}
+
+	return newFileIDs, nil
+}
+
+// reapplyReactions adds the given reactions to a post. Reaction-based errors
+// are logged, but are not returned as they should not abort a Wrangler
+// operation.
+func (p *Plugin) reapplyReactions(reactions []*model.Reaction, postID string) {
+	for _, reaction := range reactions {
+		reaction.PostId = postID
+		err := p.withRetries("add reaction", retryBaseDelay, retryMaxRetries, func() *model.AppError {
+			_, appErr := p.API.AddReaction(reaction)
+			return appErr
+		})
+		if err != nil {
+			p.metrics.observeReactionFailure()
+			p.API.LogError("Failed to reapply reactions to post", "err", err.Error())
+		}
+	}
+}
+
+// createPostWithRetries creates a post. Permanent errors fail right away and
+// other errors are retried with exponential backoff.
 func (p *Plugin) createPostWithRetries(post *model.Post, retryDuration time.Duration, maxRetries int) (*model.Post, error) {
-	var retries int
+	var newPost *model.Post
+	err := p.withRetries("create post", retryDuration, maxRetries, func() *model.AppError {
+		var appErr *model.AppError
+		newPost, appErr = p.API.CreatePost(post)
+		return appErr
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.metrics.observePostRecreated()
 
-	for {
-		newPost, appErr := p.API.CreatePost(post)
-		if appErr == nil {
-			return newPost, nil
+	return newPost, nil
+}
+
+// createPostWithoutNotifications creates a post like createPostWithRetries,
+// but without notifying the users it mentions. Mattermost only sends
+// notifications when a post is created, so the post is created with a
+// placeholder message that is then replaced with the real one.
+func (p *Plugin) createPostWithoutNotifications(post *model.Post, retryDuration time.Duration, maxRetries int) (*model.Post, error) {
+	if len(post.Message) == 0 {
+		return p.createPostWithRetries(post, retryDuration, maxRetries)
+	}
+
+	placeholderPost := post.Clone()
+	placeholderPost.Message = silentPostPlaceholder
+	newPost, err := p.createPostWithRetries(placeholderPost, retryDuration, maxRetries)
+	if err != nil {
+		return nil, err
+	}
+
+	newPost.Message = post.Message
+	var updatedPost *model.Post
+	err = p.withRetries("update post", retryDuration, maxRetries, func() *model.AppError {
+		var appErr *model.AppError
+		updatedPost, appErr = p.API.UpdatePost(newPost)
+		return appErr
+	})
+	if err != nil {
+		// The placeholder post isn't recorded anywhere yet, so it is removed
+		// here rather than by a rollback.
+		appErr := p.API.DeletePost(newPost.Id)
+		if appErr != nil {
+			p.API.LogWarn("Unable to remove placeholder post",
+				"error", appErr.Error(),
+				"post_id", newPost.Id,
+			)
+		}
+		return nil, err
+	}
+
+	return updatedPost, nil
+}
+
+// getChannelPostsSince returns all posts in a channel created at or after the
+// given timestamp, ordered from newest to oldest.
+func (p *Plugin) getChannelPostsSince(channelID string, since int64) ([]*model.Post, error) {
+	var posts []*model.Post
+
+	for page := 0; ; page++ {
+		postList, appErr := p.API.GetPostsForChannel(channelID, page, channelPostsPerPage)
+		if appErr != nil {
+			return nil, errors.Wrap(appErr, "unable to get posts for channel")
 		}
-		p.API.LogWarn("Failed to create post", "err", appErr)
 
-		retries++
-		if retries > maxRetries {
-			return nil, errors.Errorf("failed to create post after %d retries", maxRetries)
+		pagePosts := postList.ToSlice()
+		for _, post := range pagePosts {
+			if post.CreateAt < since {
+				// Posts are returned newest first, so there is nothing left
+				// to find once a post is older than the requested time.
+				return posts, nil
+			}
+			posts = append(posts, post)
 		}
 
-		time.Sleep(retryDuration)
+		if len(pagePosts) < channelPostsPerPage {
+			return posts, nil
+		}
 	}
 }
 
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	commandOutcomeSuccess   = "success"
+	commandOutcomeUserError = "user_error"
+	commandOutcomeError     = "error"
+)
+
+// operationLatencyBuckets are the upper bounds, in seconds, of the buckets of
+// the operation latency histogram.
+var operationLatencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// metrics collects Wrangler activity and writes it in the Prometheus text
+// format. Every method is safe to call on a nil metrics, which does nothing.
+type metrics struct {
+	lock sync.Mutex
+
+	commands          map[[2]string]uint64
+	postsRecreated    uint64
+	filesReuploaded   uint64
+	bytesReuploaded   uint64
+	retries           map[string]uint64
+	reactionFailures  uint64
+	operationLatency  map[string]*histogram
+	operationOutcomes map[[2]string]uint64
+}
+
+// histogram counts observations in cumulative buckets like a Prometheus
+// histogram.
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		commands:          make(map[[2]string]uint64),
+		retries:           make(map[string]uint64),
+		operationLatency:  make(map[string]*histogram),
+		operationOutcomes: make(map[[2]string]uint64),
+	}
+}
+
+// observeCommand counts a slash command run with the given outcome.
+func (m *metrics) observeCommand(command, outcome string) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.commands[[2]string{command, outcome}]++
+}
+
+// observePostRecreated counts a post that was recreated by an operation.
+func (m *metrics) observePostRecreated() {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.postsRecreated++
+}
+
+// observeFileReuploaded counts a file of the given size that was re-uploaded.
+func (m *metrics) observeFileReuploaded(size int) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.filesReuploaded++
+	m.bytesReuploaded += uint64(size)
+}
+
+// observeRetry counts a retried request to the Mattermost server.
+func (m *metrics) observeRetry(action string) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.retries[action]++
+}
+
+// observeReactionFailure counts a reaction that couldn't be reapplied.
+func (m *metrics) observeReactionFailure() {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.reactionFailures++
+}
+
+// observeOperation counts a finished operation of the given type and records
+// how long it took.
+func (m *metrics) observeOperation(operationType, outcome string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.operationOutcomes[[2]string{operationType, outcome}]++
+
+	h, ok := m.operationLatency[operationType]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(operationLatencyBuckets))}
+		m.operationLatency[operationType] = h
+	}
+	seconds := duration.Seconds()
+	for i, bound := range operationLatencyBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// writeTo writes every metric to w in the Prometheus text exposition format.
+// Labelled series are sorted so that the output is stable.
+func (m *metrics) writeTo(w io.Writer) error {
+	var b strings.Builder
+
+	writeHeader := func(name, metricType, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+	}
+
+	if m != nil {
+		m.lock.Lock()
+
+		writeHeader("wrangler_commands_total", "counter", "Wrangler slash commands run, by command and outcome.")
+		for _, key := range sortedPairKeys(m.commands) {
+			fmt.Fprintf(&b, "wrangler_commands_total{command=%s,outcome=%s} %d\n", quoteLabel(key[0]), quoteLabel(key[1]), m.commands[key])
+		}
+
+		writeHeader("wrangler_operations_total", "counter", "Wrangler operations finished, by type and outcome.")
+		for _, key := range sortedPairKeys(m.operationOutcomes) {
+			fmt.Fprintf(&b, "wrangler_operations_total{type=%s,outcome=%s} %d\n", quoteLabel(key[0]), quoteLabel(key[1]), m.operationOutcomes[key])
+		}
+
+		writeHeader("wrangler_operation_duration_seconds", "histogram", "How long Wrangler operations took, by type.")
+		var operationTypes []string
+		for operationType := range m.operationLatency {
+			operationTypes = append(operationTypes, operationType)
+		}
+		sort.Strings(operationTypes)
+		for _, operationType := range operationTypes {
+			h := m.operationLatency[operationType]
+			label := quoteLabel(operationType)
+			for i, bound := range operationLatencyBuckets {
+				fmt.Fprintf(&b, "wrangler_operation_duration_seconds_bucket{type=%s,le=\"%s\"} %d\n", label, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+			}
+			fmt.Fprintf(&b, "wrangler_operation_duration_seconds_bucket{type=%s,le=\"+Inf\"} %d\n", label, h.count)
+			fmt.Fprintf(&b, "wrangler_operation_duration_seconds_sum{type=%s} %s\n", label, strconv.FormatFloat(h.sum, 'g', -1, 64))
+			fmt.Fprintf(&b, "wrangler_operation_duration_seconds_count{type=%s} %d\n", label, h.count)
+		}
+
+		writeHeader("wrangler_posts_recreated_total", "counter", "Posts recreated by Wrangler operations.")
+		fmt.Fprintf(&b, "wrangler_posts_recreated_total %d\n", m.postsRecreated)
+
+		writeHeader("wrangler_files_reuploaded_total", "counter", "File attachments re-uploaded by Wrangler operations.")
+		fmt.Fprintf(&b, "wrangler_files_reuploaded_total %d\n", m.filesReuploaded)
+
+		writeHeader("wrangler_file_bytes_reuploaded_total", "counter", "Bytes of file attachments re-uploaded by Wrangler operations.")
+		fmt.Fprintf(&b, "wrangler_file_bytes_reuploaded_total %d\n", m.bytesReuploaded)
+
+		writeHeader("wrangler_request_retries_total", "counter", "Requests to the Mattermost server that were retried, by action.")
+		var actions []string
+		for action := range m.retries {
+			actions = append(actions, action)
+		}
+		sort.Strings(actions)
+		for _, action := range actions {
+			fmt.Fprintf(&b, "wrangler_request_retries_total{action=%s} %d\n", quoteLabel(action), m.retries[action])
+		}
+
+		writeHeader("wrangler_reaction_reapply_failures_total", "counter", "Reactions that couldn't be reapplied to recreated posts.")
+		fmt.Fprintf(&b, "wrangler_reaction_reapply_failures_total %d\n", m.reactionFailures)
+
+		m.lock.Unlock()
+	}
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+func sortedPairKeys(values map[[2]string]uint64) [][2]string {
+	var keys [][2]string
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+
+	return keys
+}
+
+// quoteLabel quotes a label value, escaping it as the Prometheus text format
+// requires.
+func quoteLabel(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, "\n", `\n`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+
+	return `"` + value + `"`
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Run("nil metrics", func(t *testing.T) {
+		var m *metrics
+		m.observeCommand("move thread", commandOutcomeSuccess)
+		m.observePostRecreated()
+		m.observeFileReuploaded(10)
+		m.observeRetry("create post")
+		m.observeReactionFailure()
+		m.observeOperation(operationTypeMove, auditOutcomeSucceeded, time.Second)
+
+		var b strings.Builder
+		require.NoError(t, m.writeTo(&b))
+		assert.Empty(t, b.String())
+	})
+
+	m := newMetrics()
+	m.observeCommand("move thread", commandOutcomeSuccess)
+	m.observeCommand("move thread", commandOutcomeSuccess)
+	m.observeCommand("copy thread", commandOutcomeError)
+	m.observePostRecreated()
+	m.observePostRecreated()
+	m.observePostRecreated()
+	m.observeFileReuploaded(1024)
+	m.observeFileReuploaded(512)
+	m.observeRetry("create post")
+	m.observeRetry("upload file")
+	m.observeRetry("create post")
+	m.observeReactionFailure()
+	m.observeOperation(operationTypeMove, auditOutcomeSucceeded, 300*time.Millisecond)
+	m.observeOperation(operationTypeMove, auditOutcomeRolledBack, 4*time.Second)
+
+	var b strings.Builder
+	require.NoError(t, m.writeTo(&b))
+	output := b.String()
+
+	for _, line := range []string{
+		"# TYPE wrangler_commands_total counter",
+		`wrangler_commands_total{command="copy thread",outcome="error"} 1`,
+		`wrangler_commands_total{command="move thread",outcome="success"} 2`,
+		`wrangler_operations_total{type="move",outcome="rolled_back"} 1`,
+		`wrangler_operations_total{type="move",outcome="succeeded"} 1`,
+		"# TYPE wrangler_operation_duration_seconds histogram",
+		`wrangler_operation_duration_seconds_bucket{type="move",le="0.25"} 0`,
+		`wrangler_operation_duration_seconds_bucket{type="move",le="0.5"} 1`,
+		`wrangler_operation_duration_seconds_bucket{type="move",le="5"} 2`,
+		`wrangler_operation_duration_seconds_bucket{type="move",le="+Inf"} 2`,
+		`wrangler_operation_duration_seconds_sum{type="move"} 4.3`,
+		`wrangler_operation_duration_seconds_count{type="move"} 2`,
+		"wrangler_posts_recreated_total 3",
+		"wrangler_files_reuploaded_total 2",
+		"wrangler_file_bytes_reuploaded_total 1536",
+		`wrangler_request_retries_total{action="create post"} 2`,
+		`wrangler_request_retries_total{action="upload file"} 1`,
+		"wrangler_reaction_reapply_failures_total 1",
+	} {
+		assert.Contains(t, output, line+"\n")
+	}
+
+	// Series are sorted so that the output is stable.
+	assert.Less(t, strings.Index(output, `command="copy thread"`), strings.Index(output, `command="move thread"`))
+}
+
+func TestQuoteLabel(t *testing.T) {
+	assert.Equal(t, `"move thread"`, quoteLabel("move thread"))
+	assert.Equal(t, `"a\"b\\c\nd"`, quoteLabel("a\"b\\c\nd"))
+}
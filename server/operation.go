@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	operationKeyPrefix     = "operation_"
+	lastOperationKeyPrefix = "last_operation_"
+
+	operationTypeMove   = "move"
+	operationTypeCopy   = "copy"
+	operationTypeMerge  = "merge"
+	operationTypeAttach = "attach"
+
+	// The following operations are not journaled, so they can't be undone,
+	// but they are still tracked so that they can be rolled back on failure.
+	operationTypeSplit       = "split"
+	operationTypeReroot      = "reroot"
+	operationTypeFlatten     = "flatten"
+	operationTypeMoveReplies = "move_replies"
+	operationTypeGather      = "gather"
+	operationTypeDetach      = "detach"
+	operationTypeUndo        = "undo"
+)
+
+// operation is a journal entry recording the posts involved in a Wrangler
+// operation. It is stored in the plugin KV store so that the operation can be
+// undone later.
+type operation struct {
+	ID       string          `json:"id"`
+	Type     string          `json:"type"`
+	UserID   string          `json:"user_id"`
+	CreateAt int64           `json:"create_at"`
+	Posts    []operationPost `json:"posts"`
+	Undone   bool            `json:"undone"`
+	// UndoneOperationID is the operation reversed by an undo operation.
+	UndoneOperationID string `json:"undone_operation_id,omitempty"`
+	// Audit is the audit log entry of the operation, if it is audited. It is
+	// stored with the operation so that an interrupted operation can still be
+	// audited once it is resumed.
+	Audit *auditEntry `json:"audit,omitempty"`
+
+	// pendingFileIDs are re-uploaded files that have not been attached to a
+	// created post yet. They are only needed while the operation is running.
+	pendingFileIDs []string
+
+	// job is the background job running the operation, if any.
+	job *runningJob
+
+	// rolledBack is set once the operation has been rolled back.
+	rolledBack bool
+	// finished is set once the operation has completed.
+	finished bool
+	// silent is set for operations whose posts must not notify the users
+	// they mention again.
+	silent bool
+	// quarantined is set once the original threads of a soft move or merge
+	// have been quarantined.
+	quarantined bool
+
+	// lock is held on the threads the operation changes while it runs.
+	lock *threadLock
+
+	// store is set for operations that checkpoint their progress. See
+	// startOperation.
+	store        *Plugin
+	checkpointed bool
+	// checkpointedPosts is the number of posts stored by the last checkpoint.
+	checkpointedPosts int
+	// deletePostIDs are the original posts the operation deletes once every
+	// post has been created.
+	deletePostIDs   []string
+	checkpointError string
+}
+
+// operationPost links a post created by an operation to the original post it
+// was created from. Posts created by Wrangler itself, such as bot messages,
+// have no original post.
+type operationPost struct {
+	OriginalID        string `json:"original_id,omitempty"`
+	OriginalChannelID string `json:"original_channel_id,omitempty"`
+	OriginalRootID    string `json:"original_root_id,omitempty"`
+	OriginalCreateAt  int64  `json:"original_create_at,omitempty"`
+	NewID             string `json:"new_id"`
+}
+
+func newOperation(operationType, userID string) *operation {
+	return &operation{
+		ID:       model.NewId(),
+		Type:     operationType,
+		UserID:   userID,
+		CreateAt: model.GetMillis(),
+	}
+}
+
+// recordPost adds a post created by the operation to the journal. The
+// original post can be nil for posts that were not created from another post.
+// Recording on a nil operation does nothing.
+func (o *operation) recordPost(originalPost, newPost *model.Post) {
+	if o == nil {
+		return
+	}
+
+	entry := operationPost{NewID: newPost.Id}
+	if originalPost != nil {
+		entry.OriginalID = originalPost.Id
+		entry.OriginalChannelID = originalPost.ChannelId
+		entry.OriginalRootID = originalPost.RootId
+		entry.OriginalCreateAt = originalPost.CreateAt
+	}
+	o.Posts = append(o.Posts, entry)
+
+	if len(o.pendingFileIDs) == 0 || len(newPost.FileIds) == 0 {
+		// Posts are checkpointed in batches. A resumed operation can't
+		// remove the posts created since its last checkpoint, so the batches
+		// are kept small.
+		if !o.checkpointed || len(o.Posts)-o.checkpointedPosts >= checkpointPostInterval {
+			o.checkpoint(false)
+		}
+		return
+	}
+	attached := make(map[string]bool)
+	for _, fileID := range newPost.FileIds {
+		attached[fileID] = true
+	}
+	var pendingFileIDs []string
+	for _, fileID := range o.pendingFileIDs {
+		if !attached[fileID] {
+			pendingFileIDs = append(pendingFileIDs, fileID)
+		}
+	}
+	o.pendingFileIDs = pendingFileIDs
+	o.checkpoint(true)
+}
+
+// recordUploadedFiles tracks re-uploaded files until they are attached to a
+// post recorded with recordPost. Recording on a nil operation does nothing.
+func (o *operation) recordUploadedFiles(fileIDs []string) {
+	if o == nil {
+		return
+	}
+
+	if len(fileIDs) == 0 {
+		return
+	}
+
+	o.pendingFileIDs = append(o.pendingFileIDs, fileIDs...)
+	o.checkpoint(true)
+}
+
+// journaled returns whether operations of this type are journaled so that
+// they can be undone.
+func (o *operation) journaled() bool {
+	switch o.Type {
+	case operationTypeMove, operationTypeCopy, operationTypeMerge, operationTypeAttach:
+		return true
+	}
+
+	return false
+}
+
+// originalPostCount returns the number of journaled posts that were created
+// from an original post.
+func (o *operation) originalPostCount() int {
+	var count int
+	for _, post := range o.Posts {
+		if len(post.OriginalID) != 0 {
+			count++
+		}
+	}
+
+	return count
+}
+
+func operationKey(operationID string) string {
+	return operationKeyPrefix + operationID
+}
+
+func lastOperationKey(userID string) string {
+	return lastOperationKeyPrefix + userID
+}
+
+// saveOperation stores the operation in the KV store and marks it as the most
+// recent operation of the user who ran it.
+func (p *Plugin) saveOperation(op *operation) error {
+	data, err := json.Marshal(op)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal operation")
+	}
+
+	appErr := p.API.KVSet(operationKey(op.ID), data)
+	if appErr != nil {
+		return errors.Wrap(appErr, "unable to save operation")
+	}
+	appErr = p.API.KVSet(lastOperationKey(op.UserID), []byte(op.ID))
+	if appErr != nil {
+		return errors.Wrap(appErr, "unable to save last operation")
+	}
+
+	return nil
+}
+
+// journalOperation saves the operation and logs any failure. Failing to
+// journal an operation only prevents it from being undone, so it is not
+// treated as an error for the operation itself.
+func (p *Plugin) journalOperation(op *operation) {
+	err := p.saveOperation(op)
+	if err != nil {
+		p.API.LogError("Unable to journal Wrangler operation",
+			"error", err.Error(),
+			"operation_id", op.ID,
+		)
+	}
+}
+
+// getOperation returns the operation with the given ID or nil if it does not
+// exist.
+func (p *Plugin) getOperation(operationID string) (*operation, error) {
+	data, appErr := p.API.KVGet(operationKey(operationID))
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "unable to get operation")
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	var op operation
+	err := json.Unmarshal(data, &op)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to unmarshal operation")
+	}
+
+	return &op, nil
+}
+
+// getLastOperationID returns the ID of the most recent operation run by the
+// user or an empty string if there is none.
+func (p *Plugin) getLastOperationID(userID string) (string, error) {
+	data, appErr := p.API.KVGet(lastOperationKey(userID))
+	if appErr != nil {
+		return "", errors.Wrap(appErr, "unable to get last operation")
+	}
+
+	return string(data), nil
+}
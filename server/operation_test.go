@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperationRecordPost(t *testing.T) {
+	t.Run("nil operation", func(t *testing.T) {
+		var op *operation
+		assert.NotPanics(t, func() {
+			op.recordPost(mockGeneratePost(), mockGeneratePost())
+		})
+	})
+
+	t.Run("with and without original posts", func(t *testing.T) {
+		op := newOperation(operationTypeMove, model.NewId())
+		original := mockGeneratePost()
+		original.RootId = model.NewId()
+		created := mockGeneratePost()
+		botPost := mockGeneratePost()
+
+		op.recordPost(original, created)
+		op.recordPost(nil, botPost)
+
+		require.Len(t, op.Posts, 2)
+		assert.Equal(t, operationPost{
+			OriginalID:        original.Id,
+			OriginalChannelID: original.ChannelId,
+			OriginalRootID:    original.RootId,
+			NewID:             created.Id,
+		}, op.Posts[0])
+		assert.Equal(t, operationPost{NewID: botPost.Id}, op.Posts[1])
+		assert.Equal(t, 1, op.originalPostCount())
+	})
+
+	t.Run("uploaded files are pending until attached", func(t *testing.T) {
+		op := newOperation(operationTypeMove, model.NewId())
+		attachedFileID := model.NewId()
+		orphanedFileID := model.NewId()
+		op.recordUploadedFiles([]string{attachedFileID, orphanedFileID})
+
+		created := mockGeneratePost()
+		created.FileIds = model.StringArray{attachedFileID}
+		op.recordPost(mockGeneratePost(), created)
+
+		assert.Equal(t, []string{orphanedFileID}, op.pendingFileIDs)
+	})
+}
+
+func TestOperationStore(t *testing.T) {
+	op := newOperation(operationTypeCopy, model.NewId())
+	op.recordPost(mockGeneratePost(), mockGeneratePost())
+	data, err := json.Marshal(op)
+	require.NoError(t, err)
+
+	api := &plugintest.API{}
+	api.On("KVSet", operationKey(op.ID), data).Return(nil)
+	api.On("KVSet", lastOperationKey(op.UserID), []byte(op.ID)).Return(nil)
+	api.On("KVGet", operationKey(op.ID)).Return(data, nil)
+	api.On("KVGet", lastOperationKey(op.UserID)).Return([]byte(op.ID), nil)
+	api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+
+	var plugin Plugin
+	plugin.SetAPI(api)
+
+	t.Run("save", func(t *testing.T) {
+		require.NoError(t, plugin.saveOperation(op))
+	})
+
+	t.Run("get", func(t *testing.T) {
+		stored, err := plugin.getOperation(op.ID)
+		require.NoError(t, err)
+		assert.Equal(t, op, stored)
+	})
+
+	t.Run("get missing", func(t *testing.T) {
+		stored, err := plugin.getOperation(model.NewId())
+		require.NoError(t, err)
+		assert.Nil(t, stored)
+	})
+
+	t.Run("get last operation ID", func(t *testing.T) {
+		operationID, err := plugin.getLastOperationID(op.UserID)
+		require.NoError(t, err)
+		assert.Equal(t, op.ID, operationID)
+	})
+}
@@ -21,6 +21,24 @@ type Plugin struct {
 	// configuration is the active plugin configuration. Consult getConfiguration and
 	// setConfiguration for usage.
 	configuration *configuration
+
+	// jobsLock synchronizes access to the running background jobs.
+	jobsLock sync.Mutex
+
+	// runningJobs are the background jobs currently running, keyed by job ID.
+	runningJobs map[string]*runningJob
+
+	// jobsWaitGroup tracks the goroutines of running background jobs.
+	jobsWaitGroup sync.WaitGroup
+
+	// stopQuarantinePurge stops the job purging expired quarantined threads.
+	stopQuarantinePurge chan struct{}
+
+	// stopOperationResume stops the job resuming interrupted operations.
+	stopOperationResume chan struct{}
+
+	// metrics collects Wrangler activity for the metrics endpoint.
+	metrics *metrics
 }
 
 // BuildHash is the full git hash of the build.
@@ -41,6 +59,10 @@ func (p *Plugin) OnActivate() error {
 		return errors.Wrap(err, "invalid config")
 	}
 
+	if p.metrics == nil {
+		p.metrics = newMetrics()
+	}
+
 	bot := &model.Bot{
 		Username:    "wrangler",
 		DisplayName: "Wrangler",
@@ -64,5 +86,40 @@ func (p *Plugin) OnActivate() error {
 		return errors.Wrap(err, "failed to register wrangler command")
 	}
 
+	// Operations interrupted by a restart are resumed in the background so
+	// that activation isn't held up. Operations whose checkpoints aren't stale
+	// yet are picked up by a later run.
+	p.stopOperationResume = make(chan struct{})
+	p.jobsWaitGroup.Add(1)
+	go func(stop <-chan struct{}) {
+		defer p.jobsWaitGroup.Done()
+		p.runOperationResume(stop)
+	}(p.stopOperationResume)
+
+	// Quarantined threads are purged for as long as the plugin is active,
+	// even if soft-move mode has since been disabled.
+	p.stopQuarantinePurge = make(chan struct{})
+	p.jobsWaitGroup.Add(1)
+	go func(stop <-chan struct{}) {
+		defer p.jobsWaitGroup.Done()
+		p.runQuarantinePurge(stop)
+	}(p.stopQuarantinePurge)
+
+	return nil
+}
+
+// OnDeactivate runs when the plugin deactivates. Running background jobs are
+// canceled and rolled back so that no operation is left half finished.
+func (p *Plugin) OnDeactivate() error {
+	if p.stopQuarantinePurge != nil {
+		close(p.stopQuarantinePurge)
+		p.stopQuarantinePurge = nil
+	}
+	if p.stopOperationResume != nil {
+		close(p.stopOperationResume)
+		p.stopOperationResume = nil
+	}
+	p.stopRunningJobs()
+
 	return nil
 }
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const flagDryRun = "dry-run"
+
+// operationPreview describes what a Wrangler operation would do without
+// changing any messages.
+type operationPreview struct {
+	Action            string         `json:"action"`
+	PostCount         int            `json:"post_count"`
+	ParticipantIDs    []string       `json:"participant_ids"`
+	Participants      []string       `json:"participants"`
+	FileCount         int64          `json:"file_count"`
+	FileBytes         int64          `json:"file_bytes"`
+	Reactions         map[string]int `json:"reactions"`
+	TargetTeamName    string         `json:"target_team_name"`
+	TargetChannelName string         `json:"target_channel_name"`
+	TargetChannelType string         `json:"target_channel_type"`
+	Blocked           bool           `json:"blocked"`
+	BlockedReason     string         `json:"blocked_reason,omitempty"`
+}
+
+// buildOperationPreview gathers the details of an operation on the given post
+// list. The blocking response is the validation result that would stop the
+// operation, if any.
+func (p *Plugin) buildOperationPreview(action string, wpl *WranglerPostList, targetChannel *model.Channel, blockingResponse *model.CommandResponse) (*operationPreview, error) {
+	preview := &operationPreview{
+		Action:            action,
+		PostCount:         wpl.NumPosts(),
+		ParticipantIDs:    wpl.ThreadUserIDs,
+		FileCount:         wpl.FileAttachmentCount,
+		Reactions:         make(map[string]int),
+		TargetChannelName: targetChannel.Name,
+		TargetChannelType: channelTypeName(targetChannel.Type),
+	}
+	if blockingResponse != nil {
+		preview.Blocked = true
+		preview.BlockedReason = blockingResponse.Text
+	}
+
+	// Participants that can't be looked up, such as deleted users, are
+	// listed by their user ID instead.
+	for _, userID := range wpl.ThreadUserIDs {
+		username := userID
+		if user, appErr := p.API.GetUser(userID); appErr == nil {
+			username = user.Username
+		}
+		preview.Participants = append(preview.Participants, username)
+	}
+
+	for _, post := range wpl.Posts {
+		for _, fileID := range post.FileIds {
+			fileInfo, appErr := p.API.GetFileInfo(fileID)
+			if appErr != nil {
+				return nil, errors.Wrap(appErr, "unable to lookup file info")
+			}
+			preview.FileBytes += fileInfo.Size
+		}
+
+		reactions, appErr := p.API.GetReactions(post.Id)
+		if appErr != nil {
+			return nil, errors.Wrap(appErr, "unable to get reactions")
+		}
+		for _, reaction := range reactions {
+			preview.Reactions[reaction.EmojiName]++
+		}
+	}
+
+	if len(targetChannel.TeamId) != 0 {
+		team, appErr := p.API.GetTeam(targetChannel.TeamId)
+		if appErr != nil {
+			return nil, errors.Wrapf(appErr, "unable to get team with ID %s", targetChannel.TeamId)
+		}
+		preview.TargetTeamName = team.Name
+	}
+
+	return preview, nil
+}
+
+// previewMoveOrCopy loads and validates a thread move or copy and returns a
+// preview of it. A command response is returned instead when the provided IDs
+// are invalid.
+func (p *Plugin) previewMoveOrCopy(action, postID, channelID string, extra *model.CommandArgs) (*operationPreview, *model.CommandResponse, error) {
+	postListResponse, appErr := p.API.GetPostThread(postID)
+	if appErr != nil {
+		return nil, getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: unable to get post with ID %s; ensure this is correct", postID)), nil
+	}
+	wpl := buildWranglerPostList(postListResponse)
+
+	originalChannel, appErr := p.API.GetChannel(extra.ChannelId)
+	if appErr != nil {
+		return nil, nil, errors.Errorf("unable to get channel with ID %s", extra.ChannelId)
+	}
+	_, appErr = p.API.GetChannelMember(channelID, extra.UserId)
+	if appErr != nil {
+		return nil, getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, fmt.Sprintf("Error: channel with ID %s doesn't exist or you are not a member", channelID)), nil
+	}
+	targetChannel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		return nil, nil, errors.Errorf("unable to get channel with ID %s", channelID)
+	}
+
+	response, _, err := p.validateMoveOrCopy(wpl, originalChannel, targetChannel, extra)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	preview, err := p.buildOperationPreview(action, wpl, targetChannel, response)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return preview, nil, nil
+}
+
+func previewResponse(preview *operationPreview) (*model.CommandResponse, bool, error) {
+	return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, preview.markdown()), false, nil
+}
+
+func (preview *operationPreview) markdown() string {
+	msg := fmt.Sprintf("#### Dry run: %s\nNo messages were changed.\n\n", preview.Action)
+	msg += fmt.Sprintf("- Messages: %d\n", preview.PostCount)
+
+	var participants []string
+	for i, username := range preview.Participants {
+		if i < len(preview.ParticipantIDs) && username == preview.ParticipantIDs[i] {
+			participants = append(participants, inlineCode(username))
+			continue
+		}
+		participants = append(participants, "@"+username)
+	}
+	msg += fmt.Sprintf("- Participants: %s\n", strings.Join(participants, ", "))
+	msg += fmt.Sprintf("- Files: %d (%s)\n", preview.FileCount, formatBytes(preview.FileBytes))
+
+	var emojiNames []string
+	for emojiName := range preview.Reactions {
+		emojiNames = append(emojiNames, emojiName)
+	}
+	sort.Strings(emojiNames)
+	var reactions []string
+	for _, emojiName := range emojiNames {
+		reactions = append(reactions, fmt.Sprintf(":%s: x%d", emojiName, preview.Reactions[emojiName]))
+	}
+	if len(reactions) == 0 {
+		reactions = append(reactions, "none")
+	}
+	msg += fmt.Sprintf("- Reactions to reapply: %s\n", strings.Join(reactions, ", "))
+
+	target := fmt.Sprintf("%s channel %s", preview.TargetChannelType, inlineCode(preview.TargetChannelName))
+	if len(preview.TargetTeamName) != 0 {
+		target += fmt.Sprintf(" in team %s", inlineCode(preview.TargetTeamName))
+	}
+	msg += fmt.Sprintf("- Target: %s\n", target)
+
+	if preview.Blocked {
+		msg += fmt.Sprintf("\nThis operation would be blocked: %s", preview.BlockedReason)
+	} else {
+		msg += "\nThis operation would be allowed."
+	}
+
+	return msg
+}
+
+func channelTypeName(channelType string) string {
+	switch channelType {
+	case model.CHANNEL_OPEN:
+		return "public"
+	case model.CHANNEL_PRIVATE:
+		return "private"
+	case model.CHANNEL_DIRECT:
+		return "direct message"
+	case model.CHANNEL_GROUP:
+		return "group message"
+	}
+
+	return "unknown"
+}
+
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
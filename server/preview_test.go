@@ -0,0 +1,117 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildOperationPreview(t *testing.T) {
+	team := &model.Team{
+		Id:   model.NewId(),
+		Name: "target-team",
+	}
+	targetChannel := &model.Channel{
+		Id:     model.NewId(),
+		TeamId: team.Id,
+		Name:   "target-channel",
+		Type:   model.CHANNEL_PRIVATE,
+	}
+	user1 := &model.User{Id: model.NewId(), Username: "user1"}
+	user2 := &model.User{Id: model.NewId(), Username: "user2"}
+
+	rootPost := &model.Post{
+		Id:       model.NewId(),
+		UserId:   user1.Id,
+		FileIds:  model.StringArray{model.NewId(), model.NewId()},
+		CreateAt: 1000,
+	}
+	reply := &model.Post{
+		Id:       model.NewId(),
+		UserId:   user2.Id,
+		RootId:   rootPost.Id,
+		CreateAt: 1001,
+	}
+	wpl := buildWranglerPostListFromPosts([]*model.Post{rootPost, reply})
+
+	api := &plugintest.API{}
+	api.On("GetUser", user1.Id).Return(user1, nil)
+	api.On("GetUser", user2.Id).Return(user2, nil)
+	api.On("GetFileInfo", rootPost.FileIds[0]).Return(&model.FileInfo{Size: 1024}, nil)
+	api.On("GetFileInfo", rootPost.FileIds[1]).Return(&model.FileInfo{Size: 2048}, nil)
+	api.On("GetReactions", rootPost.Id).Return([]*model.Reaction{{EmojiName: "smile"}, {EmojiName: "+1"}}, nil)
+	api.On("GetReactions", reply.Id).Return([]*model.Reaction{{EmojiName: "smile"}}, nil)
+	api.On("GetTeam", team.Id).Return(team, nil)
+
+	var plugin Plugin
+	plugin.SetAPI(api)
+
+	t.Run("allowed", func(t *testing.T) {
+		preview, err := plugin.buildOperationPreview("move thread", wpl, targetChannel, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 2, preview.PostCount)
+		assert.ElementsMatch(t, []string{"user1", "user2"}, preview.Participants)
+		assert.EqualValues(t, 2, preview.FileCount)
+		assert.EqualValues(t, 3072, preview.FileBytes)
+		assert.Equal(t, map[string]int{"smile": 2, "+1": 1}, preview.Reactions)
+		assert.Equal(t, "target-team", preview.TargetTeamName)
+		assert.Equal(t, "private", preview.TargetChannelType)
+		assert.False(t, preview.Blocked)
+
+		msg := preview.markdown()
+		assert.Contains(t, msg, "#### Dry run: move thread")
+		assert.Contains(t, msg, "- Files: 2 (3.0 KB)")
+		assert.Contains(t, msg, "- Reactions to reapply: :+1: x1, :smile: x2")
+		assert.Contains(t, msg, "- Target: private channel `target-channel` in team `target-team`")
+		assert.Contains(t, msg, "This operation would be allowed.")
+	})
+
+	t.Run("blocked", func(t *testing.T) {
+		blockingResponse := getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, "Error: not allowed")
+		preview, err := plugin.buildOperationPreview("copy thread", wpl, targetChannel, blockingResponse)
+		require.NoError(t, err)
+		assert.True(t, preview.Blocked)
+		assert.Equal(t, "Error: not allowed", preview.BlockedReason)
+		assert.Contains(t, preview.markdown(), "This operation would be blocked: Error: not allowed")
+	})
+
+	t.Run("unknown participant", func(t *testing.T) {
+		deletedUserID := model.NewId()
+		api.On("GetUser", deletedUserID).Return(nil, &model.AppError{Message: "not found"})
+		deletedUserReply := &model.Post{
+			Id:       model.NewId(),
+			UserId:   deletedUserID,
+			RootId:   rootPost.Id,
+			CreateAt: 1002,
+		}
+		api.On("GetReactions", deletedUserReply.Id).Return([]*model.Reaction{}, nil)
+
+		preview, err := plugin.buildOperationPreview("move thread", buildWranglerPostListFromPosts([]*model.Post{rootPost, reply, deletedUserReply}), targetChannel, nil)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"user1", "user2", deletedUserID}, preview.Participants)
+		assert.Contains(t, preview.markdown(), "`"+deletedUserID+"`")
+		assert.NotContains(t, preview.markdown(), "@"+deletedUserID)
+	})
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		size     int64
+		expected string
+	}{
+		{size: 0, expected: "0 B"},
+		{size: 1023, expected: "1023 B"},
+		{size: 1024, expected: "1.0 KB"},
+		{size: 1536, expected: "1.5 KB"},
+		{size: 5 * 1024 * 1024, expected: "5.0 MB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			assert.Equal(t, tt.expected, formatBytes(tt.size))
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	quarantineKeyPrefix = "quarantine_"
+
+	// quarantineIndexKey stores the root IDs of every quarantined thread, so
+	// that expired threads can be found without listing every key.
+	quarantineIndexKey = "quarantined_threads"
+
+	operationTypeQuarantine = "quarantine"
+
+	defaultQuarantineRetentionDays = 30
+
+	// quarantinePurgeInterval is how often quarantined threads are checked
+	// for expiry.
+	quarantinePurgeInterval = time.Hour
+)
+
+// quarantinedThread is the stored record of an original thread that was
+// relocated to the quarantine channel by a soft move or merge. The thread is
+// purged once its retention period has passed.
+type quarantinedThread struct {
+	RootID            string `json:"root_id"`
+	OriginalRootID    string `json:"original_root_id"`
+	OriginalChannelID string `json:"original_channel_id"`
+	OperationID       string `json:"operation_id"`
+	UserID            string `json:"user_id"`
+	CreateAt          int64  `json:"create_at"`
+	PurgeAt           int64  `json:"purge_at"`
+}
+
+// quarantine tracks the threads quarantined for an operation so that they can
+// be released again if the operation is rolled back.
+type quarantine struct {
+	channel *model.Channel
+	purgeAt int64
+	// op records the posts created in the quarantine channel.
+	op      *operation
+	rootIDs []string
+}
+
+func quarantineKey(rootID string) string {
+	return quarantineKeyPrefix + rootID
+}
+
+// summary describes where the original threads were quarantined. It is empty
+// if soft-move mode is disabled.
+func (q *quarantine) summary() string {
+	if q == nil {
+		return ""
+	}
+
+	purgeDate := time.Unix(0, q.purgeAt*int64(time.Millisecond)).UTC().Format("2006-01-02")
+
+	return fmt.Sprintf(" The original thread(s) were quarantined in ~%s until %s.", q.channel.Name, purgeDate)
+}
+
+// quarantineThreads relocates the original threads of an operation to the
+// quarantine channel when soft-move mode is enabled, so that they are kept
+// until their retention period has passed once the originals are deleted. It
+// returns nil if soft-move mode is disabled. Any threads quarantined before a
+// failure are released again.
+func (p *Plugin) quarantineThreads(op *operation, wpls ...*WranglerPostList) (*quarantine, error) {
+	config := p.getConfiguration()
+	if !config.SoftMoveEnabled() {
+		return nil, nil
+	}
+
+	channel, appErr := p.API.GetChannel(config.QuarantineChannelID)
+	if appErr != nil {
+		return nil, errors.Wrapf(appErr, "unable to get quarantine channel with ID %s", config.QuarantineChannelID)
+	}
+
+	now := model.GetMillis()
+	retention := time.Duration(config.QuarantineRetentionDaysInt()) * 24 * time.Hour
+	q := &quarantine{
+		channel: channel,
+		purgeAt: now + int64(retention/time.Millisecond),
+		op:      p.startOperation(operationTypeQuarantine, op.UserID),
+	}
+	// The copies are not new messages, so the users they mention are not
+	// notified again.
+	q.op.silent = true
+
+	for _, wpl := range wpls {
+		originalRootPost := wpl.RootPost().Clone()
+
+		rootPost, err := p.copyWranglerPostlist(wpl, channel, q.op)
+		if err != nil {
+			p.releaseQuarantine(q)
+			return nil, errors.Wrapf(err, "unable to quarantine thread %s", originalRootPost.Id)
+		}
+
+		botPost, appErr := p.API.CreatePost(&model.Post{
+			UserId:    p.BotUserID,
+			RootId:    rootPost.Id,
+			ParentId:  rootPost.Id,
+			ChannelId: channel.Id,
+			Message:   fmt.Sprintf("This thread was quarantined by a %s operation (%s) from channel ID %s. It will be purged after %d day(s).", op.Type, inlineCode(op.ID), inlineCode(originalRootPost.ChannelId), config.QuarantineRetentionDaysInt()),
+		})
+		if appErr != nil {
+			p.releaseQuarantine(q)
+			return nil, errors.Wrap(appErr, "unable to create quarantine bot post")
+		}
+		q.op.recordPost(nil, botPost)
+
+		data, err := json.Marshal(&quarantinedThread{
+			RootID:            rootPost.Id,
+			OriginalRootID:    originalRootPost.Id,
+			OriginalChannelID: originalRootPost.ChannelId,
+			OperationID:       op.ID,
+			UserID:            op.UserID,
+			CreateAt:          now,
+			PurgeAt:           q.purgeAt,
+		})
+		if err != nil {
+			p.releaseQuarantine(q)
+			return nil, errors.Wrap(err, "unable to marshal quarantined thread")
+		}
+		q.rootIDs = append(q.rootIDs, rootPost.Id)
+		err = p.addToKVList(quarantineIndexKey, rootPost.Id)
+		if err != nil {
+			p.releaseQuarantine(q)
+			return nil, errors.Wrap(err, "unable to index quarantined thread")
+		}
+		appErr = p.API.KVSet(quarantineKey(rootPost.Id), data)
+		if appErr != nil {
+			p.releaseQuarantine(q)
+			return nil, errors.Wrap(appErr, "unable to save quarantined thread")
+		}
+	}
+	p.finishOperation(q.op)
+	op.quarantined = true
+
+	return q, nil
+}
+
+// quarantineRemainingThreads quarantines the original threads of an
+// interrupted soft move or merge if it stopped before quarantining them.
+// Threads that were already deleted can no longer be quarantined and are
+// skipped.
+func (p *Plugin) quarantineRemainingThreads(op *operation) (*quarantine, error) {
+	if op.quarantined || (op.Type != operationTypeMove && op.Type != operationTypeMerge) {
+		return nil, nil
+	}
+	if !p.getConfiguration().SoftMoveEnabled() {
+		return nil, nil
+	}
+
+	var wpls []*WranglerPostList
+	for _, postID := range op.deletePostIDs {
+		post, appErr := p.API.GetPost(postID)
+		if appErr != nil {
+			if appErr.StatusCode == http.StatusNotFound {
+				continue
+			}
+			return nil, errors.Wrapf(appErr, "unable to get post with ID %s", postID)
+		}
+		if post.DeleteAt != 0 {
+			continue
+		}
+
+		postList, appErr := p.API.GetPostThread(postID)
+		if appErr != nil {
+			return nil, errors.Wrapf(appErr, "unable to get thread of post with ID %s", postID)
+		}
+		wpls = append(wpls, buildWranglerPostList(postList))
+	}
+	if len(wpls) == 0 {
+		return nil, nil
+	}
+
+	return p.quarantineThreads(op, wpls...)
+}
+
+// releaseQuarantine removes the quarantined copies of an operation that is
+// being rolled back, since the original threads are kept. Failures are logged
+// and the remaining copies are left to be purged.
+func (p *Plugin) releaseQuarantine(q *quarantine) {
+	if q == nil {
+		return
+	}
+
+	failedPostIDs := p.rollbackOperation(q.op)
+	p.deleteCheckpoint(q.op)
+	if len(failedPostIDs) != 0 {
+		p.API.LogWarn("Unable to remove quarantined Wrangler posts",
+			"post_ids", strings.Join(failedPostIDs, ","),
+		)
+		return
+	}
+	for _, rootID := range q.rootIDs {
+		appErr := p.API.KVDelete(quarantineKey(rootID))
+		if appErr != nil {
+			p.API.LogWarn("Unable to delete quarantined thread record",
+				"error", appErr.Error(),
+				"root_id", rootID,
+			)
+		}
+	}
+	err := p.removeFromKVList(quarantineIndexKey, q.rootIDs...)
+	if err != nil {
+		p.API.LogWarn("Unable to remove quarantined threads from the index",
+			"error", err.Error(),
+			"root_ids", strings.Join(q.rootIDs, ","),
+		)
+	}
+}
+
+// getQuarantinedThreads returns every quarantined thread.
+func (p *Plugin) getQuarantinedThreads() ([]*quarantinedThread, error) {
+	rootIDs, err := p.getKVList(quarantineIndexKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var threads []*quarantinedThread
+	for _, rootID := range rootIDs {
+		data, appErr := p.API.KVGet(quarantineKey(rootID))
+		if appErr != nil {
+			return nil, errors.Wrapf(appErr, "unable to get quarantined thread %s", rootID)
+		}
+		if data == nil {
+			continue
+		}
+
+		var thread quarantinedThread
+		err = json.Unmarshal(data, &thread)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to unmarshal quarantined thread %s", rootID)
+		}
+		threads = append(threads, &thread)
+	}
+
+	return threads, nil
+}
+
+// purgeQuarantinedThreads deletes every quarantined thread whose retention
+// period has passed and returns how many were purged. Threads that fail to
+// purge are logged and retried on the next run.
+func (p *Plugin) purgeQuarantinedThreads(now time.Time) int {
+	threads, err := p.getQuarantinedThreads()
+	if err != nil {
+		p.API.LogError("Unable to look up quarantined Wrangler threads", "error", err.Error())
+		return 0
+	}
+
+	var purgedRootIDs []string
+	for _, thread := range threads {
+		if thread.PurgeAt > now.UnixNano()/int64(time.Millisecond) {
+			continue
+		}
+
+		// Deleting the root post deletes its replies along with it.
+		_, err = p.deletePostIfExists(thread.RootID)
+		if err != nil {
+			p.API.LogError("Unable to purge quarantined Wrangler thread",
+				"error", err.Error(),
+				"root_id", thread.RootID,
+			)
+			continue
+		}
+		appErr := p.API.KVDelete(quarantineKey(thread.RootID))
+		if appErr != nil {
+			p.API.LogError("Unable to delete quarantined thread record",
+				"error", appErr.Error(),
+				"root_id", thread.RootID,
+			)
+			continue
+		}
+		purgedRootIDs = append(purgedRootIDs, thread.RootID)
+	}
+	if len(purgedRootIDs) == 0 {
+		return 0
+	}
+
+	err = p.removeFromKVList(quarantineIndexKey, purgedRootIDs...)
+	if err != nil {
+		p.API.LogError("Unable to remove purged threads from the quarantine index",
+			"error", err.Error(),
+			"root_ids", strings.Join(purgedRootIDs, ","),
+		)
+	}
+	p.API.LogInfo("Wrangler purged expired quarantined threads", "count", fmt.Sprintf("%d", len(purgedRootIDs)))
+
+	return len(purgedRootIDs)
+}
+
+// runQuarantinePurge purges expired quarantined threads right away and then
+// once every purge interval until the stop channel is closed.
+func (p *Plugin) runQuarantinePurge(stop <-chan struct{}) {
+	ticker := time.NewTicker(quarantinePurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		p.purgeQuarantinedThreads(time.Now())
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuarantineThreads(t *testing.T) {
+	originalChannel := &model.Channel{
+		Id:   model.NewId(),
+		Name: "original-channel",
+	}
+	quarantineChannel := &model.Channel{
+		Id:   model.NewId(),
+		Name: "quarantine-channel",
+	}
+
+	posts := newMockPostStore()
+	api := &plugintest.API{}
+	kv := newMockKVStore(api)
+	api.On("GetChannel", quarantineChannel.Id).Return(quarantineChannel, nil)
+	api.On("GetReactions", mock.AnythingOfType("string")).Return([]*model.Reaction{}, nil)
+	api.On("CreatePost", mock.Anything).Return(posts.createPost, nil)
+	api.On("UpdatePost", mock.Anything).Return(posts.updatePost, nil)
+	api.On("DeletePost", mock.AnythingOfType("string")).Return(nil)
+
+	var plugin Plugin
+	plugin.SetAPI(api)
+
+	t.Run("soft-move disabled", func(t *testing.T) {
+		plugin.setConfiguration(&configuration{})
+
+		op := newOperation(operationTypeMove, model.NewId())
+		wpl := buildWranglerPostList(mockGeneratePostList(3, originalChannel.Id, false))
+
+		q, err := plugin.quarantineThreads(op, wpl)
+		require.NoError(t, err)
+		assert.Nil(t, q)
+		assert.Equal(t, "", q.summary())
+		assert.Empty(t, kv.keys())
+	})
+
+	t.Run("soft-move enabled", func(t *testing.T) {
+		plugin.setConfiguration(&configuration{
+			QuarantineChannelID:     quarantineChannel.Id,
+			QuarantineRetentionDays: "7",
+		})
+
+		op := newOperation(operationTypeMove, model.NewId())
+		wpl := buildWranglerPostList(mockGeneratePostList(3, originalChannel.Id, false))
+
+		q, err := plugin.quarantineThreads(op, wpl)
+		require.NoError(t, err)
+		require.NotNil(t, q)
+		require.Len(t, q.rootIDs, 1)
+
+		// The thread is copied along with a bot post noting where it came from.
+		thread := posts.getPostThread(q.rootIDs[0])
+		require.Len(t, thread.Order, 4)
+		for _, post := range thread.Posts {
+			assert.Equal(t, quarantineChannel.Id, post.ChannelId)
+			assert.NotEqual(t, silentPostPlaceholder, post.Message)
+		}
+		api.AssertCalled(t, "UpdatePost", mock.Anything)
+		assert.True(t, op.quarantined)
+		assert.Empty(t, kv.checkpointKeys())
+
+		data := kv.data[quarantineKey(q.rootIDs[0])]
+		require.NotNil(t, data)
+		var record quarantinedThread
+		require.NoError(t, json.Unmarshal(data, &record))
+		assert.Equal(t, wpl.RootPost().Id, record.OriginalRootID)
+		assert.Equal(t, originalChannel.Id, record.OriginalChannelID)
+		assert.Equal(t, op.ID, record.OperationID)
+		assert.Equal(t, int64(7*24*time.Hour/time.Millisecond), record.PurgeAt-record.CreateAt)
+		assert.Contains(t, q.summary(), "quarantined in ~quarantine-channel until")
+
+		threads, err := plugin.getQuarantinedThreads()
+		require.NoError(t, err)
+		require.Len(t, threads, 1)
+		assert.Equal(t, q.rootIDs[0], threads[0].RootID)
+
+		t.Run("release", func(t *testing.T) {
+			plugin.releaseQuarantine(q)
+
+			assert.Nil(t, kv.data[quarantineKey(q.rootIDs[0])])
+			assert.Nil(t, kv.data[quarantineIndexKey])
+			api.AssertNumberOfCalls(t, "DeletePost", 4)
+		})
+	})
+
+	t.Run("missing quarantine channel", func(t *testing.T) {
+		missingChannelID := model.NewId()
+		api.On("GetChannel", missingChannelID).Return(nil, &model.AppError{Message: "not found"})
+		plugin.setConfiguration(&configuration{QuarantineChannelID: missingChannelID})
+
+		op := newOperation(operationTypeMove, model.NewId())
+		wpl := buildWranglerPostList(mockGeneratePostList(3, originalChannel.Id, false))
+
+		q, err := plugin.quarantineThreads(op, wpl)
+		require.Error(t, err)
+		assert.Nil(t, q)
+		assert.Contains(t, err.Error(), "unable to get quarantine channel")
+	})
+}
+
+func TestPurgeQuarantinedThreads(t *testing.T) {
+	api := &plugintest.API{}
+	kv := newMockKVStore(api)
+	api.On("GetPost", mock.AnythingOfType("string")).Return(mockGeneratePost(), nil)
+	api.On("DeletePost", mock.AnythingOfType("string")).Return(nil)
+	api.On("LogInfo",
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+	).Return(nil)
+
+	var plugin Plugin
+	plugin.SetAPI(api)
+
+	now := time.Now()
+	expired := &quarantinedThread{
+		RootID:  model.NewId(),
+		PurgeAt: now.Add(-time.Hour).UnixNano() / int64(time.Millisecond),
+	}
+	retained := &quarantinedThread{
+		RootID:  model.NewId(),
+		PurgeAt: now.Add(time.Hour).UnixNano() / int64(time.Millisecond),
+	}
+	for _, thread := range []*quarantinedThread{expired, retained} {
+		data, err := json.Marshal(thread)
+		require.NoError(t, err)
+		kv.data[quarantineKey(thread.RootID)] = data
+		require.NoError(t, plugin.addToKVList(quarantineIndexKey, thread.RootID))
+	}
+
+	assert.Equal(t, 1, plugin.purgeQuarantinedThreads(now))
+	api.AssertCalled(t, "DeletePost", expired.RootID)
+	api.AssertNotCalled(t, "DeletePost", retained.RootID)
+	assert.ElementsMatch(t, []string{quarantineKey(retained.RootID), quarantineIndexKey}, kv.keys())
+	rootIDs, err := plugin.getKVList(quarantineIndexKey)
+	require.NoError(t, err)
+	assert.Equal(t, []string{retained.RootID}, rootIDs)
+
+	assert.Equal(t, 0, plugin.purgeQuarantinedThreads(now))
+}
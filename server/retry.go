@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	// retryBaseDelay is the delay before the first retry of a failed
+	// request. Each following retry waits twice as long, up to retryMaxDelay.
+	retryBaseDelay  = 200 * time.Millisecond
+	retryMaxDelay   = 5 * time.Second
+	retryMaxRetries = 3
+)
+
+// retryError is returned when a request to the Mattermost server failed
+// either with a permanent error or too many times in a row.
+type retryError struct {
+	action    string
+	attempts  int
+	permanent bool
+	appErr    *model.AppError
+}
+
+func (e *retryError) Error() string {
+	if e.permanent {
+		return fmt.Sprintf("failed to %s: %s", e.action, e.appErr.Error())
+	}
+
+	return fmt.Sprintf("failed to %s after %d attempts: %s", e.action, e.attempts, e.appErr.Error())
+}
+
+// isPermanentAppError returns whether an error will happen again no matter
+// how often the request is retried, such as missing permissions, a channel
+// that doesn't exist or a message that is too long.
+func isPermanentAppError(appErr *model.AppError) bool {
+	switch appErr.StatusCode {
+	case http.StatusBadRequest,
+		http.StatusUnauthorized,
+		http.StatusForbidden,
+		http.StatusNotFound,
+		http.StatusRequestEntityTooLarge,
+		http.StatusNotImplemented:
+		return true
+	}
+
+	return false
+}
+
+// retryDelay returns how long to wait before the given retry, counting from
+// zero. The delay grows exponentially and is jittered so that requests that
+// failed together don't all retry at the same time.
+func retryDelay(baseDelay time.Duration, retry int) time.Duration {
+	delay := retryMaxDelay
+	if retry < 16 && baseDelay<<uint(retry) < retryMaxDelay {
+		delay = baseDelay << uint(retry)
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// withRetries runs a request to the Mattermost server until it succeeds.
+// Permanent errors are returned right away while other errors are retried up
+// to maxRetries times with exponential backoff.
+func (p *Plugin) withRetries(action string, baseDelay time.Duration, maxRetries int, request func() *model.AppError) error {
+	for attempt := 1; ; attempt++ {
+		appErr := request()
+		if appErr == nil {
+			return nil
+		}
+		if isPermanentAppError(appErr) {
+			return &retryError{action: action, attempts: attempt, permanent: true, appErr: appErr}
+		}
+		if attempt > maxRetries {
+			return &retryError{action: action, attempts: attempt, appErr: appErr}
+		}
+
+		p.metrics.observeRetry(action)
+		p.API.LogWarn(fmt.Sprintf("Failed to %s; retrying", action), "err", appErr)
+		time.Sleep(retryDelay(baseDelay, attempt-1))
+	}
+}
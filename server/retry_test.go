@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsPermanentAppError(t *testing.T) {
+	for _, statusCode := range []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusRequestEntityTooLarge} {
+		assert.True(t, isPermanentAppError(&model.AppError{StatusCode: statusCode}), statusCode)
+	}
+	for _, statusCode := range []int{0, http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusServiceUnavailable} {
+		assert.False(t, isPermanentAppError(&model.AppError{StatusCode: statusCode}), statusCode)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for retry := 0; retry < 100; retry++ {
+		delay := retryDelay(retryBaseDelay, retry)
+		maxDelay := retryMaxDelay
+		if retry < 5 {
+			// 200ms doubled five times is past the maximum delay.
+			maxDelay = retryBaseDelay << uint(retry)
+		}
+		assert.GreaterOrEqual(t, int64(delay), int64(maxDelay/2))
+		assert.LessOrEqual(t, int64(delay), int64(maxDelay))
+	}
+}
+
+func TestCreatePostWithRetries(t *testing.T) {
+	setup := func(errs ...*model.AppError) (*Plugin, *plugintest.API) {
+		var attempts int
+		api := &plugintest.API{}
+		api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(
+			func(post *model.Post) *model.Post {
+				if attempts < len(errs) && errs[attempts] != nil {
+					return nil
+				}
+				return mockGeneratePost()
+			},
+			func(post *model.Post) *model.AppError {
+				attempts++
+				if attempts <= len(errs) {
+					return errs[attempts-1]
+				}
+				return nil
+			},
+		)
+		api.On("LogWarn", mock.AnythingOfTypeArgument("string"), mock.AnythingOfTypeArgument("string"), mock.Anything).Return(nil)
+
+		var plugin Plugin
+		plugin.SetAPI(api)
+
+		return &plugin, api
+	}
+
+	countCalls := func(api *plugintest.API) int {
+		var count int
+		for _, call := range api.Calls {
+			if call.Method == "CreatePost" {
+				count++
+			}
+		}
+		return count
+	}
+
+	t.Run("transient error is retried", func(t *testing.T) {
+		plugin, api := setup(&model.AppError{StatusCode: http.StatusServiceUnavailable, Message: "unavailable"})
+		newPost, err := plugin.createPostWithRetries(&model.Post{}, time.Millisecond, 3)
+		require.NoError(t, err)
+		assert.NotNil(t, newPost)
+		assert.Equal(t, 2, countCalls(api))
+	})
+
+	t.Run("permanent error fails fast", func(t *testing.T) {
+		plugin, api := setup(&model.AppError{StatusCode: http.StatusForbidden, Message: "forbidden"})
+		_, err := plugin.createPostWithRetries(&model.Post{}, time.Millisecond, 3)
+		require.Error(t, err)
+		assert.Equal(t, "failed to create post: : forbidden, ", err.Error())
+		assert.Equal(t, 1, countCalls(api))
+	})
+
+	t.Run("too many transient errors", func(t *testing.T) {
+		appErr := &model.AppError{StatusCode: http.StatusInternalServerError, Message: "failed"}
+		plugin, api := setup(appErr, appErr, appErr, appErr)
+		_, err := plugin.createPostWithRetries(&model.Post{}, time.Millisecond, 3)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to create post after 4 attempts")
+		assert.Equal(t, 4, countCalls(api))
+	})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+// rollbackOperation deletes every post created by an operation, newest first,
+// so that the original messages are the only copy left. Files attached to the
+// deleted posts are removed along with them. The IDs of any posts that could
+// not be deleted are returned.
+func (p *Plugin) rollbackOperation(op *operation) []string {
+	var failedPostIDs []string
+	for i := len(op.Posts) - 1; i >= 0; i-- {
+		appErr := p.API.DeletePost(op.Posts[i].NewID)
+		if appErr != nil {
+			failedPostIDs = append(failedPostIDs, op.Posts[i].NewID)
+		}
+	}
+
+	return failedPostIDs
+}
+
+// rollbackResponse rolls back an operation that failed partway through and
+// returns a command response reporting whether the rollback succeeded. It
+// must only be used before any original messages have been deleted.
+func (p *Plugin) rollbackResponse(op *operation, err error) (*model.CommandResponse, bool, error) {
+	p.API.LogError("Wrangler operation failed; rolling back",
+		"error", err.Error(),
+		"operation_id", op.ID,
+		"operation_type", op.Type,
+	)
+
+	failedPostIDs := p.rollbackOperation(op)
+	op.rolledBack = true
+	op.deletePostIDs = nil
+
+	msg := "Error: the operation failed partway through"
+	if errors.Cause(err) == errJobCanceled {
+		msg = "The operation was canceled"
+	}
+	if errors.Cause(err) == errThreadLockLost {
+		msg = "Error: the lock on the threads was lost, so the operation stopped partway through"
+	}
+	if verificationErr, ok := errors.Cause(err).(*verificationError); ok {
+		msg = fmt.Sprintf("Error: %s", verificationErr.Error())
+	}
+	if _, ok := errors.Cause(err).(*retryError); ok {
+		// Requests that failed are named so that the user knows which
+		// messages could not be wrangled and why.
+		msg += fmt.Sprintf(" (%s)", err.Error())
+	}
+	if len(failedPostIDs) == 0 {
+		p.API.LogInfo("Wrangler operation rolled back",
+			"operation_id", op.ID,
+			"operation_type", op.Type,
+		)
+		msg += fmt.Sprintf(" and has been rolled back; %d created message(s) were removed and the original messages are unchanged.", len(op.Posts))
+		p.recordAudit(op, auditOutcomeRolledBack, err)
+		p.deleteCheckpoint(op)
+	} else {
+		p.API.LogError("Wrangler operation rollback incomplete",
+			"operation_id", op.ID,
+			"post_ids", strings.Join(failedPostIDs, ","),
+		)
+		msg += fmt.Sprintf(" and the rollback did not complete; %d created message(s) could not be removed: %s. The original messages are unchanged.", len(failedPostIDs), strings.Join(failedPostIDs, ", "))
+
+		// The checkpoint is kept so that an administrator can finish the
+		// rollback with the jobs resume command.
+		p.recordAudit(op, auditOutcomeFailed, err)
+		op.checkpointError = err.Error()
+		op.checkpoint(true)
+	}
+
+	// The plugin API has no way to delete files directly, so re-uploaded files
+	// that never made it onto a post can only be reported.
+	if len(op.pendingFileIDs) != 0 {
+		p.API.LogWarn("Wrangler was unable to remove re-uploaded files",
+			"operation_id", op.ID,
+			"file_ids", strings.Join(op.pendingFileIDs, ","),
+		)
+		msg += fmt.Sprintf(" %d re-uploaded file(s) that were never attached to a message could not be removed.", len(op.pendingFileIDs))
+	}
+
+	return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, msg+" Please talk to your administrator for help."), false, nil
+}
+
+// partialDeleteResponse reports an operation that failed after some of the
+// original messages were deleted. It can no longer be rolled back, so its
+// checkpoint is kept for an administrator to finish it with the jobs resume
+// command.
+func (p *Plugin) partialDeleteResponse(op *operation, err error) (*model.CommandResponse, bool, error) {
+	p.API.LogError("Wrangler operation failed while deleting the original messages",
+		"error", err.Error(),
+		"operation_id", op.ID,
+		"operation_type", op.Type,
+	)
+
+	p.recordAudit(op, auditOutcomeFailed, err)
+	op.checkpointError = err.Error()
+	op.checkpoint(true)
+
+	msg := fmt.Sprintf("Error: the operation failed while deleting the original messages and is only partially finished; some of the original messages were not removed. A system administrator can finish it with `/wrangler jobs resume %s`.", op.ID)
+
+	return getCommandResponse(model.COMMAND_RESPONSE_TYPE_EPHEMERAL, msg), false, nil
+}
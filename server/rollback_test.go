@@ -0,0 +1,143 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollbackResponse(t *testing.T) {
+	createdRoot := mockGeneratePost()
+	createdReply := mockGeneratePost()
+	undeletablePost := mockGeneratePost()
+
+	api := &plugintest.API{}
+	api.On("DeletePost", undeletablePost.Id).Return(&model.AppError{})
+	api.On("DeletePost", mock.AnythingOfType("string")).Return(nil)
+	api.On("LogError",
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+	).Return(nil)
+	api.On("LogError",
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+	).Return(nil)
+	api.On("LogInfo",
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+	).Return(nil)
+	api.On("LogWarn",
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+	).Return(nil)
+
+	var plugin Plugin
+	plugin.SetAPI(api)
+
+	t.Run("rolled back", func(t *testing.T) {
+		op := newOperation(operationTypeMove, model.NewId())
+		op.recordPost(mockGeneratePost(), createdRoot)
+		op.recordPost(mockGeneratePost(), createdReply)
+
+		callCount := len(api.Calls)
+		resp, isUserError, err := plugin.rollbackResponse(op, errors.New("unable to create new post"))
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "has been rolled back; 2 created message(s) were removed")
+		assert.NotContains(t, resp.Text, "re-uploaded file(s)")
+
+		var deleted []string
+		for _, call := range api.Calls[callCount:] {
+			if call.Method == "DeletePost" {
+				deleted = append(deleted, call.Arguments.String(0))
+			}
+		}
+		assert.Equal(t, []string{createdReply.Id, createdRoot.Id}, deleted)
+	})
+
+	t.Run("rollback incomplete", func(t *testing.T) {
+		op := newOperation(operationTypeMove, model.NewId())
+		op.recordPost(mockGeneratePost(), createdRoot)
+		op.recordPost(mockGeneratePost(), undeletablePost)
+
+		resp, isUserError, err := plugin.rollbackResponse(op, errors.New("unable to create new post"))
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "the rollback did not complete; 1 created message(s) could not be removed: "+undeletablePost.Id)
+	})
+
+	t.Run("orphaned files", func(t *testing.T) {
+		op := newOperation(operationTypeMove, model.NewId())
+		op.recordUploadedFiles([]string{model.NewId(), model.NewId()})
+
+		resp, isUserError, err := plugin.rollbackResponse(op, errors.New("unable to re-upload file"))
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "has been rolled back")
+		assert.Contains(t, resp.Text, "2 re-uploaded file(s) that were never attached to a message could not be removed")
+	})
+}
+
+func TestPartialDeleteResponse(t *testing.T) {
+	api := &plugintest.API{}
+	newMockKVStore(api)
+	api.On("LogError",
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+	).Return(nil)
+
+	var plugin Plugin
+	plugin.SetAPI(api)
+
+	channel := &model.Channel{Id: model.NewId(), TeamId: model.NewId()}
+	originalPosts := []*model.Post{mockGeneratePost(), mockGeneratePost()}
+
+	op := plugin.startOperation(operationTypeSplit, model.NewId())
+	op.startAudit([]*model.Channel{channel}, channel, originalPosts, "", nil)
+	op.recordPost(originalPosts[0], mockGeneratePost())
+	op.recordPost(originalPosts[1], mockGeneratePost())
+	op.beginDeletes(getPostIDs(originalPosts)...)
+
+	resp, isUserError, err := plugin.partialDeleteResponse(op, errors.New("unable to delete post"))
+	require.NoError(t, err)
+	assert.False(t, isUserError)
+	assert.Contains(t, resp.Text, "is only partially finished")
+	assert.Contains(t, resp.Text, "/wrangler jobs resume "+op.ID)
+	api.AssertNotCalled(t, "DeletePost", mock.Anything)
+
+	cp, err := plugin.getCheckpoint(op.ID)
+	require.NoError(t, err)
+	require.NotNil(t, cp)
+	assert.Equal(t, "unable to delete post", cp.Error)
+	assert.Equal(t, getPostIDs(originalPosts), cp.DeletePostIDs)
+
+	entries, err := plugin.getAuditEntries(auditFilter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, auditOutcomeFailed, entries[0].Outcome)
+	assert.Equal(t, "unable to delete post", entries[0].Error)
+}
@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
 )
 
 func makePostLink(siteURL, teamName, postID string) string {
@@ -90,6 +93,39 @@ func inlineCode(in string) string {
 	return fmt.Sprintf("`%s`", in)
 }
 
+func getPostIDs(posts []*model.Post) []string {
+	postIDs := make([]string, 0, len(posts))
+	for _, post := range posts {
+		postIDs = append(postIDs, post.Id)
+	}
+
+	return postIDs
+}
+
+// parseTimeFlag parses a time flag value into a timestamp in milliseconds. The
+// value can be a duration before the given time, such as "30m", "2h" or "7d",
+// or an RFC3339 timestamp.
+func parseTimeFlag(value string, now time.Time) (int64, error) {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err == nil {
+			return model.GetMillisForTime(now.AddDate(0, 0, -days)), nil
+		}
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err == nil {
+		return model.GetMillisForTime(now.Add(-duration)), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, errors.Errorf("time value %s must be a duration such as 30m, 2h or 7d or an RFC3339 timestamp", value)
+	}
+
+	return model.GetMillisForTime(t), nil
+}
+
 // NewBool returns a pointer to a given bool.
 func NewBool(b bool) *bool { return &b }
 
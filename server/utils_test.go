@@ -2,8 +2,11 @@ package main
 
 import (
 	"testing"
+	"time"
 
+	"github.com/mattermost/mattermost-server/v5/model"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMakeBotDM(t *testing.T) {
@@ -72,3 +75,57 @@ func TestMakeBotDM(t *testing.T) {
 		})
 	}
 }
+
+func TestParseTimeFlag(t *testing.T) {
+	now := time.Date(2021, time.March, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Time
+		err      bool
+	}{
+		{
+			name:     "minutes",
+			value:    "30m",
+			expected: now.Add(-30 * time.Minute),
+		},
+		{
+			name:     "hours",
+			value:    "2h",
+			expected: now.Add(-2 * time.Hour),
+		},
+		{
+			name:     "days",
+			value:    "7d",
+			expected: now.AddDate(0, 0, -7),
+		},
+		{
+			name:     "timestamp",
+			value:    "2021-03-01T08:30:00Z",
+			expected: time.Date(2021, time.March, 1, 8, 30, 0, 0, time.UTC),
+		},
+		{
+			name:  "invalid",
+			value: "yesterday",
+			err:   true,
+		},
+		{
+			name:  "invalid days",
+			value: "xd",
+			err:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			millis, err := parseTimeFlag(tt.value, now)
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, model.GetMillisForTime(tt.expected), millis)
+		})
+	}
+}
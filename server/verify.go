@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+// verification is the result of checking that the posts created by an
+// operation are complete copies of the original posts.
+type verification struct {
+	posts     int
+	files     int
+	reactions int
+	problems  []string
+}
+
+func (v *verification) ok() bool {
+	return len(v.problems) == 0
+}
+
+// summary returns a sentence describing a successful verification for command
+// responses.
+func (v *verification) summary() string {
+	return fmt.Sprintf("Verified %d message(s), %d file(s) and %d reaction(s) before removing the originals.", v.posts, v.files, v.reactions)
+}
+
+func (v *verification) error() error {
+	if v.ok() {
+		return nil
+	}
+
+	return &verificationError{problems: v.problems}
+}
+
+// verificationError is returned when the posts created by an operation are
+// not complete copies of the original posts.
+type verificationError struct {
+	problems []string
+}
+
+func (e *verificationError) Error() string {
+	return fmt.Sprintf("verification of the new messages failed (%s)", strings.Join(e.problems, "; "))
+}
+
+// verifyCopiedPosts refetches the thread with the given root ID and checks
+// that every original post was recreated in it by the operation with the same
+// message, the same number of files and the same number of reactions. This is
+// done before the original posts are deleted so that a copy that is silently
+// incomplete never results in lost messages.
+func (p *Plugin) verifyCopiedPosts(originalPosts []*model.Post, threadRootID string, op *operation) (*verification, error) {
+	postList, appErr := p.API.GetPostThread(threadRootID)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "unable to get new thread to verify it")
+	}
+
+	newPostIDs := make(map[string]string)
+	for _, opPost := range op.Posts {
+		if len(opPost.OriginalID) != 0 {
+			newPostIDs[opPost.OriginalID] = opPost.NewID
+		}
+	}
+
+	v := &verification{}
+	for _, originalPost := range originalPosts {
+		newPostID, ok := newPostIDs[originalPost.Id]
+		if !ok {
+			v.problems = append(v.problems, fmt.Sprintf("message %s was not recreated", originalPost.Id))
+			continue
+		}
+		newPost, ok := postList.Posts[newPostID]
+		if !ok || newPost.DeleteAt != 0 {
+			v.problems = append(v.problems, fmt.Sprintf("the copy of message %s is missing from the new thread", originalPost.Id))
+			continue
+		}
+		v.posts++
+
+		if newPost.Message != originalPost.Message {
+			v.problems = append(v.problems, fmt.Sprintf("the copy of message %s has a different message", originalPost.Id))
+		}
+		if len(newPost.FileIds) != len(originalPost.FileIds) {
+			v.problems = append(v.problems, fmt.Sprintf("the copy of message %s has %d of %d file(s)", originalPost.Id, len(newPost.FileIds), len(originalPost.FileIds)))
+		}
+		v.files += len(newPost.FileIds)
+
+		originalReactions, appErr := p.API.GetReactions(originalPost.Id)
+		if appErr != nil {
+			return nil, errors.Wrap(appErr, "unable to get original reactions to verify them")
+		}
+		newReactions, appErr := p.API.GetReactions(newPostID)
+		if appErr != nil {
+			return nil, errors.Wrap(appErr, "unable to get new reactions to verify them")
+		}
+		if len(newReactions) != len(originalReactions) {
+			v.problems = append(v.problems, fmt.Sprintf("the copy of message %s has %d of %d reaction(s)", originalPost.Id, len(newReactions), len(originalReactions)))
+		}
+		v.reactions += len(newReactions)
+	}
+
+	if v.ok() {
+		p.API.LogInfo("Wrangler verified the new messages",
+			"operation_id", op.ID,
+			"message_count", fmt.Sprintf("%d", v.posts),
+			"file_count", fmt.Sprintf("%d", v.files),
+			"reaction_count", fmt.Sprintf("%d", v.reactions),
+		)
+	} else {
+		p.API.LogError("Wrangler verification of the new messages failed",
+			"operation_id", op.ID,
+			"problems", strings.Join(v.problems, "; "),
+		)
+	}
+
+	return v, nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// mockPostStore keeps the posts created through a mock API so that the
+// threads they were created in can be fetched again.
+type mockPostStore struct {
+	lock    sync.Mutex
+	threads map[string]*model.PostList
+	created []*model.Post
+}
+
+func newMockPostStore() *mockPostStore {
+	return &mockPostStore{threads: make(map[string]*model.PostList)}
+}
+
+// addThread returns the given post list for the thread with the given root
+// ID, along with any posts created in that thread.
+func (s *mockPostStore) addThread(rootID string, postList *model.PostList) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.threads[rootID] = postList
+}
+
+func (s *mockPostStore) createPost(post *model.Post) *model.Post {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	newPost := post.Clone()
+	newPost.Id = model.NewId()
+	if newPost.CreateAt == 0 {
+		newPost.CreateAt = model.GetMillis()
+	}
+	s.created = append(s.created, newPost)
+
+	return newPost
+}
+
+// updatePost replaces a created post with the given post.
+func (s *mockPostStore) updatePost(post *model.Post) *model.Post {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	updatedPost := post.Clone()
+	for i, created := range s.created {
+		if created.Id == post.Id {
+			s.created[i] = updatedPost
+		}
+	}
+
+	return updatedPost
+}
+
+func (s *mockPostStore) getPostThread(rootID string) *model.PostList {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	postList := model.NewPostList()
+	if thread, ok := s.threads[rootID]; ok {
+		for _, postID := range thread.Order {
+			postList.AddPost(thread.Posts[postID])
+			postList.AddOrder(postID)
+		}
+	}
+	for _, post := range s.created {
+		if post.Id == rootID || post.RootId == rootID {
+			postList.AddPost(post)
+			postList.AddOrder(post.Id)
+		}
+	}
+
+	return postList
+}
+
+func TestVerifyCopiedPosts(t *testing.T) {
+	posts := newMockPostStore()
+	reactions := map[string][]*model.Reaction{}
+
+	api := &plugintest.API{}
+	api.On("GetPostThread", mock.AnythingOfType("string")).Return(posts.getPostThread, nil)
+	api.On("GetReactions", mock.AnythingOfType("string")).Return(func(postID string) []*model.Reaction {
+		return reactions[postID]
+	}, nil)
+	api.On("LogInfo",
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+	).Return(nil)
+	api.On("LogError",
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+		mock.AnythingOfTypeArgument("string"),
+	).Return(nil)
+
+	var plugin Plugin
+	plugin.SetAPI(api)
+
+	// copyThread records copies of the given posts as a new thread and
+	// returns the root ID of the new thread.
+	copyThread := func(op *operation, originalPosts []*model.Post) string {
+		var rootID string
+		for _, originalPost := range originalPosts {
+			newPost := originalPost.Clone()
+			newPost.RootId = rootID
+			newPost = posts.createPost(newPost)
+			if len(rootID) == 0 {
+				rootID = newPost.Id
+			}
+			reactions[newPost.Id] = reactions[originalPost.Id]
+			op.recordPost(originalPost, newPost)
+		}
+		return rootID
+	}
+
+	originalPosts := []*model.Post{
+		{Id: model.NewId(), Message: "root", FileIds: []string{"file1"}},
+		{Id: model.NewId(), Message: "reply"},
+	}
+	reactions[originalPosts[1].Id] = []*model.Reaction{{EmojiName: "smile"}, {EmojiName: "tada"}}
+
+	t.Run("complete", func(t *testing.T) {
+		op := newOperation(operationTypeMove, model.NewId())
+		rootID := copyThread(op, originalPosts)
+
+		v, err := plugin.verifyCopiedPosts(originalPosts, rootID, op)
+		require.NoError(t, err)
+		require.True(t, v.ok())
+		require.NoError(t, v.error())
+		assert.Equal(t, "Verified 2 message(s), 1 file(s) and 2 reaction(s) before removing the originals.", v.summary())
+	})
+
+	t.Run("missing post", func(t *testing.T) {
+		op := newOperation(operationTypeMove, model.NewId())
+		rootID := copyThread(op, originalPosts[:1])
+
+		v, err := plugin.verifyCopiedPosts(originalPosts, rootID, op)
+		require.NoError(t, err)
+		assert.False(t, v.ok())
+		require.Error(t, v.error())
+		assert.Contains(t, v.error().Error(), "message "+originalPosts[1].Id+" was not recreated")
+	})
+
+	t.Run("missing reaction", func(t *testing.T) {
+		op := newOperation(operationTypeMove, model.NewId())
+		rootID := copyThread(op, originalPosts)
+		reactions[op.Posts[1].NewID] = reactions[originalPosts[1].Id][:1]
+
+		v, err := plugin.verifyCopiedPosts(originalPosts, rootID, op)
+		require.NoError(t, err)
+		assert.False(t, v.ok())
+		assert.Contains(t, v.error().Error(), "has 1 of 2 reaction(s)")
+	})
+
+	t.Run("different contents", func(t *testing.T) {
+		op := newOperation(operationTypeMove, model.NewId())
+		changedPosts := []*model.Post{originalPosts[0].Clone(), originalPosts[1].Clone()}
+		changedPosts[1].Message = "changed"
+		changedPosts[0].FileIds = nil
+		rootID := copyThread(op, changedPosts)
+		for i := range op.Posts {
+			op.Posts[i].OriginalID = originalPosts[i].Id
+		}
+
+		v, err := plugin.verifyCopiedPosts(originalPosts, rootID, op)
+		require.NoError(t, err)
+		assert.False(t, v.ok())
+		assert.Contains(t, v.error().Error(), "has 0 of 1 file(s)")
+		assert.Contains(t, v.error().Error(), "has a different message")
+	})
+}
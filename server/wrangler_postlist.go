@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
 )
 
 // WranglerPostList provides a list of posts along with metadata about those
@@ -34,12 +35,26 @@ func (wpl *WranglerPostList) ContainsFileAttachments() bool {
 }
 
 func buildWranglerPostList(postList *model.PostList) *WranglerPostList {
-	wpl := &WranglerPostList{}
-
 	postList.UniqueOrder()
 	postList.SortByCreateAt()
 	posts := postList.ToSlice()
 
+	// The post list is sorted newest first, so reverse it to match the order
+	// the posts were originally created in.
+	var sortedPosts []*model.Post
+	for i := range posts {
+		sortedPosts = append(sortedPosts, posts[len(posts)-i-1])
+	}
+
+	return buildWranglerPostListFromPosts(sortedPosts)
+}
+
+// buildWranglerPostListFromPosts builds a WranglerPostList from posts that are
+// already sorted from oldest to newest. The first post is treated as the root
+// post of the list.
+func buildWranglerPostListFromPosts(posts []*model.Post) *WranglerPostList {
+	wpl := &WranglerPostList{}
+
 	if len(posts) == 0 {
 		// Something was sorted wrong or an empty PostList was provided.
 		return wpl
@@ -48,9 +63,7 @@ func buildWranglerPostList(postList *model.PostList) *WranglerPostList {
 	// A separate ID key map to ensure no duplicates.
 	idKeys := make(map[string]bool)
 
-	for i := range posts {
-		p := posts[len(posts)-i-1]
-
+	for _, p := range posts {
 		// Add UserID to metadata if it's new.
 		if _, ok := idKeys[p.UserId]; !ok {
 			idKeys[p.UserId] = true
@@ -68,3 +81,82 @@ func buildWranglerPostList(postList *model.PostList) *WranglerPostList {
 
 	return wpl
 }
+
+// Clone returns a copy of the post list with copies of its posts, so that
+// changes to the posts of one list don't affect the other.
+func (wpl *WranglerPostList) Clone() *WranglerPostList {
+	var posts []*model.Post
+	for _, post := range wpl.Posts {
+		posts = append(posts, post.Clone())
+	}
+
+	return buildWranglerPostListFromPosts(posts)
+}
+
+// SplitAt returns a new post list containing the post with the given ID and
+// every post that comes after it. The post with the given ID becomes the root
+// post of the new list.
+func (wpl *WranglerPostList) SplitAt(postID string) (*WranglerPostList, error) {
+	for i, post := range wpl.Posts {
+		if post.Id == postID {
+			return buildWranglerPostListFromPosts(wpl.Posts[i:]), nil
+		}
+	}
+
+	return nil, errors.Errorf("post with ID %s is not in the post list", postID)
+}
+
+// Select returns a new post list containing only the posts with the given IDs.
+// The posts are kept in their original order and the first selected post
+// becomes the root post of the new list.
+func (wpl *WranglerPostList) Select(postIDs []string) (*WranglerPostList, error) {
+	selected := make(map[string]bool)
+	for _, postID := range postIDs {
+		selected[postID] = false
+	}
+
+	var posts []*model.Post
+	for _, post := range wpl.Posts {
+		if _, ok := selected[post.Id]; ok {
+			selected[post.Id] = true
+			posts = append(posts, post)
+		}
+	}
+
+	for postID, found := range selected {
+		if !found {
+			return nil, errors.Errorf("post with ID %s is not in the post list", postID)
+		}
+	}
+
+	return buildWranglerPostListFromPosts(posts), nil
+}
+
+// Reroot returns a new post list where the post with the given ID is the root
+// post. The original root post becomes the first reply and the order of the
+// remaining posts is kept.
+func (wpl *WranglerPostList) Reroot(postID string) (*WranglerPostList, error) {
+	if wpl.NumPosts() == 0 {
+		return nil, errors.New("the post list contains no posts")
+	}
+	if wpl.RootPost().Id == postID {
+		return nil, errors.Errorf("post with ID %s is already the root post", postID)
+	}
+
+	var newRootPost *model.Post
+	var replies []*model.Post
+	for _, post := range wpl.Posts[1:] {
+		if post.Id == postID {
+			newRootPost = post
+			continue
+		}
+		replies = append(replies, post)
+	}
+	if newRootPost == nil {
+		return nil, errors.Errorf("post with ID %s is not in the post list", postID)
+	}
+
+	posts := append([]*model.Post{newRootPost, wpl.RootPost()}, replies...)
+
+	return buildWranglerPostListFromPosts(posts), nil
+}
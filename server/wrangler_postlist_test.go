@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWranglerPostListSplitAt(t *testing.T) {
+	wpl := buildWranglerPostList(mockGenerateThread(5, model.NewId()))
+
+	t.Run("post in list", func(t *testing.T) {
+		split, err := wpl.SplitAt(wpl.Posts[3].Id)
+		require.NoError(t, err)
+		require.Equal(t, 2, split.NumPosts())
+		assert.Equal(t, wpl.Posts[3].Id, split.RootPost().Id)
+		assert.Equal(t, wpl.Posts[3].CreateAt, split.EarlistPostTimestamp)
+		assert.Equal(t, wpl.LatestPostTimestamp, split.LatestPostTimestamp)
+	})
+
+	t.Run("post not in list", func(t *testing.T) {
+		_, err := wpl.SplitAt(model.NewId())
+		require.Error(t, err)
+	})
+}
+
+func TestWranglerPostListClone(t *testing.T) {
+	wpl := buildWranglerPostList(mockGenerateThread(3, model.NewId()))
+	wpl.Posts[1].FileIds = model.StringArray{model.NewId()}
+
+	clone := wpl.Clone()
+	require.Equal(t, wpl.NumPosts(), clone.NumPosts())
+	assert.Equal(t, wpl.RootPost().Id, clone.RootPost().Id)
+	assert.Equal(t, wpl.Posts[1].FileIds, clone.Posts[1].FileIds)
+
+	clone.Posts[1].FileIds = model.StringArray{model.NewId()}
+	assert.NotEqual(t, wpl.Posts[1].FileIds, clone.Posts[1].FileIds)
+}
+
+func TestWranglerPostListSelect(t *testing.T) {
+	wpl := buildWranglerPostList(mockGenerateThread(5, model.NewId()))
+
+	t.Run("posts in list", func(t *testing.T) {
+		selected, err := wpl.Select([]string{wpl.Posts[4].Id, wpl.Posts[1].Id, wpl.Posts[4].Id})
+		require.NoError(t, err)
+		require.Equal(t, 2, selected.NumPosts())
+		assert.Equal(t, wpl.Posts[1].Id, selected.RootPost().Id)
+		assert.Equal(t, wpl.Posts[4].Id, selected.Posts[1].Id)
+		assert.Equal(t, wpl.Posts[1].CreateAt, selected.EarlistPostTimestamp)
+		assert.Equal(t, wpl.Posts[4].CreateAt, selected.LatestPostTimestamp)
+	})
+
+	t.Run("post not in list", func(t *testing.T) {
+		_, err := wpl.Select([]string{wpl.Posts[1].Id, model.NewId()})
+		require.Error(t, err)
+	})
+}
+
+func TestWranglerPostListReroot(t *testing.T) {
+	wpl := buildWranglerPostList(mockGenerateThread(4, model.NewId()))
+
+	t.Run("reply in list", func(t *testing.T) {
+		rerooted, err := wpl.Reroot(wpl.Posts[2].Id)
+		require.NoError(t, err)
+		require.Equal(t, 4, rerooted.NumPosts())
+		assert.Equal(t, wpl.Posts[2].Id, rerooted.Posts[0].Id)
+		assert.Equal(t, wpl.Posts[0].Id, rerooted.Posts[1].Id)
+		assert.Equal(t, wpl.Posts[1].Id, rerooted.Posts[2].Id)
+		assert.Equal(t, wpl.Posts[3].Id, rerooted.Posts[3].Id)
+	})
+
+	t.Run("root post", func(t *testing.T) {
+		_, err := wpl.Reroot(wpl.RootPost().Id)
+		require.Error(t, err)
+	})
+
+	t.Run("post not in list", func(t *testing.T) {
+		_, err := wpl.Reroot(model.NewId())
+		require.Error(t, err)
+	})
+}
@@ -2,6 +2,8 @@ import {GlobalState} from 'mattermost-redux/types/store';
 
 import {Channel} from 'mattermost-redux/types/channels';
 
+import {generateId} from 'mattermost-redux/utils/helpers';
+
 import {RECEIVED_PLUGIN_SETTINGS} from '../types/wrangler';
 import {OPEN_MOVE_THREAD_MODAL, CLOSE_MOVE_THREAD_MODAL} from '../types/ui';
 import {INITIALIZE_ATTACH_POST, FINALIZE_ATTACH_POST, RichPost} from '../types/attach';
@@ -24,6 +26,28 @@ export type GenericAction = {
     [extraProps: string]: any; //eslint-disable-line @typescript-eslint/no-explicit-any
 };
 
+// Repeating the same command shortly after, such as from a double click,
+// reuses its idempotency key so that the plugin only runs it once.
+const idempotencyKeyReuseWindowMs = 10 * 1000;
+const recentIdempotencyKeys = new Map<string, {key: string; createAt: number}>();
+
+function withIdempotencyKey(command: string): string {
+    const now = Date.now();
+    recentIdempotencyKeys.forEach((value, recentCommand) => {
+        if (now - value.createAt > idempotencyKeyReuseWindowMs) {
+            recentIdempotencyKeys.delete(recentCommand);
+        }
+    });
+
+    let recent = recentIdempotencyKeys.get(command);
+    if (!recent) {
+        recent = {key: generateId(), createAt: now};
+        recentIdempotencyKeys.set(command, recent);
+    }
+
+    return `${command} --idempotency-key=${recent.key}`;
+}
+
 export function openMoveThreadModal(postID: string): ActionFunc {
     return async (dispatch: DispatchFunc) => {
         dispatch({
@@ -124,9 +148,20 @@ export function getSettings(): ActionFunc {
     };
 }
 
+export function getThreadPreview(action: 'move' | 'copy', postID: string, channelID: string): ActionFunc {
+    return async () => {
+        const {data: preview, error} = await Client.getPreview(action, postID, channelID);
+        if (error) {
+            return {error};
+        }
+
+        return {data: preview};
+    };
+}
+
 export function moveThread(postID: string, channelID: string, showRootMessage: boolean, silent: boolean): ActionFunc {
     return async (dispatch: DispatchFunc, getState: GetStateFunc) => {
-        const command = `/wrangler move thread ${postID} ${channelID} --show-root-message-in-summary=${showRootMessage} --silent=${silent}`;
+        const command = withIdempotencyKey(`/wrangler move thread ${postID} ${channelID} --show-root-message-in-summary=${showRootMessage} --silent=${silent}`);
         await Client.clientExecuteCommand(getState, command);
 
         return {data: null};
@@ -135,7 +170,7 @@ export function moveThread(postID: string, channelID: string, showRootMessage: b
 
 export function copyThread(postID: string, channelID: string): ActionFunc {
     return async (dispatch: DispatchFunc, getState: GetStateFunc) => {
-        const command = `/wrangler copy thread ${postID} ${channelID}`;
+        const command = withIdempotencyKey(`/wrangler copy thread ${postID} ${channelID}`);
         await Client.clientExecuteCommand(getState, command);
 
         return {data: null};
@@ -144,7 +179,7 @@ export function copyThread(postID: string, channelID: string): ActionFunc {
 
 export function attachMessage(postToBeAttachedID: string, postToAttachToID: string): ActionFunc {
     return async (dispatch: DispatchFunc, getState: GetStateFunc) => {
-        const command = `/wrangler attach message ${postToBeAttachedID} ${postToAttachToID}`;
+        const command = withIdempotencyKey(`/wrangler attach message ${postToBeAttachedID} ${postToAttachToID}`);
         await Client.clientExecuteCommand(getState, command);
 
         return {data: null};
@@ -153,7 +188,7 @@ export function attachMessage(postToBeAttachedID: string, postToAttachToID: stri
 
 export function mergeThread(postToBeMergedID: string, postToMergeToID: string): ActionFunc {
     return async (dispatch: DispatchFunc, getState: GetStateFunc) => {
-        const command = `/wrangler merge thread ${postToBeMergedID} ${postToMergeToID}`;
+        const command = withIdempotencyKey(`/wrangler merge thread ${postToBeMergedID} ${postToMergeToID}`);
         await Client.clientExecuteCommand(getState, command);
 
         return {data: null};
@@ -13,6 +13,20 @@ export default class Client {
         );
     }
 
+    getPreview = async (action: string, postID: string, channelID: string) => {
+        return this.doFetch(
+            `${this.getAPIV1BaseRoute()}/preview`,
+            {
+                method: 'post',
+                body: JSON.stringify({
+                    action,
+                    post_id: postID,
+                    channel_id: channelID,
+                }),
+            },
+        );
+    }
+
     // Helpers
 
     getAPIV1BaseRoute() {
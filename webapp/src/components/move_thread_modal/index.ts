@@ -9,7 +9,7 @@ import {Channel} from 'mattermost-redux/types/channels';
 import {getPost as getPostSel} from 'mattermost-redux/selectors/entities/posts';
 
 import {isMoveModalVisable, getMoveThreadPostID} from '../../selectors';
-import {closeMoveThreadModal, moveThread, copyThread} from '../../actions';
+import {closeMoveThreadModal, moveThread, copyThread, getThreadPreview} from '../../actions';
 
 import MoveThreadModal from './move_thread_modal';
 
@@ -68,6 +68,7 @@ function mapDispatchToProps(dispatch: Dispatch<Action>) {
         closeMoveThreadModal,
         moveThread,
         copyThread,
+        getThreadPreview,
     }, dispatch);
 }
 
@@ -7,6 +7,7 @@ import {Team} from 'mattermost-redux/types/teams';
 import {Channel} from 'mattermost-redux/types/channels';
 
 import {MessageActionType, MessageActionTypeMove, MessageActionTypeCopy} from '../../types/actions';
+import {Preview} from '../../types/wrangler';
 
 interface Props {
     visible: boolean;
@@ -15,6 +16,7 @@ interface Props {
     threadCount: number;
     moveThread: Function;
     copyThread: Function;
+    getThreadPreview: Function;
     getMyTeams: Function;
     getChannelsForTeam: Function;
     closeMoveThreadModal: Function;
@@ -30,6 +32,8 @@ type State = {
     actionWord: string,
     moveShowRootMessage: boolean,
     moveSilent: boolean,
+    preview: Preview | null,
+    previewError: string,
 }
 
 export default class MoveThreadModal extends React.PureComponent<Props, State> {
@@ -46,6 +50,8 @@ export default class MoveThreadModal extends React.PureComponent<Props, State> {
             actionWord: 'Move',
             moveShowRootMessage: true,
             moveSilent: false,
+            preview: null,
+            previewError: '',
         };
     }
 
@@ -57,6 +63,30 @@ export default class MoveThreadModal extends React.PureComponent<Props, State> {
         if (prevProps.threadCount !== this.props.threadCount || prevState.actionWord !== this.state.actionWord) {
             this.setButtonState();
         }
+        if (prevProps.postID !== this.props.postID || prevState.selectedChannel !== this.state.selectedChannel || prevState.actionType !== this.state.actionType) {
+            this.loadPreview();
+        }
+    }
+
+    private loadPreview = async () => {
+        const {postID} = this.props;
+        const {actionType, selectedChannel} = this.state;
+        if (postID === '' || selectedChannel === '') {
+            this.setState({preview: null, previewError: ''});
+            return;
+        }
+
+        const {data, error} = await this.props.getThreadPreview(actionType, postID, selectedChannel);
+
+        // Ignore previews for a selection that has changed in the meantime.
+        if (postID !== this.props.postID || actionType !== this.state.actionType || selectedChannel !== this.state.selectedChannel) {
+            return;
+        }
+        if (error) {
+            this.setState({preview: null, previewError: String(error)});
+            return;
+        }
+        this.setState({preview: data, previewError: ''});
     }
 
     private loadTeams = async () => {
@@ -144,9 +174,34 @@ export default class MoveThreadModal extends React.PureComponent<Props, State> {
         this.setState({moveThreadButtonText: this.getMoveButtonText(this.state.actionWord)});
     }
 
+    private renderPreview() {
+        const {preview, previewError} = this.state;
+        if (previewError) {
+            return <p className='error-text'>{previewError}</p>;
+        }
+        if (!preview) {
+            return null;
+        }
+
+        const reactionCount = Object.values(preview.reactions || {}).reduce((total, count) => total + count, 0);
+        let target = `${preview.target_channel_type} channel ${preview.target_channel_name}`;
+        if (preview.target_team_name) {
+            target += ` in team ${preview.target_team_name}`;
+        }
+
+        return (
+            <div>
+                <p>
+                    {`${preview.post_count} message(s) from ${(preview.participants || []).length} participant(s), ${preview.file_count} file(s) (${formatBytes(preview.file_bytes)}) and ${reactionCount} reaction(s) to ${target}.`}
+                </p>
+                {preview.blocked && <p className='error-text'>{preview.blocked_reason}</p>}
+            </div>
+        );
+    }
+
     public render() {
         let disabled = false;
-        if (this.props.postID === '' || this.state.selectedChannel === '') {
+        if (this.props.postID === '' || this.state.selectedChannel === '' || (this.state.preview && this.state.preview.blocked)) {
             disabled = true;
         }
 
@@ -281,6 +336,10 @@ export default class MoveThreadModal extends React.PureComponent<Props, State> {
                             />
                             {moveCheckboxes}
                         </Form.Group>
+                        <Form.Group>
+                            <Form.Label>{'Preview'}</Form.Label>
+                            {this.renderPreview()}
+                        </Form.Group>
                     </Form>
                     <p><span className='pull-right'>{moveMessage}</span></p>
                 </Modal.Body>
@@ -308,3 +367,19 @@ export default class MoveThreadModal extends React.PureComponent<Props, State> {
         );
     }
 }
+
+function formatBytes(size: number): string {
+    const unit = 1024;
+    if (size < unit) {
+        return `${size} B`;
+    }
+
+    let div = unit;
+    let exp = 0;
+    for (let n = size / unit; n >= unit; n /= unit) {
+        div *= unit;
+        exp++;
+    }
+
+    return `${(size / div).toFixed(1)} ${'KMGTPE'[exp]}B`;
+}
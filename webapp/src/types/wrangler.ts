@@ -9,6 +9,21 @@ export type Settings = {
 
 export type Channels = Array<Channel>
 
+export type Preview = {
+    action: string;
+    post_count: number;
+    participant_ids: Array<string>;
+    participants: Array<string>;
+    file_count: number;
+    file_bytes: number;
+    reactions: {[emojiName: string]: number};
+    target_team_name: string;
+    target_channel_name: string;
+    target_channel_type: string;
+    blocked: boolean;
+    blocked_reason?: string;
+}
+
 export const RECEIVED_PLUGIN_SETTINGS = `${id}_plugin_settings`;
 
 export type ReceivedPluginSettingsAction = {